@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Admin API: OAuth client management ---
+
+const defaultSecretOverlap = 24 * time.Hour // How long the old secret keeps working after a rotation
+
+// requireAdmin guards admin endpoints. Callers present either the ADMIN_API_TOKEN
+// bearer token or a first-party user access token carrying the admin permission.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := bearerToken(r)
+		if adminToken := os.Getenv("ADMIN_API_TOKEN"); adminToken != "" &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+			next(w, r)
+			return
+		}
+
+		sess := requireFirstPartySession(w, r)
+		if sess == nil {
+			return
+		}
+		if !containsString(sess.Permissions, adminPermission) {
+			http.Error(w, "The admin permission is required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminSession returns the session of an admin calling with their own access token, or
+// nil for ADMIN_API_TOKEN callers. Only call it behind requireAdmin.
+func adminSession(r *http.Request) (*Claims, *Session) {
+	token, _ := bearerToken(r)
+	claims, err := parseAccessToken(token)
+	if err != nil {
+		return nil, nil
+	}
+	sess, err := loadSession(r.Context(), claims.SessionID)
+	if err != nil {
+		return nil, nil
+	}
+	return claims, sess
+}
+
+// AdminListClientsHandler lists every registered client
+func AdminListClientsHandler(w http.ResponseWriter, r *http.Request) {
+	clients, err := listClients()
+	if err != nil {
+		log.Printf("Database error listing clients: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]ClientMetadata, 0, len(clients))
+	for i := range clients {
+		result = append(result, clientMetadataFor(&clients[i]))
+	}
+	writeAdminJSON(w, http.StatusOK, result)
+}
+
+// AdminCreateClientHandler creates a client, returning its secret once
+func AdminCreateClientHandler(w http.ResponseWriter, r *http.Request) {
+	var m ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	created, err := createClient(m, false)
+	if writeAdminClientError(w, err) {
+		return
+	}
+
+	log.Printf("Admin created client %s (%s)", created.ClientID, created.ClientName)
+	writeAdminJSON(w, http.StatusCreated, created)
+}
+
+// AdminGetClientHandler returns a single client's metadata
+func AdminGetClientHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := getOAuthClient(r.PathValue("client_id"))
+	if writeAdminClientError(w, err) {
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, clientMetadataFor(client))
+}
+
+// AdminUpdateClientHandler replaces a client's metadata, including its token lifetimes
+func AdminUpdateClientHandler(w http.ResponseWriter, r *http.Request) {
+	var m ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := updateClient(r.PathValue("client_id"), m)
+	if writeAdminClientError(w, err) {
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, updated)
+}
+
+// AdminDeleteClientHandler deletes a client and its secrets
+func AdminDeleteClientHandler(w http.ResponseWriter, r *http.Request) {
+	clientID := r.PathValue("client_id")
+	if writeAdminClientError(w, deleteClient(clientID)) {
+		return
+	}
+
+	log.Printf("Admin deleted client %s", clientID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateSecretRequest optionally overrides how long the previous secret stays valid
+type RotateSecretRequest struct {
+	OverlapSeconds *int64 `json:"overlap_seconds"`
+}
+
+// AdminRotateClientSecretHandler issues a new client secret. Previous secrets keep
+// working until the overlap window ends.
+func AdminRotateClientSecretHandler(w http.ResponseWriter, r *http.Request) {
+	clientID := r.PathValue("client_id")
+
+	var req RotateSecretRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+	overlap := defaultSecretOverlap
+	if req.OverlapSeconds != nil {
+		if *req.OverlapSeconds < 0 {
+			http.Error(w, "overlap_seconds must not be negative", http.StatusBadRequest)
+			return
+		}
+		overlap = time.Duration(*req.OverlapSeconds) * time.Second
+	}
+
+	// 1. Only secret-based clients have secrets to rotate
+	client, err := getOAuthClient(clientID)
+	if writeAdminClientError(w, err) {
+		return
+	}
+	if !usesClientSecret(client.TokenEndpointAuthMethod) {
+		http.Error(w, "Client does not authenticate with a secret", http.StatusBadRequest)
+		return
+	}
+
+	// 2. Rotate
+	secret, previousExpiresAt, err := rotateClientSecret(clientID, overlap)
+	if err != nil {
+		log.Printf("Database error rotating client secret: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin rotated secret of client %s (previous secret valid until %s)", clientID, previousExpiresAt.Format(time.RFC3339))
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"client_id":                  clientID,
+		"client_secret":              secret,
+		"previous_secrets_expire_at": previousExpiresAt.Unix(),
+	})
+}
+
+// InitialAccessTokenRequest describes a token that authorizes dynamic client registration
+type InitialAccessTokenRequest struct {
+	Description      string `json:"description"`
+	MaxUses          *int   `json:"max_uses"`           // Omit for unlimited registrations
+	ExpiresInSeconds int64  `json:"expires_in_seconds"` // 0 means the token never expires
+}
+
+// AdminCreateInitialAccessTokenHandler issues an initial access token for /oauth/register
+func AdminCreateInitialAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req InitialAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if (req.MaxUses != nil && *req.MaxUses < 1) || req.ExpiresInSeconds < 0 {
+		http.Error(w, "max_uses must be positive and expires_in_seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if req.ExpiresInSeconds > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(req.ExpiresInSeconds) * time.Second), Valid: true}
+	}
+
+	var id int
+	err = DB.QueryRow(`INSERT INTO initial_access_tokens (token_hash, description, max_uses, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id`,
+		hashToken(token), strings.TrimSpace(req.Description), req.MaxUses, expiresAt).Scan(&id)
+	if err != nil {
+		log.Printf("Database error storing initial access token: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{"id": id, "initial_access_token": token}
+	if expiresAt.Valid {
+		resp["expires_at"] = expiresAt.Time.Unix()
+	}
+	writeAdminJSON(w, http.StatusCreated, resp)
+}
+
+// --- Admin API: sessions ---
+
+// AdminEndSessionHandler revokes an OIDC session (all tokens from one browser login)
+// and sends back-channel logout to the clients involved.
+func AdminEndSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sid := strings.TrimSpace(r.PathValue("sid"))
+	loggedOut, err := endOIDCSession(r.Context(), sid)
+	if err != nil {
+		log.Printf("Error ending OIDC session %s: %v", sid, err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin ended OIDC session %s (%d clients affected)", sid, len(loggedOut))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAdminClientError reports a client lookup or save failure, returning false if err is nil
+func writeAdminClientError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var metaErr *clientMetadataError
+	if errors.As(err, &metaErr) {
+		http.Error(w, metaErr.Description, http.StatusBadRequest)
+	} else if err == sql.ErrNoRows {
+		http.Error(w, "Client not found", http.StatusNotFound)
+	} else {
+		log.Printf("Database error managing client: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+	}
+	return true
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
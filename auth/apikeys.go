@@ -0,0 +1,474 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+// --- API keys and personal access tokens ---
+//
+// Keys look like hydra_pat_{id}_{secret} (owned by a user) or hydra_sk_{id}_{secret}
+// (owned by a service client). The prefixes let secret scanners recognise leaked keys;
+// only a hash of the secret is stored. ValidateToken accepts keys in place of access
+// tokens and answers as it would for a token of the owner.
+
+const (
+	apiKeyPrefixPersonal = "hydra_pat_"
+	apiKeyPrefixService  = "hydra_sk_"
+
+	apiKeyDefaultTTL = 90 * 24 * time.Hour
+	apiKeyMaxTTL     = 365 * 24 * time.Hour
+	apiKeyTouchEvery = time.Minute // last_used_at is updated at most this often
+)
+
+// API key kinds
+const (
+	APIKeyPersonal = "personal"
+	APIKeyService  = "service"
+)
+
+// errInvalidAPIKey is returned for unknown, forged, expired or revoked keys
+var errInvalidAPIKey = errors.New("API key is invalid, expired or revoked")
+
+// APIKey is a stored key; the secret is only ever returned in Token when it is created
+type APIKey struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Name       string     `json:"name"`
+	UserID     int        `json:"user_id,omitempty"`
+	ClientID   string     `json:"client_id,omitempty"`
+	OrgID      int        `json:"org_id,omitempty"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Token      string     `json:"token,omitempty"`
+
+	AMR []string `json:"-"`
+}
+
+const apiKeyColumns = `id, kind, name, COALESCE(user_id, 0), COALESCE(client_id, ''), COALESCE(org_id, 0), scope, amr,
+	created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIKey(scan func(dest ...interface{}) error) (*APIKey, error) {
+	var k APIKey
+	var lastUsedAt, revokedAt sql.NullTime
+	err := scan(&k.ID, &k.Kind, &k.Name, &k.UserID, &k.ClientID, &k.OrgID, &k.Scope, pq.Array(&k.AMR),
+		&k.CreatedAt, &k.ExpiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	k.LastUsedAt, k.RevokedAt = nullTimePtr(lastUsedAt), nullTimePtr(revokedAt)
+	return &k, nil
+}
+
+// listAPIKeys returns the keys matching where, newest first
+func listAPIKeys(where string, args ...interface{}) ([]APIKey, error) {
+	rows, err := DB.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE "+where+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// isAPIKey reports whether a presented token has one of the API key prefixes
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefixPersonal) || strings.HasPrefix(token, apiKeyPrefixService)
+}
+
+func apiKeyPrefix(kind string) string {
+	if kind == APIKeyService {
+		return apiKeyPrefixService
+	}
+	return apiKeyPrefixPersonal
+}
+
+// createAPIKey stores a new key and sets its ID, timestamps and Token
+func createAPIKey(k *APIKey, ttl time.Duration, createdBy int) error {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	k.ID = hex.EncodeToString(idBytes)
+	k.Token = apiKeyPrefix(k.Kind) + k.ID + "_" + secret
+	if k.AMR == nil {
+		k.AMR = []string{}
+	}
+
+	return DB.QueryRow(`INSERT INTO api_keys (id, kind, name, user_id, client_id, org_id, secret_hash, scope, amr, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW() + $11 * INTERVAL '1 second')
+		RETURNING created_at, expires_at`,
+		k.ID, k.Kind, k.Name, sql.NullInt64{Int64: int64(k.UserID), Valid: k.UserID != 0}, nullString(k.ClientID),
+		sql.NullInt64{Int64: int64(k.OrgID), Valid: k.OrgID != 0}, hashToken(secret), k.Scope, pq.Array(k.AMR),
+		sql.NullInt64{Int64: int64(createdBy), Valid: createdBy != 0}, int64(ttl.Seconds())).
+		Scan(&k.CreatedAt, &k.ExpiresAt)
+}
+
+// lookupAPIKey resolves a presented key, returning errInvalidAPIKey unless it is active
+func lookupAPIKey(token string) (*APIKey, error) {
+	var kind, rest string
+	switch {
+	case strings.HasPrefix(token, apiKeyPrefixPersonal):
+		kind, rest = APIKeyPersonal, strings.TrimPrefix(token, apiKeyPrefixPersonal)
+	case strings.HasPrefix(token, apiKeyPrefixService):
+		kind, rest = APIKeyService, strings.TrimPrefix(token, apiKeyPrefixService)
+	default:
+		return nil, errInvalidAPIKey
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return nil, errInvalidAPIKey
+	}
+
+	var storedHash string
+	k, err := scanAPIKey(func(dest ...interface{}) error {
+		return DB.QueryRow("SELECT "+apiKeyColumns+", secret_hash FROM api_keys WHERE id = $1", id).
+			Scan(append(dest, &storedHash)...)
+	})
+	if err == sql.ErrNoRows {
+		return nil, errInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+	if k.Kind != kind || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(storedHash)) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	if k.RevokedAt != nil || !time.Now().Before(k.ExpiresAt) {
+		return nil, errInvalidAPIKey
+	}
+	return k, nil
+}
+
+// touchAPIKey records that a key was used, at most once per apiKeyTouchEvery
+func touchAPIKey(id string) {
+	_, err := DB.Exec(`UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - $2 * INTERVAL '1 second')`,
+		id, int(apiKeyTouchEvery.Seconds()))
+	if err != nil {
+		log.Printf("Database error recording API key use: %v", err)
+	}
+}
+
+// apiKeySession is the session a key stands in for. Personal keys get the owner's current
+// roles and must satisfy their organization's settings.
+func apiKeySession(k *APIKey) (*Session, error) {
+	if k.Kind == APIKeyService {
+		return &Session{ClientID: k.ClientID, Scope: k.Scope, PrincipalType: PrincipalService}, nil
+	}
+
+	sess := &Session{UserID: k.UserID, OrgID: k.OrgID, Scope: k.Scope, LoginMethod: LoginMethodAPIKey, AMR: k.AMR}
+	if err := loadSessionAuthorization(sess); err != nil {
+		return nil, err
+	}
+	if err := checkTenantSession(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// validateAPIKey is validateTokenRequest for API keys. Keys are bearer credentials, so
+// there is no binding or session to check.
+func validateAPIKey(token, expectedAudience string) (*Claims, string) {
+	// 1. The key must exist, match and be active
+	k, err := lookupAPIKey(token)
+	if err == errInvalidAPIKey {
+		return nil, err.Error()
+	} else if err != nil {
+		log.Printf("Database error looking up API key: %v", err)
+		return nil, "Internal server error during API key check."
+	}
+
+	// 2. The owner's current authorization
+	sess, err := apiKeySession(k)
+	var policyErr *TenantPolicyError
+	if err == errNotOrgMember {
+		return nil, "API key owner is no longer a member of its organization."
+	} else if errors.As(err, &policyErr) {
+		return nil, "API key rejected by " + policyErr.Error()
+	} else if err != nil {
+		log.Printf("Error loading API key owner: %v", err)
+		return nil, "Internal server error during API key check."
+	}
+
+	claims := &Claims{
+		UserID:        sess.UserID,
+		PrincipalType: sess.principalType(),
+		ClientID:      sess.ClientID,
+		Scope:         sess.Scope,
+		Roles:         sess.Roles,
+		Permissions:   sess.Permissions,
+		OrgID:         sess.OrgID,
+		APIKeyID:      k.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuerURL(),
+			Subject:   sess.subject(),
+			Audience:  defaultAudience(),
+			ExpiresAt: jwt.NewNumericDate(k.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(k.CreatedAt),
+			ID:        k.ID,
+		},
+	}
+
+	// 3. The key must be meant for the caller
+	if expectedAudience != "" && !audienceIncludes(claims.Audience, expectedAudience) {
+		return nil, "Token audience does not include " + expectedAudience
+	}
+
+	touchAPIKey(k.ID)
+	return claims, ""
+}
+
+// --- Account API: personal access tokens ---
+
+// APIKeyRequest creates a key. ExpiresIn is in seconds; 0 means apiKeyDefaultTTL.
+type APIKeyRequest struct {
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`         // Space-delimited
+	Org       string `json:"org,omitempty"` // Personal keys only: slug of the organization to act for
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// validate normalizes the request and returns the key's lifetime
+func (req *APIKeyRequest) validate() (time.Duration, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		return 0, errors.New("name is required and must be at most 255 characters")
+	}
+	req.Scope = strings.Join(strings.Fields(req.Scope), " ")
+	if req.ExpiresIn < 0 || time.Duration(req.ExpiresIn)*time.Second > apiKeyMaxTTL {
+		return 0, fmt.Errorf("expires_in must be between 1 and %d seconds", int(apiKeyMaxTTL.Seconds()))
+	}
+	if req.ExpiresIn == 0 {
+		return apiKeyDefaultTTL, nil
+	}
+	return time.Duration(req.ExpiresIn) * time.Second, nil
+}
+
+// CreatePersonalAPIKeyHandler creates a key acting as the user. The secret is only shown once.
+func CreatePersonalAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+	ttl, err := req.validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 1. A key never carries more scope than the session creating it
+	allowed, err := personalKeyScopes(sess)
+	if err != nil {
+		log.Printf("Database error loading scopes: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	scope := ""
+	if req.Scope != "" || sess.Scope != "" {
+		var ok bool
+		if scope, ok = resolveScope(req.Scope, allowed); !ok {
+			http.Error(w, "Requested scope exceeds what this session may grant", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 2. The key must be usable for its organization when created
+	orgID, err := resolveOrgID(req.Org)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not a member of this organization", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading organization: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	k := &APIKey{Kind: APIKeyPersonal, Name: req.Name, UserID: sess.UserID, OrgID: orgID, Scope: scope, AMR: sess.AMR}
+	_, err = apiKeySession(k)
+	var policyErr *TenantPolicyError
+	if err == errNotOrgMember {
+		http.Error(w, "Not a member of this organization", http.StatusForbidden)
+		return
+	} else if errors.As(err, &policyErr) {
+		http.Error(w, policyErr.Reason, http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading roles: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// 3. Store it
+	if err := createAPIKey(k, ttl, sess.UserID); err != nil {
+		log.Printf("Database error creating API key: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d created API key %s (%s)", sess.UserID, k.ID, k.Name)
+	writeAdminJSON(w, http.StatusCreated, k)
+}
+
+// personalKeyScopes lists the scopes a personal key created with sess may carry: the session's
+// own scope, or any scope registered for an OAuth client when the session is unrestricted
+func personalKeyScopes(sess *Session) ([]string, error) {
+	if sess.Scope != "" {
+		return strings.Fields(sess.Scope), nil
+	}
+	rows, err := DB.Query("SELECT DISTINCT unnest(scopes) FROM oauth_clients ORDER BY 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scopes []string
+	for rows.Next() {
+		var scope string
+		if err := rows.Scan(&scope); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, rows.Err()
+}
+
+// ListPersonalAPIKeysHandler lists the user's keys without their secrets
+func ListPersonalAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartyViewSession(w, r)
+	if sess == nil {
+		return
+	}
+	keys, err := listAPIKeys("user_id = $1", sess.UserID)
+	if err != nil {
+		log.Printf("Database error listing API keys: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, keys)
+}
+
+// RevokePersonalAPIKeyHandler revokes one of the user's keys
+func RevokePersonalAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+	revokeAPIKey(w, r.PathValue("id"), sess.UserID)
+}
+
+// revokeAPIKey revokes a key, only if it belongs to userID when that is not 0
+func revokeAPIKey(w http.ResponseWriter, id string, userID int) {
+	res, err := DB.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL AND ($2 = 0 OR user_id = $2)", id, userID)
+	if err != nil {
+		log.Printf("Database error revoking API key: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Revoked API key %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Admin API: service keys ---
+
+// AdminCreateServiceAPIKeyHandler creates a key acting as a client_credentials client.
+// Its scope must be within the client's registered scopes.
+func AdminCreateServiceAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	ttl, err := req.validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client, err := getOAuthClient(r.PathValue("client_id"))
+	if writeAdminClientError(w, err) {
+		return
+	}
+	if !client.AllowsGrant("client_credentials") {
+		http.Error(w, "Client is not allowed the client_credentials grant", http.StatusBadRequest)
+		return
+	}
+	scope, ok := resolveScope(req.Scope, client.Scopes)
+	if !ok {
+		http.Error(w, "Requested scope exceeds the client's scopes", http.StatusBadRequest)
+		return
+	}
+
+	createdBy := 0
+	if _, sess := adminSession(r); sess != nil {
+		createdBy = sess.UserID
+	}
+	k := &APIKey{Kind: APIKeyService, Name: req.Name, ClientID: client.ClientID, Scope: scope}
+	if err := createAPIKey(k, ttl, createdBy); err != nil {
+		log.Printf("Database error creating API key: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin created API key %s for client %s", k.ID, client.ClientID)
+	writeAdminJSON(w, http.StatusCreated, k)
+}
+
+// AdminListAPIKeysHandler lists keys, optionally filtered by user_id or client_id
+func AdminListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		var err error
+		if userID, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	}
+	keys, err := listAPIKeys("($1 = 0 OR user_id = $1) AND ($2 = '' OR client_id = $2)", userID, r.URL.Query().Get("client_id"))
+	if err != nil {
+		log.Printf("Database error listing API keys: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, keys)
+}
+
+// AdminRevokeAPIKeyHandler revokes any key
+func AdminRevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	revokeAPIKey(w, r.PathValue("id"), 0)
+}
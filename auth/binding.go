@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// --- Sender-constrained tokens: key binding shared by DPoP and mTLS ---
+
+// Confirmation binds a token to a key held by the client (RFC 7800 cnf claim)
+type Confirmation struct {
+	JKT     string `json:"jkt,omitempty"`      // SHA-256 JWK thumbprint of the DPoP key (RFC 9449)
+	X5tS256 string `json:"x5t#S256,omitempty"` // SHA-256 thumbprint of the client certificate (RFC 8705)
+}
+
+var errTokenBinding = errors.New("token binding check failed")
+
+// TokenPresentation is what accompanied an access token when it was presented to a resource server
+type TokenPresentation struct {
+	DPoPProof  string
+	Method     string
+	URL        string
+	ClientCert []byte // DER-encoded mTLS client certificate
+}
+
+// presentationFromRequest collects the binding evidence sent with an HTTP request to this service
+func presentationFromRequest(r *http.Request) TokenPresentation {
+	return TokenPresentation{
+		DPoPProof:  r.Header.Get("DPoP"),
+		Method:     r.Method,
+		URL:        requestURL(r),
+		ClientCert: peerCertificate(r),
+	}
+}
+
+// verifyTokenBinding checks that a sender-constrained access token is presented by the holder of its key
+func verifyTokenBinding(ctx context.Context, claims *Claims, accessToken string, p TokenPresentation) error {
+	if claims.Cnf == nil {
+		return nil
+	}
+
+	if claims.Cnf.JKT != "" {
+		jkt, err := verifyDPoPProof(ctx, p.DPoPProof, p.Method, p.URL, accessToken)
+		if err != nil {
+			return err
+		}
+		if jkt != claims.Cnf.JKT {
+			return fmt.Errorf("%w: proof key does not match the token binding", errInvalidDPoPProof)
+		}
+	}
+
+	if claims.Cnf.X5tS256 != "" {
+		if len(p.ClientCert) == 0 {
+			return fmt.Errorf("%w: token is certificate-bound but no client certificate was presented", errTokenBinding)
+		}
+		if subtle.ConstantTimeCompare([]byte(certThumbprint(p.ClientCert)), []byte(claims.Cnf.X5tS256)) != 1 {
+			return fmt.Errorf("%w: client certificate does not match the token binding", errTokenBinding)
+		}
+	}
+	return nil
+}
+
+// requestConfirmation returns the binding for tokens about to be issued: the DPoP key when
+// the request carries a proof, and the client certificate when it arrived over mTLS.
+// Returns nil for plain bearer tokens.
+func requestConfirmation(r *http.Request) (*Confirmation, error) {
+	var cnf Confirmation
+
+	if proof := r.Header.Get("DPoP"); proof != "" {
+		jkt, err := verifyDPoPProof(r.Context(), proof, r.Method, requestURL(r), "")
+		if err != nil {
+			return nil, err
+		}
+		cnf.JKT = jkt
+	}
+	if cert := peerCertificate(r); cert != nil {
+		cnf.X5tS256 = certThumbprint(cert)
+	}
+
+	if cnf == (Confirmation{}) {
+		return nil, nil
+	}
+	return &cnf, nil
+}
+
+// checkPresentedBinding requires a request using a bound session's credentials, such as a
+// refresh, to prove possession of the same key(s)
+func checkPresentedBinding(bound, presented *Confirmation) error {
+	if bound == nil {
+		return nil
+	}
+	if bound.JKT != "" && (presented == nil || presented.JKT != bound.JKT) {
+		return fmt.Errorf("%w: a proof from the key the session is bound to is required", errInvalidDPoPProof)
+	}
+	if bound.X5tS256 != "" && (presented == nil || presented.X5tS256 != bound.X5tS256) {
+		return fmt.Errorf("%w: the certificate the session is bound to is required", errTokenBinding)
+	}
+	return nil
+}
+
+// tokenTypeFor reports the token_type to return for a session.
+// Certificate-bound tokens remain Bearer tokens (RFC 8705 section 3).
+func tokenTypeFor(sess Session) string {
+	if sess.Cnf != nil && sess.Cnf.JKT != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	proto "hydraauth/auth/pb/authpb"
+)
+
+// jwt.go panics in init without JWT_SECRET. Package variables are initialized before any
+// init function runs, so tests get a key even when the variable is not set.
+var _ = func() bool {
+	if SecretKey == "" {
+		SecretKey = "test-secret"
+	}
+	return true
+}()
+
+// testCA is a locally generated certificate authority for mTLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issueClientCert signs a client certificate with the given subject
+func (ca *testCA) issueClientCert(t *testing.T, subject pkix.Name) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// newMTLSServer starts a TLS server configured by loadTLSConfig to trust ca for client certificates
+func newMTLSServer(t *testing.T, ca *testCA, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	caFile := filepath.Join(t.TempDir(), "client-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TLS_CLIENT_CA_FILE", caFile)
+	cfg, err := loadTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = cfg
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// clientWithCert returns an HTTP client for srv presenting cert, or no certificate when nil.
+// The certificate is sent even when the server's CA list would not accept it.
+func clientWithCert(srv *httptest.Server, cert *tls.Certificate) *http.Client {
+	client := srv.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	if cert != nil {
+		transport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+	}
+	client.Transport = transport
+	return client
+}
+
+func TestTLSClientAuthSubjectDN(t *testing.T) {
+	ca := newTestCA(t, "Test Client CA")
+	registered := &OAuthClient{
+		ClientID:                "service-a",
+		TokenEndpointAuthMethod: "tls_client_auth",
+		TLSClientAuthSubjectDN:  sql.NullString{String: "CN=service-a,O=Example", Valid: true},
+	}
+	srv := newMTLSServer(t, ca, func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateTLSClient(r, registered); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	matching := ca.issueClientCert(t, pkix.Name{CommonName: "service-a", Organization: []string{"Example"}})
+	other := ca.issueClientCert(t, pkix.Name{CommonName: "service-b", Organization: []string{"Example"}})
+	untrusted := newTestCA(t, "Other CA").issueClientCert(t, pkix.Name{CommonName: "service-a", Organization: []string{"Example"}})
+
+	tests := []struct {
+		name   string
+		cert   *tls.Certificate
+		status int // 0 when the TLS handshake itself must fail
+	}{
+		{"registered subject", &matching, http.StatusNoContent},
+		{"different subject", &other, http.StatusUnauthorized},
+		{"no certificate", nil, http.StatusUnauthorized},
+		{"certificate from another CA", &untrusted, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := clientWithCert(srv, tt.cert).Get(srv.URL)
+			if tt.status == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("expected the handshake to fail, got status %d", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+// issueBoundToken issues an access token the way the token endpoint does for a request
+// arriving over mTLS with cert
+func issueBoundToken(t *testing.T, ca *testCA, cert tls.Certificate) string {
+	t.Helper()
+	var token string
+	srv := newMTLSServer(t, ca, func(w http.ResponseWriter, r *http.Request) {
+		cnf, err := requestConfirmation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token, err = generateJWT("session-1", Session{UserID: 1, Cnf: cnf}, time.Minute)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	resp, err := clientWithCert(srv, &cert).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	return token
+}
+
+func TestCertificateBoundTokenCnf(t *testing.T) {
+	ca := newTestCA(t, "Test Client CA")
+	cert := ca.issueClientCert(t, pkix.Name{CommonName: "service-a"})
+	token := issueBoundToken(t, ca, cert)
+
+	// The cnf claim is the base64url SHA-256 of the DER certificate (RFC 8705 section 3.1)
+	sum := sha256.Sum256(cert.Certificate[0])
+	want := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Cnf map[string]string `json:"cnf"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if got := raw.Cnf["x5t#S256"]; got != want {
+		t.Fatalf("cnf.x5t#S256 = %q, want %q", got, want)
+	}
+	if raw.Cnf["jkt"] != "" {
+		t.Fatalf("unexpected cnf.jkt %q without a DPoP proof", raw.Cnf["jkt"])
+	}
+}
+
+func TestValidateTokenRejectsWrongCertificate(t *testing.T) {
+	ca := newTestCA(t, "Test Client CA")
+	cert := ca.issueClientCert(t, pkix.Name{CommonName: "service-a"})
+	other := ca.issueClientCert(t, pkix.Name{CommonName: "service-a"})
+	token := issueBoundToken(t, ca, cert)
+
+	server := &AuthValidationServer{}
+	for name, presented := range map[string][]byte{
+		"missing certificate":   nil,
+		"different certificate": other.Certificate[0],
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := server.ValidateToken(context.Background(), &proto.ValidateTokenRequest{Token: token, ClientCertificate: presented})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IsValid || !strings.Contains(resp.Error, "certificate") {
+				t.Fatalf("IsValid = %v, Error = %q; want a certificate binding error", resp.IsValid, resp.Error)
+			}
+		})
+	}
+
+	// The matching certificate passes the binding step; the session lookup that follows needs Redis
+	claims, err := parseAccessToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyTokenBinding(context.Background(), claims, token, TokenPresentation{ClientCert: cert.Certificate[0]}); err != nil {
+		t.Fatalf("matching certificate rejected: %v", err)
+	}
+}
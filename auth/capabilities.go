@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	proto "hydraauth/auth/pb/authpb"
+)
+
+// --- Capability tokens ---
+//
+// A capability grants part of its issuer's permissions to whoever holds it, in the style
+// of macaroons. It carries a list of caveats, conditions every use must meet, and a
+// chained HMAC signature:
+//
+//	sig_0 = HMAC(root, id), sig_i = HMAC(sig_i-1, caveat_i)
+//
+// where root is derived from the server secret and the capability's ID. A holder can
+// append a caveat and replace the signature with HMAC(sig, caveat) without contacting
+// this service, e.g. to narrow a capability to one resource and one hour before passing
+// it to a partner. Removing a caveat would need the previous signature, which only the
+// server can compute. VerifyCapability recomputes the chain, evaluates every caveat and
+// then asks the policy engine whether the issuer may still perform the action.
+//
+// Tokens are "hydra_cap_" followed by the base64url-encoded JSON of capabilityToken.
+
+const (
+	capabilityPrefix     = "hydra_cap_"
+	capabilityVersion    = 1
+	capabilityDefaultTTL = time.Hour
+	capabilityMaxTTL     = 30 * 24 * time.Hour
+	maxCapabilityCaveats = 32 // Per token, bounding the work of one verification
+)
+
+// errInvalidCapability is returned for capabilities that cannot be decoded or whose
+// signature does not match their caveats
+var errInvalidCapability = errors.New("capability is malformed or its signature does not match")
+
+// capabilityToken is the encoded form of a capability
+type capabilityToken struct {
+	Version   int      `json:"v"`
+	ID        string   `json:"id"`
+	Location  string   `json:"loc"` // Issuer URL, telling holders where the capability is verified
+	Caveats   []string `json:"caveats"`
+	Signature string   `json:"sig"` // base64url
+}
+
+// capabilityRootKey derives the key a capability's signature chain starts from
+func capabilityRootKey(id string) []byte {
+	mac := hmac.New(sha256.New, []byte(SecretKey))
+	mac.Write([]byte("capability\x00" + id))
+	return mac.Sum(nil)
+}
+
+// chainSignature is one link of the signature chain
+func chainSignature(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signCapability builds a capability with the signature for its ID and caveats
+func signCapability(id string, caveats []string) *capabilityToken {
+	sig := chainSignature(capabilityRootKey(id), id)
+	for _, c := range caveats {
+		sig = chainSignature(sig, c)
+	}
+	return &capabilityToken{
+		Version:   capabilityVersion,
+		ID:        id,
+		Location:  issuerURL(),
+		Caveats:   caveats,
+		Signature: base64.RawURLEncoding.EncodeToString(sig),
+	}
+}
+
+func (c *capabilityToken) encode() string {
+	data, _ := json.Marshal(c)
+	return capabilityPrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCapability parses a capability without checking its signature
+func decodeCapability(token string) (*capabilityToken, error) {
+	encoded, ok := strings.CutPrefix(token, capabilityPrefix)
+	if !ok {
+		return nil, errInvalidCapability
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidCapability
+	}
+	var c capabilityToken
+	if err := json.Unmarshal(data, &c); err != nil || c.Version != capabilityVersion || c.ID == "" {
+		return nil, errInvalidCapability
+	}
+	if len(c.Caveats) > maxCapabilityCaveats {
+		return nil, fmt.Errorf("capability has more than %d caveats", maxCapabilityCaveats)
+	}
+	return &c, nil
+}
+
+// verifySignature recomputes the signature chain from the server secret
+func (c *capabilityToken) verifySignature() bool {
+	expected := signCapability(c.ID, c.Caveats).Signature
+	return hmac.Equal([]byte(expected), []byte(c.Signature))
+}
+
+// attenuateCapability appends caveats to a capability. It needs no secret: each new link
+// is keyed with the signature the holder already has.
+func attenuateCapability(token string, caveats []string) (string, error) {
+	c, err := decodeCapability(token)
+	if err != nil {
+		return "", err
+	}
+	if len(c.Caveats)+len(caveats) > maxCapabilityCaveats {
+		return "", fmt.Errorf("a capability may have at most %d caveats", maxCapabilityCaveats)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(c.Signature)
+	if err != nil {
+		return "", errInvalidCapability
+	}
+	for _, s := range caveats {
+		if _, err := parseCaveat(s); err != nil {
+			return "", err
+		}
+		sig = chainSignature(sig, s)
+		c.Caveats = append(c.Caveats, s)
+	}
+	c.Signature = base64.RawURLEncoding.EncodeToString(sig)
+	return c.encode(), nil
+}
+
+// --- Caveats ---
+//
+// Each caveat is "<field> <operator> <value>"; "in" takes a comma-separated list:
+//
+//	time < 2026-01-02T15:04:05Z       uses must happen before this time (RFC 3339)
+//	action = documents:read           or "in"; patterns ending in * match as in policies
+//	resource = document:42            type:id of the resource; or "in"
+//	resource_type = document          or "in"
+//	audience = billing-service        identifier of the verifying service; or "in"
+//	client_ip in 10.0.0.0/8           CIDRs the holder's address must be in; or "="
+//
+// A caveat that cannot be parsed fails verification, so adding caveats can only ever
+// narrow a capability.
+
+type caveat struct {
+	Field  string
+	Op     string
+	Values []string
+}
+
+// capabilityUse is the attempted use caveats are evaluated against
+type capabilityUse struct {
+	Action   string
+	Resource *proto.Resource
+	Audience string
+	ClientIP net.IP
+	Time     time.Time
+}
+
+func parseCaveat(s string) (caveat, error) {
+	field, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	op, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return caveat{}, fmt.Errorf("caveat %q must have the form \"<field> <operator> <value>\"", s)
+	}
+
+	c := caveat{Field: field, Op: op, Values: []string{value}}
+	if op == "in" {
+		c.Values = nil
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				c.Values = append(c.Values, v)
+			}
+		}
+	}
+
+	switch {
+	case field == "time" && op == "<":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return caveat{}, fmt.Errorf("caveat %q: time must be in RFC 3339 format", s)
+		}
+	case field == "client_ip" && (op == "=" || op == "in"):
+		for _, cidr := range c.Values {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return caveat{}, fmt.Errorf("caveat %q: invalid CIDR %q", s, cidr)
+			}
+		}
+	case (field == "action" || field == "resource" || field == "resource_type" || field == "audience") && (op == "=" || op == "in"):
+	default:
+		return caveat{}, fmt.Errorf("unsupported caveat %q", s)
+	}
+	return c, nil
+}
+
+// satisfiedBy reports whether the use meets the caveat. Caveats about a part of the use
+// the verifier did not supply are not met.
+func (c caveat) satisfiedBy(use *capabilityUse) bool {
+	switch c.Field {
+	case "time":
+		until, _ := time.Parse(time.RFC3339, c.Values[0])
+		return use.Time.Before(until)
+	case "action":
+		_, ok := anyActionMatches(c.Values, use.Action)
+		return ok
+	case "resource":
+		return use.Resource.GetId() != "" && containsString(c.Values, use.Resource.GetType()+":"+use.Resource.GetId())
+	case "resource_type":
+		return use.Resource.GetType() != "" && containsString(c.Values, use.Resource.GetType())
+	case "audience":
+		return use.Audience != "" && containsString(c.Values, use.Audience)
+	case "client_ip":
+		for _, cidr := range c.Values {
+			if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(use.ClientIP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// --- Issuance and storage ---
+
+// Capability is the stored record of an issued capability; Token is only set when issued
+type Capability struct {
+	ID        string     `json:"id"`
+	UserID    int        `json:"user_id"`
+	OrgID     int        `json:"org_id,omitempty"`
+	Caveats   []string   `json:"caveats"` // As issued, before any holder added more
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Token     string     `json:"capability,omitempty"`
+}
+
+const capabilityColumns = "id, user_id, COALESCE(org_id, 0), caveats, created_at, expires_at, revoked_at"
+
+func scanCapability(scan func(dest ...interface{}) error) (*Capability, error) {
+	var c Capability
+	var revokedAt sql.NullTime
+	if err := scan(&c.ID, &c.UserID, &c.OrgID, pq.Array(&c.Caveats), &c.CreatedAt, &c.ExpiresAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	c.RevokedAt = nullTimePtr(revokedAt)
+	return &c, nil
+}
+
+// capabilityTTL checks requested caveats and returns the lifetime for expiresIn seconds
+func capabilityTTL(caveats []string, expiresIn int64) (time.Duration, error) {
+	if len(caveats)+1 > maxCapabilityCaveats {
+		return 0, fmt.Errorf("a capability may have at most %d caveats", maxCapabilityCaveats-1)
+	}
+	for _, s := range caveats {
+		if _, err := parseCaveat(s); err != nil {
+			return 0, err
+		}
+	}
+	if expiresIn < 0 || time.Duration(expiresIn)*time.Second > capabilityMaxTTL {
+		return 0, fmt.Errorf("expires_in must be between 1 and %d seconds", int(capabilityMaxTTL.Seconds()))
+	}
+	if expiresIn == 0 {
+		return capabilityDefaultTTL, nil
+	}
+	return time.Duration(expiresIn) * time.Second, nil
+}
+
+// issueCapability stores and signs a capability acting as the user. Its expiry is always
+// the first caveat, so the token states its own lifetime to holders.
+func issueCapability(userID, orgID int, caveats []string, ttl time.Duration) (*Capability, error) {
+	c := &Capability{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		OrgID:     orgID,
+		ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	c.Caveats = append([]string{"time < " + c.ExpiresAt.Format(time.RFC3339)}, caveats...)
+
+	err := DB.QueryRow(`INSERT INTO capabilities (id, user_id, org_id, caveats, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING created_at`,
+		c.ID, userID, sql.NullInt64{Int64: int64(orgID), Valid: orgID != 0}, pq.Array(c.Caveats), c.ExpiresAt).
+		Scan(&c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.Token = signCapability(c.ID, c.Caveats).encode()
+	return c, nil
+}
+
+// --- gRPC: issuance and verification ---
+
+// IssueCapability issues a capability acting as the user of a first-party token
+func (s *AuthValidationServer) IssueCapability(ctx context.Context, req *proto.IssueCapabilityRequest) (*proto.IssueCapabilityResponse, error) {
+	// 1. The token must pass every ValidateToken check
+	claims, errMsg := validateTokenRequest(ctx, req.Token)
+	if claims == nil {
+		return &proto.IssueCapabilityResponse{Error: errMsg}, nil
+	}
+
+	// 2. Only the user themselves may hand out their permissions, as for the account API.
+	// API keys are refused too: a capability would outlive the key and escape its scope.
+	if claims.PrincipalType == PrincipalService || claims.Impersonation || claims.Act != nil || claims.APIKeyID != "" {
+		return &proto.IssueCapabilityResponse{Error: "Only user tokens can issue capabilities"}, nil
+	}
+	if claims.ClientID != "" {
+		client, err := getOAuthClient(claims.ClientID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Database error loading OAuth client: %v", err)
+			return &proto.IssueCapabilityResponse{Error: "Internal server error loading client."}, nil
+		}
+		if err == sql.ErrNoRows || !client.FirstParty {
+			return &proto.IssueCapabilityResponse{Error: "Only first-party tokens can issue capabilities"}, nil
+		}
+	}
+
+	// 3. Issue it
+	ttl, err := capabilityTTL(req.Caveats, req.ExpiresIn)
+	if err != nil {
+		return &proto.IssueCapabilityResponse{Error: err.Error()}, nil
+	}
+	c, err := issueCapability(claims.UserID, claims.OrgID, req.Caveats, ttl)
+	if err != nil {
+		log.Printf("Database error issuing capability: %v", err)
+		return &proto.IssueCapabilityResponse{Error: "Internal server error issuing capability."}, nil
+	}
+
+	log.Printf("User %d issued capability %s", claims.UserID, c.ID)
+	return &proto.IssueCapabilityResponse{Capability: c.Token, Id: c.ID, ExpiresAt: c.ExpiresAt.Unix()}, nil
+}
+
+// VerifyCapability decides whether a capability allows an action. Its signature, every
+// caveat and its revocation are checked first; the issuer's current permissions then
+// bound what it grants, so a capability never outlasts the role it was issued from.
+func (s *AuthValidationServer) VerifyCapability(ctx context.Context, req *proto.VerifyCapabilityRequest) (*proto.VerifyCapabilityResponse, error) {
+	if req.Check.GetAction() == "" {
+		return &proto.VerifyCapabilityResponse{Valid: false, Error: "action is required"}, nil
+	}
+
+	// 1. Signature
+	token, err := decodeCapability(req.Capability)
+	if err == nil && !token.verifySignature() {
+		err = errInvalidCapability
+	}
+	if err != nil {
+		return &proto.VerifyCapabilityResponse{Valid: false, Error: "Capability is invalid: " + err.Error()}, nil
+	}
+	resp := &proto.VerifyCapabilityResponse{CapabilityId: token.ID, Caveats: token.Caveats}
+
+	// 2. The issued record must be active
+	c, err := scanCapability(DB.QueryRow("SELECT "+capabilityColumns+" FROM capabilities WHERE id = $1", token.ID).Scan)
+	if err == sql.ErrNoRows {
+		resp.Error = "Capability is invalid: " + errInvalidCapability.Error()
+		return resp, nil
+	} else if err != nil {
+		log.Printf("Database error loading capability: %v", err)
+		resp.Error = "Internal server error during capability check."
+		return resp, nil
+	}
+	resp.UserId, resp.OrgId = int32(c.UserID), int32(c.OrgID)
+	if c.RevokedAt != nil || !time.Now().Before(c.ExpiresAt) {
+		resp.Error = "Capability is expired or revoked."
+		return resp, nil
+	}
+
+	// 3. Every caveat, in order
+	use := capabilityUse{
+		Action:   req.Check.Action,
+		Resource: req.Check.Resource,
+		Audience: req.ExpectedAudience,
+		ClientIP: net.ParseIP(req.ClientIp),
+		Time:     time.Now(),
+	}
+	for _, s := range token.Caveats {
+		cv, err := parseCaveat(s)
+		if err != nil {
+			resp.Error = "Capability caveat is not supported: " + err.Error()
+			return resp, nil
+		}
+		if !cv.satisfiedBy(&use) {
+			resp.Error = "Capability caveat not satisfied: " + s
+			return resp, nil
+		}
+	}
+
+	// 4. The issuer's current roles
+	sess := Session{UserID: c.UserID, OrgID: c.OrgID}
+	if err := loadSessionAuthorization(&sess); err == errNotOrgMember {
+		resp.Error = "Capability issuer is no longer a member of its organization."
+		return resp, nil
+	} else if err != nil {
+		log.Printf("Error loading capability issuer: %v", err)
+		resp.Error = "Internal server error during capability check."
+		return resp, nil
+	}
+
+	// 5. The issuer must be allowed the action, judged as for their own token
+	policies, err := listPolicies()
+	if err != nil {
+		log.Printf("Database error loading policies: %v", err)
+		resp.Error = "Internal server error loading policies."
+		return resp, nil
+	}
+	claims := &Claims{
+		UserID:           sess.UserID,
+		OrgID:            sess.OrgID,
+		Roles:            sess.Roles,
+		Permissions:      sess.Permissions,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: sess.subject()},
+	}
+	access := accessRequestFor(claims, req.ClientIp)
+	access.Action, access.Resource = req.Check.Action, req.Check.Resource
+	decision := evaluate(policies, &access)
+	resp.Reason, resp.Policy = decision.Reason, decision.Policy
+	if !decision.Allowed {
+		resp.Error = "Capability issuer is not allowed this action."
+		return resp, nil
+	}
+
+	resp.Valid = true
+	return resp, nil
+}
+
+// --- Account API: capabilities ---
+
+// CapabilityRequest issues a capability. ExpiresIn is in seconds; 0 means capabilityDefaultTTL.
+type CapabilityRequest struct {
+	Caveats   []string `json:"caveats"`
+	ExpiresIn int64    `json:"expires_in"`
+}
+
+// IssueCapabilityHandler issues a capability acting as the user, for the organization the
+// session acts for. The token is only shown once.
+func IssueCapabilityHandler(w http.ResponseWriter, r *http.Request) {
+	var req CapabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+	ttl, err := capabilityTTL(req.Caveats, req.ExpiresIn)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c, err := issueCapability(sess.UserID, sess.OrgID, req.Caveats, ttl)
+	if err != nil {
+		log.Printf("Database error issuing capability: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d issued capability %s", sess.UserID, c.ID)
+	writeAdminJSON(w, http.StatusCreated, c)
+}
+
+// ListCapabilitiesHandler lists the capabilities the user issued, newest first
+func ListCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartyViewSession(w, r)
+	if sess == nil {
+		return
+	}
+
+	rows, err := DB.Query("SELECT "+capabilityColumns+" FROM capabilities WHERE user_id = $1 ORDER BY created_at DESC", sess.UserID)
+	if err != nil {
+		log.Printf("Database error listing capabilities: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	capabilities := []Capability{}
+	for rows.Next() {
+		c, err := scanCapability(rows.Scan)
+		if err != nil {
+			log.Printf("Database error listing capabilities: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		capabilities = append(capabilities, *c)
+	}
+	writeAdminJSON(w, http.StatusOK, capabilities)
+}
+
+// RevokeCapabilityHandler revokes one of the user's capabilities, along with every
+// attenuated copy of it
+func RevokeCapabilityHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Capability not found", http.StatusNotFound)
+		return
+	}
+
+	res, err := DB.Exec("UPDATE capabilities SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", id, sess.UserID)
+	if err != nil {
+		log.Printf("Database error revoking capability: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Capability not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("User %d revoked capability %s", sess.UserID, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AttenuateRequest adds caveats to a capability
+type AttenuateRequest struct {
+	Capability string   `json:"capability"`
+	Caveats    []string `json:"caveats"`
+}
+
+// AttenuateCapabilityHandler adds caveats to a capability for holders that would rather
+// not implement the signature chain. It uses no secret and grants nothing, so it needs no
+// authentication; holders can compute the same result offline.
+func AttenuateCapabilityHandler(w http.ResponseWriter, r *http.Request) {
+	var req AttenuateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if len(req.Caveats) == 0 {
+		http.Error(w, "At least one caveat is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := attenuateCapability(req.Capability, req.Caveats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"capability": token})
+}
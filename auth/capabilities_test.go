@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	proto "hydraauth/auth/pb/authpb"
+)
+
+// tamper decodes a capability, lets edit change it without re-signing and encodes it again
+func tamper(t *testing.T, token string, edit func(c *capabilityToken)) string {
+	t.Helper()
+	c, err := decodeCapability(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(c)
+	return c.encode()
+}
+
+func TestCapabilitySignatureChain(t *testing.T) {
+	issued := signCapability("cap-1", []string{"time < 2030-01-01T00:00:00Z", "action in documents:read,documents:list"}).encode()
+	attenuated, err := attenuateCapability(issued, []string{"resource = document:42", "audience = billing-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"as issued", issued, true},
+		{"attenuated by a holder", attenuated, true},
+		{"attenuated caveat removed", tamper(t, attenuated, func(c *capabilityToken) {
+			c.Caveats = c.Caveats[:len(c.Caveats)-1]
+		}), false},
+		{"issued caveat removed", tamper(t, attenuated, func(c *capabilityToken) {
+			c.Caveats = c.Caveats[1:]
+		}), false},
+		{"caveats reordered", tamper(t, attenuated, func(c *capabilityToken) {
+			c.Caveats[2], c.Caveats[3] = c.Caveats[3], c.Caveats[2]
+		}), false},
+		{"caveat widened", tamper(t, issued, func(c *capabilityToken) {
+			c.Caveats[1] = "action = *"
+		}), false},
+		{"another capability's ID", tamper(t, issued, func(c *capabilityToken) {
+			c.ID = "cap-2"
+		}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeCapability(tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.verifySignature(); got != tt.valid {
+				t.Fatalf("verifySignature() = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAttenuateCapabilityRejects(t *testing.T) {
+	issued := signCapability("cap-1", []string{"time < 2030-01-01T00:00:00Z"}).encode()
+
+	tooMany := make([]string, maxCapabilityCaveats)
+	for i := range tooMany {
+		tooMany[i] = "resource_type = document"
+	}
+	tests := []struct {
+		name    string
+		token   string
+		caveats []string
+	}{
+		{"unparseable caveat", issued, []string{"resource = document:42", "resource ~ document:*"}},
+		{"too many caveats", issued, tooMany},
+		{"not a capability", "hydra_cap_!!!", []string{"resource = document:42"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if token, err := attenuateCapability(tt.token, tt.caveats); err == nil {
+				t.Fatalf("attenuateCapability() = %q, want an error", token)
+			}
+		})
+	}
+}
+
+func TestParseCaveat(t *testing.T) {
+	tests := []struct {
+		caveat string
+		values []string // nil when the caveat must be rejected
+	}{
+		{"time < 2030-01-01T00:00:00Z", []string{"2030-01-01T00:00:00Z"}},
+		{"action = documents:read", []string{"documents:read"}},
+		{"resource in document:1, document:2,", []string{"document:1", "document:2"}},
+		{"resource_type = document", []string{"document"}},
+		{"audience in billing-service", []string{"billing-service"}},
+		{"client_ip in 10.0.0.0/8,192.168.0.0/16", []string{"10.0.0.0/8", "192.168.0.0/16"}},
+		{"time < tomorrow", nil},
+		{"time > 2030-01-01T00:00:00Z", nil},
+		{"client_ip = 10.0.0.1", nil},
+		{"action != documents:read", nil},
+		{"owner = 1", nil},
+		{"action =", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.caveat, func(t *testing.T) {
+			c, err := parseCaveat(tt.caveat)
+			if tt.values == nil {
+				if err == nil {
+					t.Fatalf("parseCaveat() = %+v, want an error", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(c.Values, " ") != strings.Join(tt.values, " ") {
+				t.Fatalf("Values = %q, want %q", c.Values, tt.values)
+			}
+		})
+	}
+}
+
+func TestCaveatSatisfiedBy(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	noAction := func(u *capabilityUse) { u.Action = "" }
+	noResource := func(u *capabilityUse) { u.Resource = nil }
+	noAudience := func(u *capabilityUse) { u.Audience = "" }
+	noClientIP := func(u *capabilityUse) { u.ClientIP = nil }
+
+	tests := []struct {
+		name   string
+		caveat string
+		edit   func(u *capabilityUse) // Removes part of the use, when set
+		want   bool
+	}{
+		{"before expiry", "time < 2026-01-01T12:00:01Z", nil, true},
+		{"at expiry", "time < 2026-01-01T12:00:00Z", nil, false},
+		{"action listed", "action in documents:write,documents:read", nil, true},
+		{"action pattern", "action = documents:*", nil, true},
+		{"other action", "action = documents:write", nil, false},
+		{"no action", "action = documents:*", noAction, false},
+		{"resource", "resource = document:42", nil, true},
+		{"other resource", "resource = document:43", nil, false},
+		{"no resource", "resource = document:42", noResource, false},
+		{"resource without an ID", "resource = document:", func(u *capabilityUse) { u.Resource.Id = "" }, false},
+		{"resource type", "resource_type in folder,document", nil, true},
+		{"other resource type", "resource_type = folder", nil, false},
+		{"no resource type", "resource_type = document", noResource, false},
+		{"audience", "audience = billing-service", nil, true},
+		{"other audience", "audience = search-service", nil, false},
+		{"no audience", "audience = billing-service", noAudience, false},
+		{"client IP in range", "client_ip in 192.168.0.0/16,10.0.0.0/8", nil, true},
+		{"client IP out of range", "client_ip = 192.168.0.0/16", nil, false},
+		{"no client IP", "client_ip = 0.0.0.0/0", noClientIP, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCaveat(tt.caveat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			use := &capabilityUse{
+				Action:   "documents:read",
+				Resource: &proto.Resource{Type: "document", Id: "42"},
+				Audience: "billing-service",
+				ClientIP: net.ParseIP("10.1.2.3"),
+				Time:     now,
+			}
+			if tt.edit != nil {
+				tt.edit(use)
+			}
+			if got := c.satisfiedBy(use); got != tt.want {
+				t.Fatalf("satisfiedBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- OAuth client authentication at the token endpoint ---
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+var errInvalidClient = errors.New("invalid client credentials")
+
+// authenticateClient identifies the caller of the token endpoint using
+// client_secret_basic, client_secret_post, private_key_jwt, tls_client_auth
+// or, for public clients, client_id alone.
+func authenticateClient(r *http.Request) (*OAuthClient, error) {
+	if r.PostForm.Get("client_assertion_type") == clientAssertionType {
+		return authenticateClientAssertion(r.PostForm.Get("client_assertion"))
+	}
+
+	clientID, secret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	if clientID == "" {
+		return nil, errInvalidClient
+	}
+
+	client, err := getOAuthClient(clientID)
+	if err == sql.ErrNoRows {
+		return nil, errInvalidClient
+	} else if err != nil {
+		return nil, err
+	}
+
+	switch client.TokenEndpointAuthMethod {
+	case "none":
+		if secret != "" {
+			return nil, errInvalidClient
+		}
+		return client, nil
+	case "client_secret_basic", "client_secret_post":
+		ok, err := verifyClientSecret(client.ClientID, secret)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errInvalidClient
+		}
+		return client, nil
+	case "tls_client_auth":
+		if err := authenticateTLSClient(r, client); err != nil {
+			return nil, err
+		}
+		return client, nil
+	default:
+		// private_key_jwt clients must present an assertion
+		return nil, errInvalidClient
+	}
+}
+
+// verifyClientSecret checks a secret against every unexpired secret of the client,
+// so the previous secret keeps working during a rotation's overlap window.
+func verifyClientSecret(clientID, secret string) (bool, error) {
+	if secret == "" {
+		return false, nil
+	}
+
+	rows, err := DB.Query(`SELECT secret_hash FROM oauth_client_secrets
+		WHERE client_id = $1 AND (expires_at IS NULL OR expires_at > NOW())`, clientID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return false, err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// authenticateClientAssertion verifies an RFC 7523 private_key_jwt assertion
+// against the client's registered JWKS, with jti replay protection in Redis.
+func authenticateClientAssertion(assertion string) (*OAuthClient, error) {
+	if assertion == "" {
+		return nil, errInvalidClient
+	}
+
+	// 1. Peek at the issuer to find which client's keys to verify with
+	unverified := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, unverified); err != nil {
+		return nil, errInvalidClient
+	}
+
+	client, err := getOAuthClient(unverified.Issuer)
+	if err == sql.ErrNoRows {
+		return nil, errInvalidClient
+	} else if err != nil {
+		return nil, err
+	}
+	if client.TokenEndpointAuthMethod != "private_key_jwt" {
+		return nil, errInvalidClient
+	}
+
+	// 2. Verify signature, expiry and audience
+	claims := &jwt.RegisteredClaims{}
+	_, err = jwt.ParseWithClaims(assertion, claims, clientKeyFunc(client),
+		jwt.WithValidMethods([]string{"RS256", "PS256", "ES256", "ES384"}),
+		jwt.WithExpirationRequired())
+	if err != nil {
+		log.Printf("Client assertion for %s rejected: %v", client.ClientID, err)
+		return nil, errInvalidClient
+	}
+
+	if claims.Issuer != client.ClientID || claims.Subject != client.ClientID || claims.ID == "" {
+		return nil, errInvalidClient
+	}
+	if !audienceIncludes(claims.Audience, issuerURL(), issuerURL()+"/oauth/token") {
+		return nil, errInvalidClient
+	}
+
+	// 3. Each assertion may only be used once until it expires
+	ttl := time.Until(claims.ExpiresAt.Time)
+	jtiKey := fmt.Sprintf("client_assertion_jti:%s:%s", client.ClientID, claims.ID)
+	fresh, err := RedisClient.SetNX(RedisClient.Context(), jtiKey, 1, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, errInvalidClient
+	}
+
+	return client, nil
+}
+
+// clientKeyFunc selects the verification key from the client's registered JWKS by kid
+func clientKeyFunc(client *OAuthClient) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if len(client.JWKS) == 0 {
+			return nil, fmt.Errorf("client %s has no registered keys", client.ClientID)
+		}
+
+		var set JWKSet
+		if err := json.Unmarshal(client.JWKS, &set); err != nil {
+			return nil, fmt.Errorf("client %s has malformed jwks: %w", client.ClientID, err)
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		jwk, ok := set.Find(kid)
+		if !ok {
+			return nil, fmt.Errorf("no key with kid %q", kid)
+		}
+		return jwk.PublicKey()
+	}
+}
+
+// audienceIncludes reports whether any of the accepted values appears in aud
+func audienceIncludes(aud jwt.ClaimStrings, accepted ...string) bool {
+	for _, a := range aud {
+		if containsString(accepted, a) {
+			return true
+		}
+	}
+	return false
+}
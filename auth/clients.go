@@ -0,0 +1,440 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- OAuth client records: validation, persistence and secret rotation ---
+
+var (
+	supportedGrantTypes  = []string{"authorization_code", "refresh_token", "client_credentials", deviceCodeGrantType, tokenExchangeGrantType}
+	supportedAuthMethods = []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "tls_client_auth", "none"}
+)
+
+const (
+	maxAccessTokenTTL  = 24 * time.Hour
+	maxRefreshTokenTTL = 90 * 24 * time.Hour
+)
+
+// ClientMetadata is the RFC 7591 client metadata document, plus the token lifetime
+// extensions used by the admin API. Credentials are only set in responses.
+type ClientMetadata struct {
+	ClientID                string          `json:"client_id,omitempty"`
+	ClientSecret            string          `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64           `json:"client_id_issued_at,omitempty"`
+	ClientSecretExpiresAt   *int64          `json:"client_secret_expires_at,omitempty"` // 0 means never, per RFC 7591
+	RegistrationAccessToken string          `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string          `json:"registration_client_uri,omitempty"`
+	ClientName              string          `json:"client_name"`
+	RedirectURIs            []string        `json:"redirect_uris"`
+	GrantTypes              []string        `json:"grant_types"`
+	TokenEndpointAuthMethod string          `json:"token_endpoint_auth_method"`
+	Scope                   string          `json:"scope"` // Space-delimited
+	JWKS                    json.RawMessage `json:"jwks,omitempty"`
+	TLSClientAuthSubjectDN  string          `json:"tls_client_auth_subject_dn,omitempty"`
+	AccessTokenTTL          int64           `json:"access_token_ttl,omitempty"` // Seconds
+	RefreshTokenTTL         int64           `json:"refresh_token_ttl,omitempty"`
+
+	PostLogoutRedirectURIs            []string `json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutURI              string   `json:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired  bool     `json:"backchannel_logout_session_required,omitempty"`
+	FrontchannelLogoutURI             string   `json:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool     `json:"frontchannel_logout_session_required,omitempty"`
+
+	FirstParty bool `json:"first_party,omitempty"` // Admin only: skip the consent screen
+
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+}
+
+// clientMetadataError carries an RFC 7591 section 3.2.2 error code
+type clientMetadataError struct {
+	Code        string // invalid_redirect_uri or invalid_client_metadata
+	Description string
+}
+
+func (e *clientMetadataError) Error() string { return e.Description }
+
+func invalidMetadata(format string, args ...interface{}) error {
+	return &clientMetadataError{Code: "invalid_client_metadata", Description: fmt.Sprintf(format, args...)}
+}
+
+// normalize fills in RFC 7591 defaults and rejects inconsistent metadata
+func (m *ClientMetadata) normalize() error {
+	// Credentials are assigned by the server, never taken from the request
+	m.ClientSecret, m.ClientSecretExpiresAt = "", nil
+	m.RegistrationAccessToken, m.RegistrationClientURI = "", ""
+
+	m.ClientName = strings.TrimSpace(m.ClientName)
+	if m.ClientName == "" {
+		return invalidMetadata("client_name is required")
+	}
+	if len(m.GrantTypes) == 0 {
+		m.GrantTypes = []string{"authorization_code", "refresh_token"}
+	}
+	if m.TokenEndpointAuthMethod == "" {
+		m.TokenEndpointAuthMethod = "client_secret_basic"
+	}
+
+	// 1. Grant types and authentication method
+	for _, g := range m.GrantTypes {
+		if !containsString(supportedGrantTypes, g) {
+			return invalidMetadata("unsupported grant_type %q", g)
+		}
+	}
+	if !containsString(supportedAuthMethods, m.TokenEndpointAuthMethod) {
+		return invalidMetadata("unsupported token_endpoint_auth_method %q", m.TokenEndpointAuthMethod)
+	}
+	if m.TokenEndpointAuthMethod == "none" &&
+		(containsString(m.GrantTypes, "client_credentials") || containsString(m.GrantTypes, tokenExchangeGrantType)) {
+		return invalidMetadata("public clients cannot use client_credentials or token exchange")
+	}
+	// Registered keys verify private_key_jwt assertions and signed request objects
+	if len(m.JWKS) > 0 {
+		var set JWKSet
+		if json.Unmarshal(m.JWKS, &set) != nil || len(set.Keys) == 0 {
+			return invalidMetadata("jwks must be a JWK Set with at least one key")
+		}
+	} else if m.TokenEndpointAuthMethod == "private_key_jwt" {
+		return invalidMetadata("private_key_jwt requires a jwks with at least one key")
+	}
+	if m.TokenEndpointAuthMethod == "tls_client_auth" {
+		if m.TLSClientAuthSubjectDN == "" {
+			return invalidMetadata("tls_client_auth requires tls_client_auth_subject_dn")
+		}
+	} else {
+		m.TLSClientAuthSubjectDN = ""
+	}
+
+	// 2. Redirect URIs are required for browser-based flows
+	if containsString(m.GrantTypes, "authorization_code") && len(m.RedirectURIs) == 0 {
+		return &clientMetadataError{Code: "invalid_redirect_uri", Description: "redirect_uris is required for authorization_code"}
+	}
+	for _, uri := range m.RedirectURIs {
+		if err := validateClientURI("redirect_uri", uri); err != nil {
+			return &clientMetadataError{Code: "invalid_redirect_uri", Description: err.Error()}
+		}
+	}
+	for _, uri := range m.PostLogoutRedirectURIs {
+		if err := validateClientURI("post_logout_redirect_uri", uri); err != nil {
+			return invalidMetadata("%v", err)
+		}
+	}
+	if m.BackchannelLogoutURI != "" {
+		if err := validateClientURI("backchannel_logout_uri", m.BackchannelLogoutURI); err != nil {
+			return invalidMetadata("%v", err)
+		}
+	}
+	if m.FrontchannelLogoutURI != "" {
+		if err := validateClientURI("frontchannel_logout_uri", m.FrontchannelLogoutURI); err != nil {
+			return invalidMetadata("%v", err)
+		}
+	}
+
+	// 3. Token lifetimes
+	if m.AccessTokenTTL < 0 || time.Duration(m.AccessTokenTTL)*time.Second > maxAccessTokenTTL {
+		return invalidMetadata("access_token_ttl must be at most %d seconds", int(maxAccessTokenTTL.Seconds()))
+	}
+	if m.RefreshTokenTTL < 0 || time.Duration(m.RefreshTokenTTL)*time.Second > maxRefreshTokenTTL {
+		return invalidMetadata("refresh_token_ttl must be at most %d seconds", int(maxRefreshTokenTTL.Seconds()))
+	}
+
+	// The array columns are NOT NULL, and pq stores a nil slice as NULL
+	if m.RedirectURIs == nil {
+		m.RedirectURIs = []string{}
+	}
+	if m.PostLogoutRedirectURIs == nil {
+		m.PostLogoutRedirectURIs = []string{}
+	}
+	m.Scope = strings.Join(strings.Fields(m.Scope), " ")
+	return nil
+}
+
+// validateClientURI requires an absolute URI without a fragment. Plain http is
+// only allowed for loopback addresses (RFC 8252 section 7.3).
+func validateClientURI(name, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("%s %q is not an absolute URI", name, raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("%s %q must not contain a fragment", name, raw)
+	}
+	if u.Scheme == "http" {
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+		default:
+			return fmt.Errorf("%s %q must use https", name, raw)
+		}
+	}
+	return nil
+}
+
+// usesClientSecret reports whether the auth method authenticates with a shared secret
+func usesClientSecret(authMethod string) bool {
+	return authMethod == "client_secret_basic" || authMethod == "client_secret_post"
+}
+
+// nullSeconds stores a zero lifetime as NULL so the service default applies
+func nullSeconds(seconds int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: seconds, Valid: seconds > 0}
+}
+
+// clientMetadataFor renders a stored client as RFC 7591 metadata (without credentials)
+func clientMetadataFor(c *OAuthClient) ClientMetadata {
+	m := ClientMetadata{
+		ClientID:                c.ClientID,
+		ClientIDIssuedAt:        c.CreatedAt.Unix(),
+		ClientName:              c.Name,
+		RedirectURIs:            c.RedirectURIs,
+		GrantTypes:              c.GrantTypes,
+		TokenEndpointAuthMethod: c.TokenEndpointAuthMethod,
+		Scope:                   strings.Join(c.Scopes, " "),
+		JWKS:                    c.JWKS,
+		TLSClientAuthSubjectDN:  c.TLSClientAuthSubjectDN.String,
+		AccessTokenTTL:          c.AccessTokenTTL.Int64,
+		RefreshTokenTTL:         c.RefreshTokenTTL.Int64,
+
+		PostLogoutRedirectURIs:            c.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:              c.BackchannelLogoutURI.String,
+		BackchannelLogoutSessionRequired:  c.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             c.FrontchannelLogoutURI.String,
+		FrontchannelLogoutSessionRequired: c.FrontchannelLogoutSessionRequired,
+		FirstParty:                        c.FirstParty,
+
+		RequirePushedAuthorizationRequests: c.RequirePushedAuthorizationRequests,
+	}
+	if usesClientSecret(c.TokenEndpointAuthMethod) {
+		never := int64(0)
+		m.ClientSecretExpiresAt = &never
+	}
+	return m
+}
+
+// createClient validates and stores a new client. The returned metadata carries the
+// plaintext client secret (for secret-based methods) and registration access token
+// (when withRegistrationToken is set); neither can be recovered later.
+func createClient(m ClientMetadata, withRegistrationToken bool) (ClientMetadata, error) {
+	if err := m.normalize(); err != nil {
+		return ClientMetadata{}, err
+	}
+	m.ClientID = uuid.New().String()
+
+	var registrationHash sql.NullString
+	if withRegistrationToken {
+		token, err := randomToken(32)
+		if err != nil {
+			return ClientMetadata{}, err
+		}
+		m.RegistrationAccessToken = token
+		m.RegistrationClientURI = issuerURL() + "/oauth/register/" + m.ClientID
+		registrationHash = sql.NullString{String: hashToken(token), Valid: true}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return ClientMetadata{}, err
+	}
+	defer tx.Rollback()
+
+	var createdAt time.Time
+	err = tx.QueryRow(`INSERT INTO oauth_clients (client_id, name, redirect_uris, scopes, grant_types,
+		token_endpoint_auth_method, jwks, tls_client_auth_subject_dn, access_token_ttl, refresh_token_ttl,
+		registration_access_token_hash, post_logout_redirect_uris, backchannel_logout_uri,
+		backchannel_logout_session_required, frontchannel_logout_uri, frontchannel_logout_session_required, first_party,
+		require_pushed_authorization_requests)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18) RETURNING created_at`,
+		m.ClientID, m.ClientName, pq.Array(m.RedirectURIs), pq.Array(strings.Fields(m.Scope)), pq.Array(m.GrantTypes),
+		m.TokenEndpointAuthMethod, nullJSON(m.JWKS), nullString(m.TLSClientAuthSubjectDN),
+		nullSeconds(m.AccessTokenTTL), nullSeconds(m.RefreshTokenTTL), registrationHash,
+		pq.Array(m.PostLogoutRedirectURIs), nullString(m.BackchannelLogoutURI), m.BackchannelLogoutSessionRequired,
+		nullString(m.FrontchannelLogoutURI), m.FrontchannelLogoutSessionRequired, m.FirstParty,
+		m.RequirePushedAuthorizationRequests).Scan(&createdAt)
+	if err != nil {
+		return ClientMetadata{}, err
+	}
+	m.ClientIDIssuedAt = createdAt.Unix()
+
+	if usesClientSecret(m.TokenEndpointAuthMethod) {
+		secret, err := addClientSecret(tx, m.ClientID)
+		if err != nil {
+			return ClientMetadata{}, err
+		}
+		never := int64(0)
+		m.ClientSecret = secret
+		m.ClientSecretExpiresAt = &never
+	}
+
+	return m, tx.Commit()
+}
+
+// updateClient replaces a client's metadata. If the client switches to a secret-based
+// auth method without holding a secret, a new one is issued and returned.
+func updateClient(clientID string, m ClientMetadata) (ClientMetadata, error) {
+	if err := m.normalize(); err != nil {
+		return ClientMetadata{}, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return ClientMetadata{}, err
+	}
+	defer tx.Rollback()
+
+	var createdAt time.Time
+	err = tx.QueryRow(`UPDATE oauth_clients SET name = $2, redirect_uris = $3, scopes = $4, grant_types = $5,
+		token_endpoint_auth_method = $6, jwks = $7, tls_client_auth_subject_dn = $8, access_token_ttl = $9,
+		refresh_token_ttl = $10, post_logout_redirect_uris = $11, backchannel_logout_uri = $12,
+		backchannel_logout_session_required = $13, frontchannel_logout_uri = $14,
+		frontchannel_logout_session_required = $15, first_party = $16, require_pushed_authorization_requests = $17,
+		updated_at = NOW()
+		WHERE client_id = $1 RETURNING created_at`,
+		clientID, m.ClientName, pq.Array(m.RedirectURIs), pq.Array(strings.Fields(m.Scope)), pq.Array(m.GrantTypes),
+		m.TokenEndpointAuthMethod, nullJSON(m.JWKS), nullString(m.TLSClientAuthSubjectDN),
+		nullSeconds(m.AccessTokenTTL), nullSeconds(m.RefreshTokenTTL),
+		pq.Array(m.PostLogoutRedirectURIs), nullString(m.BackchannelLogoutURI), m.BackchannelLogoutSessionRequired,
+		nullString(m.FrontchannelLogoutURI), m.FrontchannelLogoutSessionRequired, m.FirstParty,
+		m.RequirePushedAuthorizationRequests).Scan(&createdAt)
+	if err != nil {
+		return ClientMetadata{}, err
+	}
+	m.ClientID = clientID
+	m.ClientIDIssuedAt = createdAt.Unix()
+
+	if usesClientSecret(m.TokenEndpointAuthMethod) {
+		var active int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM oauth_client_secrets
+			WHERE client_id = $1 AND (expires_at IS NULL OR expires_at > NOW())`, clientID).Scan(&active)
+		if err != nil {
+			return ClientMetadata{}, err
+		}
+		if active == 0 {
+			if m.ClientSecret, err = addClientSecret(tx, clientID); err != nil {
+				return ClientMetadata{}, err
+			}
+		}
+		never := int64(0)
+		m.ClientSecretExpiresAt = &never
+	} else {
+		// Secrets of a client that no longer uses them must not keep working
+		if _, err := tx.Exec("DELETE FROM oauth_client_secrets WHERE client_id = $1", clientID); err != nil {
+			return ClientMetadata{}, err
+		}
+	}
+
+	return m, tx.Commit()
+}
+
+// deleteClient removes a client and, through the foreign key, its secrets.
+// Returns sql.ErrNoRows if the client does not exist.
+func deleteClient(clientID string) error {
+	res, err := DB.Exec("DELETE FROM oauth_clients WHERE client_id = $1", clientID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// listClients returns every registered client, oldest first
+func listClients() ([]OAuthClient, error) {
+	rows, err := DB.Query("SELECT " + oauthClientColumns + " FROM oauth_clients ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []OAuthClient
+	for rows.Next() {
+		var c OAuthClient
+		if err := rows.Scan(c.scanTargets()...); err != nil {
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+	return clients, rows.Err()
+}
+
+// rotateClientSecret issues a new secret for the client. Existing secrets stay valid
+// for the overlap window so deployments can roll over without downtime.
+func rotateClientSecret(clientID string, overlap time.Duration) (string, time.Time, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	// 1. Cap the remaining life of every current secret at now + overlap
+	var expiresAt time.Time
+	err = tx.QueryRow("SELECT NOW() + make_interval(secs => $1)", overlap.Seconds()).Scan(&expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	_, err = tx.Exec(`UPDATE oauth_client_secrets SET expires_at = $2
+		WHERE client_id = $1 AND (expires_at IS NULL OR expires_at > $2)`, clientID, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// 2. Issue the new current secret
+	secret, err := addClientSecret(tx, clientID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// 3. Drop secrets that expired long ago
+	if _, err := tx.Exec("DELETE FROM oauth_client_secrets WHERE client_id = $1 AND expires_at < NOW()", clientID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return secret, expiresAt, tx.Commit()
+}
+
+// addClientSecret generates a secret, stores its bcrypt hash and returns the plaintext
+func addClientSecret(tx *sql.Tx, clientID string) (string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("INSERT INTO oauth_client_secrets (client_id, secret_hash) VALUES ($1, $2)", clientID, string(hash))
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// hashToken is the SHA-256 hex digest used to store high-entropy bearer tokens.
+// bcrypt is reserved for secrets that are looked up by client ID first.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullJSON stores empty JSON documents as NULL
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
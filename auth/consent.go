@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// --- User consent for third-party OAuth clients ---
+
+// scopeDescriptions are shown on the consent screen; unknown scopes are shown by name
+var scopeDescriptions = map[string]string{
+	"openid":  "Sign you in with your account",
+	"profile": "See your name",
+	"email":   "See your email address",
+}
+
+// Consent is a user's standing approval of scopes for one client
+type Consent struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	GrantedAt  time.Time `json:"granted_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// hasConsent reports whether the user already approved every scope in scope for the client
+func hasConsent(userID int, clientID, scope string) (bool, error) {
+	var granted []string
+	err := DB.QueryRow("SELECT scopes FROM oauth_consents WHERE user_id = $1 AND client_id = $2", userID, clientID).
+		Scan(pq.Array(&granted))
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	for _, s := range strings.Fields(scope) {
+		if !containsString(granted, s) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// saveConsent adds the scopes to the user's consent for the client
+func saveConsent(userID int, clientID, scope string) error {
+	_, err := DB.Exec(`INSERT INTO oauth_consents (user_id, client_id, scopes) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes)), updated_at = NOW()`,
+		userID, clientID, pq.Array(strings.Fields(scope)))
+	return err
+}
+
+// listConsents returns the clients a user has approved, most recent first
+func listConsents(userID int) ([]Consent, error) {
+	rows, err := DB.Query(`SELECT c.client_id, oc.name, c.scopes, c.created_at, c.updated_at
+		FROM oauth_consents c JOIN oauth_clients oc ON oc.client_id = c.client_id
+		WHERE c.user_id = $1 ORDER BY c.updated_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := []Consent{}
+	for rows.Next() {
+		var c Consent
+		if err := rows.Scan(&c.ClientID, &c.ClientName, pq.Array(&c.Scopes), &c.GrantedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		consents = append(consents, c)
+	}
+	return consents, rows.Err()
+}
+
+// revokeUserClientSessions ends every session the user has with the client, which
+// invalidates its refresh tokens and (through the parent check) exchanged tokens. The
+// client is sent a back-channel logout token for each browser session that ended.
+func revokeUserClientSessions(ctx context.Context, userID int, clientID string) error {
+	client, err := getOAuthClient(clientID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	sessionIDs, err := RedisClient.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	notified := map[string]bool{}
+	for _, sessionID := range sessionIDs {
+		sess, err := loadSession(ctx, sessionID)
+		if err == ErrSessionNotFound {
+			RedisClient.SRem(ctx, userSessionsKey(userID), sessionID)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if sess.ClientID != clientID {
+			continue
+		}
+		if err := deleteSession(ctx, sessionID, sess); err != nil {
+			return err
+		}
+
+		if client == nil || notified[sess.SID] {
+			continue
+		}
+		notified[sess.SID] = true
+		if err := notifySessionRevoked(ctx, client, sess); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consentCSRFToken binds a consent form to the browser session and the exact request it approves
+func consentCSRFToken(sso *SSOSession, clientID, scope string) string {
+	mac := hmac.New(sha256.New, []byte(SecretKey))
+	mac.Write([]byte(sso.ID + "\x00" + clientID + "\x00" + scope))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+var consentFormTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Authorize {{.ClientName}}</title></head>
+<body>
+  <h1>{{.ClientName}} wants to access your account</h1>
+  {{if .Scopes}}<p>This will allow {{.ClientName}} to:</p>
+  <ul>
+    {{range .Scopes}}<li>{{.}}</li>
+    {{end}}</ul>{{end}}
+  <form method="POST" action="/oauth/authorize">
+    {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+    {{end}}<input type="hidden" name="consent_csrf" value="{{.CSRF}}">
+    <button type="submit" name="consent" value="allow">Allow</button>
+    <button type="submit" name="consent" value="deny">Deny</button>
+  </form>
+</body>
+</html>`))
+
+// renderConsentForm asks the user to approve the requested scopes for the client;
+// the named request params are posted back to /oauth/authorize
+func renderConsentForm(w http.ResponseWriter, r *http.Request, client *OAuthClient, sso *SSOSession, scope string, carry []string) {
+	params := map[string]string{}
+	for _, name := range carry {
+		if v := r.Form.Get(name); v != "" {
+			params[name] = v
+		}
+	}
+
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if desc, ok := scopeDescriptions[s]; ok {
+			scopes = append(scopes, desc)
+		} else {
+			scopes = append(scopes, s)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	data := map[string]interface{}{
+		"ClientName": client.Name,
+		"Scopes":     scopes,
+		"Params":     params,
+		"CSRF":       consentCSRFToken(sso, client.ClientID, scope),
+	}
+	if err := consentFormTemplate.Execute(w, data); err != nil {
+		log.Printf("Error rendering consent form: %v", err)
+	}
+}
+
+// isConsentPost reports whether the request is a submission of the consent form
+// made from this browser session for this exact client and scope.
+func isConsentPost(r *http.Request, sso *SSOSession, clientID, scope string) bool {
+	if r.Method != http.MethodPost || r.PostForm.Get("consent") == "" {
+		return false
+	}
+	expected := consentCSRFToken(sso, clientID, scope)
+	return hmac.Equal([]byte(r.PostForm.Get("consent_csrf")), []byte(expected))
+}
+
+// --- Account API: apps the user has granted access to ---
+
+// requireFirstPartySession authenticates the access token and only accepts user sessions
+// from /auth/login or first-party clients, so third-party apps cannot act on the account.
+// Admins impersonating the user are refused as well.
+func requireFirstPartySession(w http.ResponseWriter, r *http.Request) *Session {
+	return firstPartySession(w, r, false)
+}
+
+// requireFirstPartyViewSession is requireFirstPartySession for read-only account pages,
+// which an admin impersonating the user may also see
+func requireFirstPartyViewSession(w http.ResponseWriter, r *http.Request) *Session {
+	return firstPartySession(w, r, true)
+}
+
+func firstPartySession(w http.ResponseWriter, r *http.Request, allowImpersonation bool) *Session {
+	_, sess := authenticateAccessToken(w, r, "account")
+	if sess == nil {
+		return nil
+	}
+	if sess.ImpersonatorID != 0 && !allowImpersonation {
+		http.Error(w, "Not allowed while impersonating a user", http.StatusForbidden)
+		return nil
+	}
+	if sess.principalType() != PrincipalUser || (sess.Actor != nil && sess.ImpersonatorID == 0) || sess.ParentSessionID != "" {
+		http.Error(w, "Only user tokens are accepted here", http.StatusForbidden)
+		return nil
+	}
+
+	if sess.ClientID != "" {
+		client, err := getOAuthClient(sess.ClientID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Database error loading OAuth client: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return nil
+		}
+		if err == sql.ErrNoRows || !client.FirstParty {
+			http.Error(w, "Only first-party tokens are accepted here", http.StatusForbidden)
+			return nil
+		}
+	}
+	return sess
+}
+
+// ListGrantedAppsHandler lists the third-party clients the user has consented to
+func ListGrantedAppsHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartyViewSession(w, r)
+	if sess == nil {
+		return
+	}
+
+	consents, err := listConsents(sess.UserID)
+	if err != nil {
+		log.Printf("Database error listing consents: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(consents)
+}
+
+// RevokeGrantedAppHandler withdraws consent from a client and revokes its sessions for the user
+func RevokeGrantedAppHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+	clientID := r.PathValue("client_id")
+
+	res, err := DB.Exec("DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2", sess.UserID, clientID)
+	if err != nil {
+		log.Printf("Database error revoking consent: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "No access granted to this app", http.StatusNotFound)
+		return
+	}
+
+	if err := revokeUserClientSessions(r.Context(), sess.UserID, clientID); err != nil {
+		log.Printf("Redis error revoking sessions of client %s: %v", clientID, err)
+		http.Error(w, "Server error revoking sessions", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d revoked access for client %s", sess.UserID, clientID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// --- OAuth 2.0 Device Authorization Grant (RFC 8628) ---
+
+const (
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	deviceCodeTTL       = 10 * time.Minute
+	devicePollInterval  = 5 // Seconds clients must wait between token requests
+
+	// userCodeAlphabet avoids vowels and look-alike characters (RFC 8628 section 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+// Device authorization states
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+)
+
+// DeviceAuthorization is the pending grant stored in Redis while the user approves it
+// Key: device_code:{DeviceCode}, indexed by device_user_code:{UserCode}
+type DeviceAuthorization struct {
+	ClientID   string   `json:"client_id"`
+	Scope      string   `json:"scope"`
+	UserCode   string   `json:"user_code"`
+	Status     string   `json:"status"`
+	UserID     int      `json:"user_id,omitempty"`
+	AuthTime   int64    `json:"auth_time,omitempty"`
+	AMR        []string `json:"amr,omitempty"`
+	Interval   int      `json:"interval"`
+	LastPolled int64    `json:"last_polled,omitempty"`
+	ExpiresAt  int64    `json:"expires_at"`
+}
+
+// DeviceAuthorizationResponse is the RFC 8628 section 3.2 response
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+func deviceCodeKey(deviceCode string) string {
+	return fmt.Sprintf("device_code:%s", deviceCode)
+}
+
+func deviceUserCodeKey(userCode string) string {
+	return fmt.Sprintf("device_user_code:%s", userCode)
+}
+
+// DeviceAuthorizationHandler issues a device_code/user_code pair to a client
+func DeviceAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	// 1. Authenticate the client (public CLI clients send only client_id)
+	client, err := authenticateClient(r)
+	if err == errInvalidClient {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	} else if err != nil {
+		log.Printf("Database error authenticating client: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if !client.AllowsGrant(deviceCodeGrantType) {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Client is not allowed to use the device authorization grant")
+		return
+	}
+
+	scope, ok := resolveScope(r.PostForm.Get("scope"), client.Scopes)
+	if !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for this client")
+		return
+	}
+
+	// 2. Generate the codes
+	deviceCode, err := randomToken(32)
+	if err != nil {
+		log.Printf("Failed to generate device code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		log.Printf("Failed to generate user code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// 3. Store the pending authorization and its user_code index
+	auth := DeviceAuthorization{
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		UserCode:  userCode,
+		Status:    deviceStatusPending,
+		Interval:  devicePollInterval,
+		ExpiresAt: time.Now().Add(deviceCodeTTL).Unix(),
+	}
+	if err := saveDeviceAuthorization(r, deviceCode, &auth); err != nil {
+		log.Printf("Failed to store device authorization: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if err := RedisClient.Set(r.Context(), deviceUserCodeKey(userCode), deviceCode, deviceCodeTTL).Err(); err != nil {
+		log.Printf("Failed to store device user code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	verificationURI := issuerURL() + "/oauth/device"
+	writeOAuthJSON(w, http.StatusOK, DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                devicePollInterval,
+	})
+}
+
+// handleDeviceCodeGrant answers a client polling /oauth/token with its device_code
+func handleDeviceCodeGrant(w http.ResponseWriter, r *http.Request, client *OAuthClient, cnf *Confirmation) {
+	ctx := r.Context()
+	deviceCode := r.PostForm.Get("device_code")
+
+	auth, err := loadDeviceAuthorization(r, deviceCode)
+	if err == redis.Nil {
+		writeOAuthError(w, http.StatusBadRequest, "expired_token", "The device code has expired")
+		return
+	} else if err != nil {
+		log.Printf("Redis error loading device authorization: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if auth.ClientID != client.ClientID {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Device code was not issued to this client")
+		return
+	}
+
+	// 1. Enforce the polling interval; each violation slows the client down further
+	now := time.Now().Unix()
+	if auth.LastPolled != 0 && now-auth.LastPolled < int64(auth.Interval) {
+		auth.Interval += 5
+		auth.LastPolled = now
+		saveDeviceAuthorization(r, deviceCode, auth)
+		writeOAuthError(w, http.StatusBadRequest, "slow_down", fmt.Sprintf("Poll at most every %d seconds", auth.Interval))
+		return
+	}
+	auth.LastPolled = now
+
+	// 2. Report the user's decision
+	switch auth.Status {
+	case deviceStatusPending:
+		saveDeviceAuthorization(r, deviceCode, auth)
+		writeOAuthError(w, http.StatusBadRequest, "authorization_pending", "")
+		return
+	case deviceStatusDenied:
+		RedisClient.Del(ctx, deviceCodeKey(deviceCode))
+		writeOAuthError(w, http.StatusBadRequest, "access_denied", "The user denied the request")
+		return
+	}
+
+	// 3. Approved: the device code is single-use
+	if n, err := RedisClient.Del(ctx, deviceCodeKey(deviceCode)).Result(); err != nil || n == 0 {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Device code was already used")
+		return
+	}
+
+	sess := Session{UserID: auth.UserID, ClientID: client.ClientID, Scope: auth.Scope, AuthTime: auth.AuthTime,
+		LoginMethod: LoginMethodDevice, AMR: auth.AMR, Cnf: cnf}
+	tokens, err := issueSessionTokens(sess)
+	var policyErr *TenantPolicyError
+	if err == errNotOrgMember {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "User is no longer a member of the organization")
+		return
+	} else if errors.As(err, &policyErr) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", policyErr.Reason)
+		return
+	} else if err != nil {
+		log.Printf("Error generating tokens: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	resp := newTokenResponse(tokens, sess)
+	if hasScope(auth.Scope, "openid") {
+		resp.IDToken, err = generateIDToken(sess, "", tokens.AccessToken)
+		if err != nil {
+			log.Printf("Error generating ID token: %v", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	writeOAuthJSON(w, http.StatusOK, resp)
+}
+
+var deviceVerifyTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Connect a device</title></head>
+<body>
+  <h1>Connect a device</h1>
+  {{if .Message}}<p>{{.Message}}</p>{{end}}
+  {{if .Client}}
+  <p><strong>{{.Client}}</strong> is requesting access to your account{{if .Scope}} with scopes <code>{{.Scope}}</code>{{end}}.</p>
+  <p>Only continue if the code <strong>{{.UserCode}}</strong> is shown on your device.</p>
+  <form method="POST" action="/oauth/device">
+    <input type="hidden" name="user_code" value="{{.UserCode}}">
+    <button type="submit" name="action" value="approve">Allow</button>
+    <button type="submit" name="action" value="deny">Deny</button>
+  </form>
+  {{else}}
+  <form method="GET" action="/oauth/device">
+    <label>Code shown on your device <input type="text" name="user_code" autocomplete="off" required></label>
+    <button type="submit">Continue</button>
+  </form>
+  {{end}}
+</body>
+</html>`))
+
+// DeviceVerificationHandler is the page where a logged-in user enters and approves a user_code
+func DeviceVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// 1. The user must be logged in to this browser
+	sso, loggedIn := currentSSOSession(r)
+	if isLoginPost(r) {
+		if sso = handleLoginPost(w, r, "/oauth/device", []string{"user_code"}); sso == nil {
+			return
+		}
+	} else if !loggedIn {
+		renderLoginForm(w, r, "/oauth/device", []string{"user_code"}, "")
+		return
+	}
+
+	userCode := normalizeUserCode(r.Form.Get("user_code"))
+	if userCode == "" {
+		renderDeviceVerify(w, http.StatusOK, map[string]interface{}{})
+		return
+	}
+
+	// 2. Find the pending authorization for the code
+	deviceCode, err := RedisClient.Get(r.Context(), deviceUserCodeKey(userCode)).Result()
+	var auth *DeviceAuthorization
+	if err == nil {
+		auth, err = loadDeviceAuthorization(r, deviceCode)
+	}
+	if err == redis.Nil || (err == nil && auth.Status != deviceStatusPending) {
+		renderDeviceVerify(w, http.StatusNotFound, map[string]interface{}{"Message": "That code is invalid or has expired."})
+		return
+	} else if err != nil {
+		log.Printf("Redis error loading device authorization: %v", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	client, err := getOAuthClient(auth.ClientID)
+	if err != nil {
+		log.Printf("Database error loading OAuth client: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// 3. Show the confirmation, or record the decision
+	action := r.PostForm.Get("action")
+	if r.Method != http.MethodPost || action == "" {
+		renderDeviceVerify(w, http.StatusOK, map[string]interface{}{"Client": client.Name, "Scope": auth.Scope, "UserCode": userCode})
+		return
+	}
+
+	message := "Access denied. You can close this window."
+	if action == "approve" {
+		auth.Status = deviceStatusApproved
+		auth.UserID = sso.UserID
+		auth.AuthTime = sso.AuthTime
+		auth.AMR = sso.AMR
+		message = "Device connected. You can return to your device."
+	} else {
+		auth.Status = deviceStatusDenied
+	}
+
+	if err := saveDeviceAuthorization(r, deviceCode, auth); err != nil {
+		log.Printf("Failed to update device authorization: %v", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	RedisClient.Del(r.Context(), deviceUserCodeKey(userCode))
+
+	renderDeviceVerify(w, http.StatusOK, map[string]interface{}{"Message": message})
+}
+
+func renderDeviceVerify(w http.ResponseWriter, status int, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := deviceVerifyTemplate.Execute(w, data); err != nil {
+		log.Printf("Error rendering device page: %v", err)
+	}
+}
+
+func loadDeviceAuthorization(r *http.Request, deviceCode string) (*DeviceAuthorization, error) {
+	data, err := RedisClient.Get(r.Context(), deviceCodeKey(deviceCode)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var auth DeviceAuthorization
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return nil, fmt.Errorf("corrupt device authorization: %w", err)
+	}
+	return &auth, nil
+}
+
+// saveDeviceAuthorization writes the grant back, keeping its original expiry
+func saveDeviceAuthorization(r *http.Request, deviceCode string, auth *DeviceAuthorization) error {
+	ttl := time.Until(time.Unix(auth.ExpiresAt, 0))
+	if ttl <= 0 {
+		return nil
+	}
+	data, _ := json.Marshal(auth)
+	return RedisClient.Set(r.Context(), deviceCodeKey(deviceCode), data, ttl).Err()
+}
+
+// generateUserCode returns an 8 character code formatted as XXXX-XXXX
+func generateUserCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeUserCode accepts user input case-insensitively and with or without the dash
+func normalizeUserCode(input string) string {
+	code := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(input))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- DPoP: Demonstrating Proof of Possession (RFC 9449) ---
+
+const (
+	dpopProofWindow = 60 * time.Second // Accepted clock skew for a proof's iat
+	dpopJTITTL      = 2 * dpopProofWindow
+)
+
+var dpopAlgorithms = []string{"RS256", "PS256", "ES256", "ES384"}
+
+// DPoPProofClaims defines the payload of a DPoP proof JWT
+type DPoPProofClaims struct {
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"` // Hash of the access token, required when presenting one
+	jwt.RegisteredClaims
+}
+
+var errInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+// verifyDPoPProof checks a DPoP proof for the given request and returns the JWK
+// thumbprint of the key that signed it. accessToken is empty at the token endpoint.
+func verifyDPoPProof(ctx context.Context, proof, method, requestURL, accessToken string) (string, error) {
+	if proof == "" {
+		return "", fmt.Errorf("%w: missing DPoP header", errInvalidDPoPProof)
+	}
+
+	// 1. Verify the signature with the public key embedded in the header
+	var jwk JWK
+	claims := &DPoPProofClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("typ must be dpop+jwt")
+		}
+		raw, err := json.Marshal(token.Header["jwk"])
+		if err != nil || json.Unmarshal(raw, &jwk) != nil || jwk.Kty == "" {
+			return nil, fmt.Errorf("missing or malformed jwk header")
+		}
+		return jwk.PublicKey()
+	}, jwt.WithValidMethods(dpopAlgorithms))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidDPoPProof, err)
+	}
+
+	// 2. The proof must be fresh and made for this exact request
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return "", fmt.Errorf("%w: jti and iat are required", errInvalidDPoPProof)
+	}
+	if skew := time.Since(claims.IssuedAt.Time); skew > dpopProofWindow || skew < -dpopProofWindow {
+		return "", fmt.Errorf("%w: iat is outside the accepted window", errInvalidDPoPProof)
+	}
+	if !strings.EqualFold(claims.HTM, method) {
+		return "", fmt.Errorf("%w: htm does not match the request method", errInvalidDPoPProof)
+	}
+	if normalizeHTU(claims.HTU) != normalizeHTU(requestURL) {
+		return "", fmt.Errorf("%w: htu does not match the request URL", errInvalidDPoPProof)
+	}
+	if accessToken != "" && claims.ATH != accessTokenSHA256(accessToken) {
+		return "", fmt.Errorf("%w: ath does not match the access token", errInvalidDPoPProof)
+	}
+
+	// 3. Each proof may be used once
+	jkt := jwk.Thumbprint()
+	fresh, err := RedisClient.SetNX(ctx, fmt.Sprintf("dpop_jti:%s:%s", jkt, claims.ID), 1, dpopJTITTL).Result()
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", fmt.Errorf("%w: proof was already used", errInvalidDPoPProof)
+	}
+
+	return jkt, nil
+}
+
+// requestURL is the public URL of the current request, as a client would have signed it
+func requestURL(r *http.Request) string {
+	return issuerURL() + r.URL.Path
+}
+
+// normalizeHTU drops the query and fragment and lowercases scheme and host (RFC 9449 section 4.3)
+func normalizeHTU(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// accessTokenSHA256 is the base64url SHA-256 of an access token (the DPoP ath claim)
+func accessTokenSHA256(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// --- Just-in-time role elevation ---
+//
+// Roles with an elevation policy can be requested for a limited time. A request either
+// takes effect at once or waits for an admin to approve it. While active, the role counts
+// like any assignment in userAuthorization. Sessions remember which elevations their tokens
+// carry, so a token stops validating as soon as one of them expires or is revoked.
+
+// Elevation statuses
+const (
+	ElevationPending   = "pending"
+	ElevationActive    = "active"
+	ElevationDenied    = "denied"
+	ElevationExpired   = "expired"
+	ElevationRevoked   = "revoked"
+	ElevationCancelled = "cancelled"
+)
+
+const (
+	elevationPendingTTL    = 24 * time.Hour // Unanswered requests expire
+	elevationSweepInterval = time.Minute
+	minElevationDuration   = 60 // Seconds
+	maxElevationDuration   = 7 * 24 * 60 * 60
+)
+
+// errElevationEnded is returned for tokens carrying a temporary role that has since ended
+var errElevationEnded = errors.New("a temporary role carried by the token has ended; refresh it")
+
+// elevationEndedKey marks a revoked elevation until its original expiry, so sessions
+// carrying it are rejected before their tokens would otherwise expire.
+// Key: elevation_ended:{ID}
+func elevationEndedKey(id string) string {
+	return fmt.Sprintf("elevation_ended:%s", id)
+}
+
+// ElevationPolicy makes a role requestable
+type ElevationPolicy struct {
+	MaxDuration      int  `json:"max_duration"` // Seconds
+	RequiresApproval bool `json:"requires_approval"`
+}
+
+// RoleElevation is one request for a temporary role
+type RoleElevation struct {
+	ID          string           `json:"id"`
+	UserID      int              `json:"user_id"`
+	Role        string           `json:"role"`
+	Reason      string           `json:"reason"`
+	Duration    int              `json:"duration"` // Seconds, counted from activation
+	Status      string           `json:"status"`
+	RequestedAt time.Time        `json:"requested_at"`
+	DecidedBy   int              `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time       `json:"decided_at,omitempty"`
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty"`
+	EndedAt     *time.Time       `json:"ended_at,omitempty"`
+	Events      []ElevationEvent `json:"events,omitempty"`
+}
+
+// ElevationEvent is one entry of an elevation's audit trail
+type ElevationEvent struct {
+	Event     string    `json:"event"`
+	Actor     string    `json:"actor"` // user:{id}, admin_token or system
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const roleElevationColumns = "id, user_id, role, reason, duration, status, requested_at, decided_by, decided_at, expires_at, ended_at"
+
+func scanRoleElevation(scan func(dest ...interface{}) error) (*RoleElevation, error) {
+	var e RoleElevation
+	var decidedBy sql.NullInt64
+	var decidedAt, expiresAt, endedAt sql.NullTime
+	err := scan(&e.ID, &e.UserID, &e.Role, &e.Reason, &e.Duration, &e.Status, &e.RequestedAt,
+		&decidedBy, &decidedAt, &expiresAt, &endedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.DecidedBy = int(decidedBy.Int64)
+	e.DecidedAt, e.ExpiresAt, e.EndedAt = nullTimePtr(decidedAt), nullTimePtr(expiresAt), nullTimePtr(endedAt)
+	return &e, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// getRoleElevation loads one elevation; returns sql.ErrNoRows if it does not exist
+func getRoleElevation(id string) (*RoleElevation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, sql.ErrNoRows
+	}
+	return scanRoleElevation(DB.QueryRow("SELECT "+roleElevationColumns+" FROM role_elevations WHERE id = $1", id).Scan)
+}
+
+// listRoleElevations returns the elevations matching where, newest first
+func listRoleElevations(where string, args ...interface{}) ([]RoleElevation, error) {
+	rows, err := DB.Query("SELECT "+roleElevationColumns+" FROM role_elevations WHERE "+where+" ORDER BY requested_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	elevations := []RoleElevation{}
+	for rows.Next() {
+		e, err := scanRoleElevation(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		elevations = append(elevations, *e)
+	}
+	return elevations, rows.Err()
+}
+
+// listElevationEvents returns an elevation's audit trail, oldest first
+func listElevationEvents(id string) ([]ElevationEvent, error) {
+	rows, err := DB.Query(`SELECT event, actor, detail, created_at FROM role_elevation_events
+		WHERE elevation_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ElevationEvent{}
+	for rows.Next() {
+		var ev ElevationEvent
+		if err := rows.Scan(&ev.Event, &ev.Actor, &ev.Detail, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// updateElevation applies one state change together with its audit event. set is the SQL
+// SET clause, with its own arguments from $3. Returns sql.ErrNoRows if the elevation is
+// not in status from.
+func updateElevation(id, from, set, event, actor, detail string, args ...interface{}) (*RoleElevation, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	e, err := scanRoleElevation(tx.QueryRow("UPDATE role_elevations SET "+set+" WHERE id = $1 AND status = $2 RETURNING "+roleElevationColumns,
+		append([]interface{}{id, from}, args...)...).Scan)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("INSERT INTO role_elevation_events (elevation_id, event, actor, detail) VALUES ($1, $2, $3, $4)",
+		id, event, actor, detail); err != nil {
+		return nil, err
+	}
+	return e, tx.Commit()
+}
+
+// markElevationEnded rejects sessions carrying an elevation that ended before its expiry
+func markElevationEnded(ctx context.Context, e *RoleElevation) {
+	if e.ExpiresAt == nil {
+		return
+	}
+	ttl := time.Until(*e.ExpiresAt)
+	if ttl <= 0 {
+		return
+	}
+	if err := RedisClient.Set(ctx, elevationEndedKey(e.ID), 1, ttl).Err(); err != nil {
+		log.Printf("Redis error marking elevation %s ended: %v", e.ID, err)
+	}
+}
+
+// --- Sessions ---
+
+// activeElevations returns the IDs of the user's active elevations and the Unix time the
+// first of them expires, 0 if there are none
+func activeElevations(q rowQuerier, userID int) ([]string, int64, error) {
+	var ids []string
+	var until int64
+	err := q.QueryRow(`SELECT COALESCE(ARRAY_AGG(id::text), '{}'), COALESCE(EXTRACT(EPOCH FROM MIN(expires_at))::bigint, 0)
+		FROM role_elevations WHERE user_id = $1 AND status = 'active' AND expires_at > NOW()`, userID).
+		Scan(pq.Array(&ids), &until)
+	return ids, until, err
+}
+
+// loadSessionAuthorization sets the session's roles and permissions for its organization,
+// along with the elevations they include. Both are read from one snapshot so an elevated
+// role is never carried without its expiry.
+func loadSessionAuthorization(sess *Session) error {
+	tx, err := DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to load roles: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids, until, err := activeElevations(tx, sess.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load elevations: %w", err)
+	}
+	roles, permissions, err := queryUserAuthorization(tx, sess.UserID, sess.OrgID)
+	if err == errNotOrgMember {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to load roles: %w", err)
+	}
+	sess.Roles, sess.Permissions = roles, permissions
+	sess.Elevations, sess.ElevatedUntil = ids, until
+	return nil
+}
+
+// elevationAccessTTL shortens an access token lifetime so it ends with the session's first elevation
+func elevationAccessTTL(sess *Session, ttl time.Duration) time.Duration {
+	if sess.ElevatedUntil == 0 {
+		return ttl
+	}
+	if remaining := time.Until(time.Unix(sess.ElevatedUntil, 0)); remaining < ttl {
+		return remaining
+	}
+	return ttl
+}
+
+// checkElevations returns errElevationEnded if an elevation carried by the session has
+// expired or been revoked. The session's next refresh drops the role.
+func checkElevations(ctx context.Context, sess *Session) error {
+	if sess.ElevatedUntil != 0 && time.Now().Unix() >= sess.ElevatedUntil {
+		return errElevationEnded
+	}
+	if len(sess.Elevations) == 0 {
+		return nil
+	}
+	keys := make([]string, len(sess.Elevations))
+	for i, id := range sess.Elevations {
+		keys[i] = elevationEndedKey(id)
+	}
+	n, err := RedisClient.Exists(ctx, keys...).Result()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errElevationEnded
+	}
+	return nil
+}
+
+// sweepElevations expires active elevations past their end and requests left unanswered.
+// Authorization never depends on it; it keeps statuses and the audit trail current.
+func sweepElevations() error {
+	res, err := DB.Exec(`WITH ended AS (
+			UPDATE role_elevations SET status = 'expired', ended_at = NOW()
+			WHERE (status = 'active' AND expires_at <= NOW())
+				OR (status = 'pending' AND requested_at <= NOW() - $1 * INTERVAL '1 second')
+			RETURNING id)
+		INSERT INTO role_elevation_events (elevation_id, event, actor)
+		SELECT id, 'expired', 'system' FROM ended`, int(elevationPendingTTL.Seconds()))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Expired %d role elevations", n)
+	}
+	return nil
+}
+
+// runElevationSweeper calls sweepElevations periodically; it never returns
+func runElevationSweeper() {
+	ticker := time.NewTicker(elevationSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := sweepElevations(); err != nil {
+			log.Printf("Database error expiring role elevations: %v", err)
+		}
+	}
+}
+
+// --- Account API: requesting elevations ---
+
+// ElevationRequest asks for a role for Duration seconds; 0 means the role's maximum
+type ElevationRequest struct {
+	Role     string `json:"role"`
+	Duration int    `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// RequestElevationHandler creates an elevation request, active at once when the role's
+// policy does not require approval
+func RequestElevationHandler(w http.ResponseWriter, r *http.Request) {
+	var req ElevationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+
+	// 1. The role must be requestable, for no longer than its policy allows
+	var roleID int
+	var policy ElevationPolicy
+	var held bool
+	err := DB.QueryRow(`SELECT r.id, p.max_duration, p.requires_approval,
+			EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id = $2 AND ur.role_id = r.id)
+		FROM roles r JOIN role_elevation_policies p ON p.role_id = r.id WHERE r.name = $1`, req.Role, sess.UserID).
+		Scan(&roleID, &policy.MaxDuration, &policy.RequiresApproval, &held)
+	if err == sql.ErrNoRows {
+		http.Error(w, "This role cannot be requested", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading elevation policy: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if held {
+		http.Error(w, "You already hold this role", http.StatusConflict)
+		return
+	}
+	if req.Duration == 0 {
+		req.Duration = policy.MaxDuration
+	}
+	if req.Duration < minElevationDuration || req.Duration > policy.MaxDuration {
+		http.Error(w, fmt.Sprintf("duration must be between %d and %d seconds", minElevationDuration, policy.MaxDuration), http.StatusBadRequest)
+		return
+	}
+
+	// 2. Finish elevations that already ended so they do not count as open
+	if err := sweepElevations(); err != nil {
+		log.Printf("Database error expiring role elevations: %v", err)
+	}
+
+	// 3. Store the request and its audit trail together
+	tx, err := DB.Begin()
+	if err != nil {
+		log.Printf("Database error requesting elevation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	status := ElevationActive
+	if policy.RequiresApproval {
+		status = ElevationPending
+	}
+	actor := "user:" + strconv.Itoa(sess.UserID)
+	e, err := insertRoleElevation(tx, sess.UserID, roleID, req.Role, req.Reason, req.Duration, status)
+	if err == nil {
+		_, err = tx.Exec("INSERT INTO role_elevation_events (elevation_id, event, actor, detail) VALUES ($1, 'requested', $2, $3)", e.ID, actor, req.Reason)
+	}
+	if err == nil && status == ElevationActive {
+		_, err = tx.Exec("INSERT INTO role_elevation_events (elevation_id, event, actor) VALUES ($1, 'activated', 'system')", e.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if isUniqueViolation(err) {
+		http.Error(w, "An elevation to this role is already pending or active", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Database error requesting elevation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d requested role %s for %ds (%s)", sess.UserID, req.Role, req.Duration, status)
+	writeAdminJSON(w, http.StatusCreated, e)
+}
+
+// insertRoleElevation stores a new elevation request. An elevation that is active from the
+// start expires duration seconds from now.
+func insertRoleElevation(q rowQuerier, userID, roleID int, role, reason string, duration int, status string) (*RoleElevation, error) {
+	var expiresAt sql.NullTime
+	if status == ElevationActive {
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(duration) * time.Second), Valid: true}
+	}
+	return scanRoleElevation(q.QueryRow(`INSERT INTO role_elevations (id, user_id, role_id, role, reason, duration, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING `+roleElevationColumns,
+		uuid.New().String(), userID, roleID, role, reason, duration, status, expiresAt).Scan)
+}
+
+// ListMyElevationsHandler lists the user's elevation requests
+func ListMyElevationsHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartyViewSession(w, r)
+	if sess == nil {
+		return
+	}
+	elevations, err := listRoleElevations("user_id = $1", sess.UserID)
+	if err != nil {
+		log.Printf("Database error listing elevations: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, elevations)
+}
+
+// CancelElevationHandler withdraws a pending request or gives up an active elevation early
+func CancelElevationHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+	e, err := getRoleElevation(r.PathValue("id"))
+	if err == sql.ErrNoRows || (err == nil && e.UserID != sess.UserID) {
+		http.Error(w, "Elevation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading elevation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	actor := "user:" + strconv.Itoa(sess.UserID)
+	switch e.Status {
+	case ElevationPending:
+		e, err = updateElevation(e.ID, ElevationPending, "status = 'cancelled', ended_at = NOW()", ElevationCancelled, actor, "")
+	case ElevationActive:
+		e, err = updateElevation(e.ID, ElevationActive, "status = 'revoked', ended_at = NOW()", ElevationRevoked, actor, "Given up by the user")
+	default:
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Elevation has already ended", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Database error ending elevation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	markElevationEnded(r.Context(), e)
+
+	log.Printf("User %d ended elevation %s to role %s", sess.UserID, e.ID, e.Role)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Admin API: elevation policies and decisions ---
+
+// AdminGetElevationPolicyHandler returns whether and how a role can be requested
+func AdminGetElevationPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var policy ElevationPolicy
+	err := DB.QueryRow(`SELECT p.max_duration, p.requires_approval FROM role_elevation_policies p
+		JOIN roles r ON r.id = p.role_id WHERE r.name = $1`, r.PathValue("role")).
+		Scan(&policy.MaxDuration, &policy.RequiresApproval)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Role not found or not requestable", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading elevation policy: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, policy)
+}
+
+// AdminPutElevationPolicyHandler makes a role requestable or changes its policy
+func AdminPutElevationPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy := ElevationPolicy{RequiresApproval: true}
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if policy.MaxDuration < minElevationDuration || policy.MaxDuration > maxElevationDuration {
+		http.Error(w, fmt.Sprintf("max_duration must be between %d and %d seconds", minElevationDuration, maxElevationDuration), http.StatusBadRequest)
+		return
+	}
+
+	role := r.PathValue("role")
+	res, err := DB.Exec(`INSERT INTO role_elevation_policies (role_id, max_duration, requires_approval)
+		SELECT id, $2, $3 FROM roles WHERE name = $1
+		ON CONFLICT (role_id) DO UPDATE SET max_duration = EXCLUDED.max_duration, requires_approval = EXCLUDED.requires_approval`,
+		role, policy.MaxDuration, policy.RequiresApproval)
+	if err != nil {
+		log.Printf("Database error saving elevation policy: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Admin made role %s requestable for up to %ds (approval required: %t)", role, policy.MaxDuration, policy.RequiresApproval)
+	writeAdminJSON(w, http.StatusOK, policy)
+}
+
+// AdminDeleteElevationPolicyHandler stops a role from being requested. Active elevations
+// run until they expire or are revoked.
+func AdminDeleteElevationPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	role := r.PathValue("role")
+	writeRBACExecResult(w, "Role not found or not requestable", "made role "+role+" no longer requestable")(
+		DB.Exec(`DELETE FROM role_elevation_policies p USING roles r WHERE p.role_id = r.id AND r.name = $1`, role))
+}
+
+// AdminListElevationsHandler lists elevations, optionally filtered by status and user_id
+func AdminListElevationsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	userID := 0
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		var err error
+		if userID, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	elevations, err := listRoleElevations("($1 = '' OR status = $1) AND ($2 = 0 OR user_id = $2)", status, userID)
+	if err != nil {
+		log.Printf("Database error listing elevations: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, elevations)
+}
+
+// AdminGetElevationHandler returns one elevation with its audit trail
+func AdminGetElevationHandler(w http.ResponseWriter, r *http.Request) {
+	e, err := getRoleElevation(r.PathValue("id"))
+	if err == nil {
+		e.Events, err = listElevationEvents(e.ID)
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Elevation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading elevation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, e)
+}
+
+// ElevationDecision is the optional body of approve, deny and revoke
+type ElevationDecision struct {
+	Comment string `json:"comment"`
+}
+
+// AdminApproveElevationHandler activates a pending elevation; its duration starts now
+func AdminApproveElevationHandler(w http.ResponseWriter, r *http.Request) {
+	decideElevation(w, r, ElevationPending, "approved",
+		"status = 'active', decided_by = $3, decided_at = NOW(), expires_at = NOW() + duration * INTERVAL '1 second'")
+}
+
+// AdminDenyElevationHandler rejects a pending elevation
+func AdminDenyElevationHandler(w http.ResponseWriter, r *http.Request) {
+	decideElevation(w, r, ElevationPending, ElevationDenied,
+		"status = 'denied', decided_by = $3, decided_at = NOW(), ended_at = NOW()")
+}
+
+// AdminRevokeElevationHandler ends an active elevation early. Tokens carrying the role
+// stop validating immediately.
+func AdminRevokeElevationHandler(w http.ResponseWriter, r *http.Request) {
+	decideElevation(w, r, ElevationActive, ElevationRevoked,
+		"status = 'revoked', ended_at = NOW(), decided_by = COALESCE($3, decided_by)")
+}
+
+// decideElevation moves an elevation out of status from on behalf of the calling admin.
+// Admins cannot decide on their own requests.
+func decideElevation(w http.ResponseWriter, r *http.Request, from, event, set string) {
+	var req ElevationDecision
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// 1. Who is deciding: an admin user, or the ADMIN_API_TOKEN
+	actor, decidedBy := "admin_token", sql.NullInt64{}
+	if _, sess := adminSession(r); sess != nil {
+		actor, decidedBy = "user:"+strconv.Itoa(sess.UserID), sql.NullInt64{Int64: int64(sess.UserID), Valid: true}
+	}
+
+	e, err := getRoleElevation(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Elevation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading elevation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if decidedBy.Valid && int(decidedBy.Int64) == e.UserID {
+		http.Error(w, "You cannot decide on your own elevation", http.StatusForbidden)
+		return
+	}
+
+	// 2. Apply the change only if the elevation is still in the expected status
+	e, err = updateElevation(e.ID, from, set, event, actor, strings.TrimSpace(req.Comment), decidedBy)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Elevation is not "+from, http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Database error deciding elevation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if e.Status == ElevationRevoked {
+		markElevationEnded(r.Context(), e)
+	}
+
+	log.Printf("Admin (%s) %s elevation %s of user %d to role %s", actor, event, e.ID, e.UserID, e.Role)
+	writeAdminJSON(w, http.StatusOK, e)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testTx opens a transaction on TEST_DB_URL, a Postgres database with every migration
+// applied, and rolls it back when the test ends. Tests needing it are skipped without one.
+func testTx(t *testing.T) *sql.Tx {
+	t.Helper()
+	connStr := os.Getenv("TEST_DB_URL")
+	if connStr == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func TestInsertRoleElevation(t *testing.T) {
+	tx := testTx(t)
+	suffix := uuid.New().String()[:8]
+
+	var userID, roleID int
+	if err := tx.QueryRow("INSERT INTO users (email, password_hash) VALUES ($1, 'x') RETURNING id",
+		"elevation-"+suffix+"@example.com").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.QueryRow("INSERT INTO roles (name) VALUES ($1) RETURNING id", "oncall-"+suffix).Scan(&roleID); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	active, err := insertRoleElevation(tx, userID, roleID, "oncall-"+suffix, "incident", 3600, ElevationActive)
+	if err != nil {
+		t.Fatalf("active elevation: %v", err)
+	}
+	if active.Status != ElevationActive || active.ExpiresAt == nil {
+		t.Fatalf("status = %q, expires_at = %v; want an active elevation with an expiry", active.Status, active.ExpiresAt)
+	}
+	if d := active.ExpiresAt.Sub(before); d < 59*time.Minute || d > 61*time.Minute {
+		t.Fatalf("expires_at is %v from now, want about an hour", d)
+	}
+
+	// The open-request index allows one pending or active elevation per user and role
+	if _, err := tx.Exec("UPDATE role_elevations SET status = 'expired' WHERE id = $1", active.ID); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := insertRoleElevation(tx, userID, roleID, "oncall-"+suffix, "incident", 3600, ElevationPending)
+	if err != nil {
+		t.Fatalf("pending elevation: %v", err)
+	}
+	if pending.Status != ElevationPending || pending.ExpiresAt != nil {
+		t.Fatalf("status = %q, expires_at = %v; want a pending elevation without an expiry", pending.Status, pending.ExpiresAt)
+	}
+}
@@ -4,12 +4,10 @@ import (
 	"context" // Needed for RedisClient.Context()
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log" // Needed for logging errors
 	"net/http"
-
-	// Use the official v8 client import path
-	"github.com/go-redis/redis/v8"
+	"strings"
 
 	// Use the official v5 JWT import path
 	"github.com/golang-jwt/jwt/v5"
@@ -29,6 +27,11 @@ import (
 type RegisterRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Name     string `json:"name,omitempty"` // Optional display name (OIDC "name" claim)
+	Org      string `json:"org,omitempty"`  // Slug of the organization to join (register) or act for (login)
+
+	Invitation string `json:"invitation,omitempty"` // Register only: token from an invitation link
+	OTP        string `json:"otp,omitempty"`        // Login only: code from the user's authenticator app
 }
 
 // User defines the structure for a user record
@@ -38,15 +41,70 @@ type User struct {
 	PasswordHash string
 }
 
-// RegisterHandler handles new user creation
+// RegisterHandler handles new user creation. Sign-up is open unless REGISTRATION_MODE is
+// invite_only; an invitation, or the slug of an organization that is not invite-only,
+// also makes the new user a member. Accounts are global and email stays unique across
+// organizations, so an existing user joins another organization through an invitation
+// instead of registering again.
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	// ... (Registration logic remains correct)
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
+	// 1. Decide whether and where the user may join
+	var inv *Invitation
+	var org *Organization
+	var err error
+	switch {
+	case req.Invitation != "":
+		inv, err = loadInvitation(req.Invitation)
+		if err == errInvalidInvitation {
+			http.Error(w, "Invitation is invalid or expired", http.StatusForbidden)
+			return
+		} else if err != nil {
+			log.Printf("Database error loading invitation: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !strings.EqualFold(req.Email, inv.Email) {
+			http.Error(w, "This invitation is for a different email address", http.StatusForbidden)
+			return
+		}
+	case registrationInviteOnly():
+		http.Error(w, "Sign-up is by invitation only", http.StatusForbidden)
+		return
+	case req.Org != "":
+		org, err = getOrganization(req.Org)
+		if err == sql.ErrNoRows || (err == nil && org.InviteOnly) {
+			http.Error(w, "This organization only accepts invited members", http.StatusForbidden)
+			return
+		} else if err != nil {
+			log.Printf("Database error loading organization: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The password must meet the policy of the organization being joined
+	orgID := 0
+	if inv != nil {
+		orgID = inv.OrgID
+	} else if org != nil {
+		orgID = org.ID
+	}
+	settings, err := tenantSettings(orgID)
+	if err != nil {
+		log.Printf("Database error loading organization settings: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := settings.PasswordPolicy.check(req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Printf("Error hashing password: %v", err)
@@ -54,18 +112,54 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 2. Create the user and their membership together
+	tx, err := DB.Begin()
+	if err != nil {
+		log.Printf("Error registering user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
 	var userID int
-	err = DB.QueryRow("INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id",
-		req.Email, string(hashedPassword)).Scan(&userID)
+	err = tx.QueryRow("INSERT INTO users (email, password_hash, name) VALUES ($1, $2, $3) RETURNING id",
+		req.Email, string(hashedPassword), sql.NullString{String: req.Name, Valid: req.Name != ""}).Scan(&userID)
 
-	if err != nil {
+	if err != nil && inv != nil && isUniqueViolation(err) {
+		http.Error(w, "An account with this email already exists, sign in to accept the invitation", http.StatusConflict)
+		return
+	} else if err != nil {
 		log.Printf("Error registering user: %v", err)
 		http.Error(w, "Registration failed, email might already exist", http.StatusConflict)
 		return
 	}
 
+	joined := ""
+	if inv != nil {
+		joined = inv.OrgSlug
+		err = acceptInvitation(tx, inv, userID)
+	} else if org != nil {
+		joined = org.Slug
+		_, err = tx.Exec("INSERT INTO organization_members (org_id, user_id) VALUES ($1, $2)", org.ID, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err == errInvalidInvitation {
+		http.Error(w, "Invitation is invalid or expired", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Error registering user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{"message": "User registered successfully", "user_id": userID}
+	if joined != "" {
+		resp["org"] = joined
+	}
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "User registered successfully", "user_id": userID})
+	json.NewEncoder(w).Encode(resp)
 }
 
 // LoginHandler handles user authentication and JWT generation
@@ -77,10 +171,8 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user User
-	err := DB.QueryRow("SELECT id, email, password_hash FROM users WHERE email = $1", req.Email).
-		Scan(&user.ID, &user.Email, &user.PasswordHash)
-
+	// Signing in to an organization only succeeds for its members
+	orgID, err := resolveOrgID(req.Org)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
@@ -90,13 +182,46 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	user, err := authenticateUser(req.Email, req.Password, orgID)
+	if err == errInvalidCredentials {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
+	} else if err != nil {
+		log.Printf("Database error during login: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
 	}
 
-	tokens, err := generateTokens(user.ID) // Assumes generateTokens is defined in jwt.go
+	// Users enrolled in TOTP must also send a current code
+	amr, err := verifySecondFactor(r.Context(), user.ID, req.OTP)
+	if err == errMFARequired {
+		http.Error(w, "One-time code required", http.StatusUnauthorized)
+		return
+	} else if err == errInvalidCredentials {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	} else if err == errTOTPLocked {
+		http.Error(w, "Too many invalid codes; try again later", http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		log.Printf("Database error during login: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// An optional DPoP proof binds the session's tokens to the client's key
+	cnf, err := requestConfirmation(r)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := generateTokens(user.ID, orgID, amr, cnf) // Assumes generateTokens is defined in jwt.go
+	var policyErr *TenantPolicyError
+	if errors.As(err, &policyErr) {
+		http.Error(w, policyErr.Reason, http.StatusForbidden)
+		return
+	} else if err != nil {
 		log.Printf("Error generating tokens: %v", err)
 		http.Error(w, "Failed to generate tokens", http.StatusInternalServerError)
 		return
@@ -106,6 +231,84 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tokens)
 }
 
+// errInvalidCredentials is returned when the email is unknown or the password does not match
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// authenticateUser verifies an email and password pair against the users table. When orgID
+// is not 0 only members of that organization are found, so the lookup never crosses tenants.
+func authenticateUser(email, password string, orgID int) (*User, error) {
+	var user User
+	err := DB.QueryRow(`SELECT u.id, u.email, u.password_hash FROM users u
+		WHERE u.email = $1 AND ($2 = 0 OR EXISTS(
+			SELECT 1 FROM organization_members m WHERE m.user_id = u.id AND m.org_id = $2))`, email, orgID).
+		Scan(&user.ID, &user.Email, &user.PasswordHash)
+
+	if err == sql.ErrNoRows {
+		return nil, errInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	return &user, nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+// DPoP-bound tokens use the "DPoP" scheme instead (RFC 9449 section 7.1).
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
+		return authHeader[7:], true
+	}
+	if len(authHeader) > 5 && authHeader[:5] == "DPoP " {
+		return authHeader[5:], true
+	}
+	return "", false
+}
+
+// authenticateAccessToken checks the request's access token, its binding and its session.
+// On failure it has already written the response and returns a nil session.
+func authenticateAccessToken(w http.ResponseWriter, r *http.Request, realm string) (*Claims, *Session) {
+	tokenString, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+		http.Error(w, "Authorization header (Bearer <AT>) required", http.StatusUnauthorized)
+		return nil, nil
+	}
+
+	claims, err := parseAccessToken(tokenString)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Token is invalid or expired", http.StatusUnauthorized)
+		return nil, nil
+	}
+
+	if err := verifyTokenBinding(r.Context(), claims, tokenString, presentationFromRequest(r)); err != nil {
+		w.Header().Set("WWW-Authenticate", `DPoP error="invalid_token"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, nil
+	}
+
+	sess, err := loadTokenSession(r.Context(), claims)
+	var invalid *InvalidTokenError
+	if errors.As(err, &invalid) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, invalid.Reason, http.StatusUnauthorized)
+		return nil, nil
+	} else if err != nil {
+		log.Printf("Error checking session: %v", err)
+		http.Error(w, "Server error checking session", http.StatusInternalServerError)
+		return nil, nil
+	}
+	if sess.ImpersonatorID != 0 {
+		logImpersonatedUse(claims.SessionID, sess, r.Method+" "+r.URL.Path)
+	}
+	return claims, sess
+}
+
 // RefreshRequest defines the expected structure for token renewal
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
@@ -120,12 +323,11 @@ func RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fix 1: Client must pass the expired AT in the Authorization header to get the SessionID
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" || len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+	tokenString, ok := bearerToken(r)
+	if !ok {
 		http.Error(w, "Authorization header (Bearer <AT>) required for refresh", http.StatusUnauthorized)
 		return
 	}
-	tokenString := authHeader[7:]
 
 	// 1. Decode the expired Access Token to get the Session ID
 	claims := &Claims{}
@@ -146,12 +348,10 @@ func RefreshHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 2. Use the Session ID to find the Refresh Token in Redis
 	// Key: session:{SessionID}
-	redisKey := fmt.Sprintf("session:%s", claims.SessionID)
-
-	// We need to use RedisClient.Context() here
-	storedRT, err := RedisClient.Get(context.Background(), redisKey).Result()
+	ctx := context.Background()
+	sess, err := loadSession(ctx, claims.SessionID)
 
-	if err == redis.Nil {
+	if err == ErrSessionNotFound {
 		http.Error(w, "Session expired or revoked", http.StatusUnauthorized)
 		return
 	} else if err != nil {
@@ -161,25 +361,42 @@ func RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 3. Compare the stored RT with the submitted RT
-	if storedRT != req.RefreshToken {
+	if sess.RefreshToken == "" || sess.RefreshToken != req.RefreshToken {
 		// Revoke the session since a mismatch implies an attack or error
-		RedisClient.Del(context.Background(), redisKey)
+		deleteSession(ctx, claims.SessionID, sess)
 		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
 		return
 	}
 
-	// 4. Invalidate old Refresh Token (One-time use)
-	RedisClient.Del(context.Background(), redisKey)
-
-	// 5. Generate new Access and Refresh Tokens
-	newTokens, err := generateTokens(claims.UserID)
+	// 4. DPoP-bound sessions can only be refreshed by the holder of the key
+	cnf, err := requestConfirmation(r)
+	if err == nil {
+		err = checkPresentedBinding(sess.Cnf, cnf)
+	}
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// 5. Invalidate old Refresh Token (One-time use)
+	deleteSession(ctx, claims.SessionID, sess)
+
+	// 6. Generate new Access and Refresh Tokens, keeping the session's client, scope and binding
+	newTokens, err := issueSessionTokens(*sess)
+	var policyErr *TenantPolicyError
+	if err == errNotOrgMember {
+		http.Error(w, "No longer a member of the session's organization", http.StatusUnauthorized)
+		return
+	} else if errors.As(err, &policyErr) {
+		http.Error(w, policyErr.Reason, http.StatusUnauthorized)
+		return
+	} else if err != nil {
 		log.Printf("Failed to generate new tokens: %v", err)
 		http.Error(w, "Failed to generate new tokens", http.StatusInternalServerError)
 		return
 	}
 
-	// 6. Respond
+	// 7. Respond
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(newTokens)
 }
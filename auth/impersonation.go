@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// --- Admin impersonation ---
+//
+// An admin can start a short-lived session as another user to see what they see. The
+// session has no refresh token, its tokens carry an act claim naming the admin plus the
+// impersonation flag, account changes are refused, and every use is logged.
+
+const impersonationTTL = 15 * time.Minute // Longest an impersonation session may last
+
+// ImpersonationRequest starts an impersonation session
+type ImpersonationRequest struct {
+	Reason   string `json:"reason"`
+	Org      string `json:"org,omitempty"`      // Slug of the organization to act for
+	Duration int    `json:"duration,omitempty"` // Seconds; defaults to and is capped at impersonationTTL
+}
+
+// Impersonation is the audit record of one impersonation session
+type Impersonation struct {
+	SessionID string     `json:"session_id"`
+	AdminID   int        `json:"admin_id"`
+	UserID    int        `json:"user_id"`
+	OrgID     int        `json:"org_id,omitempty"`
+	Reason    string     `json:"reason"`
+	StartedAt time.Time  `json:"started_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	EndedBy   int        `json:"ended_by,omitempty"`
+}
+
+// logImpersonatedUse records one use of an impersonation session's token
+func logImpersonatedUse(sessionID string, sess *Session, what string) {
+	log.Printf("Impersonation %s: admin %d as user %d: %s", sessionID, sess.ImpersonatorID, sess.UserID, what)
+}
+
+// AdminImpersonateHandler issues an access token for the user, acting for the calling admin
+func AdminImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	var req ImpersonationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+	ttl := impersonationTTL
+	if req.Duration < 0 {
+		http.Error(w, "Invalid duration", http.StatusBadRequest)
+		return
+	} else if d := time.Duration(req.Duration) * time.Second; d > 0 && d < ttl {
+		ttl = d
+	}
+
+	// 1. The act claim names a person, so the ADMIN_API_TOKEN cannot impersonate
+	_, admin := adminSession(r)
+	if admin == nil {
+		http.Error(w, "Impersonation requires an admin's own access token", http.StatusForbidden)
+		return
+	}
+	if admin.UserID == userID {
+		http.Error(w, "You cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	// 2. The target and the organization to act for
+	var exists bool
+	if err := DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		log.Printf("Database error loading user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	orgID, err := resolveOrgID(req.Org)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading organization: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// 3. The user's roles, but the admin's authentication for the organization's settings
+	sess := Session{
+		UserID:         userID,
+		OrgID:          orgID,
+		AuthTime:       admin.AuthTime,
+		LoginMethod:    admin.LoginMethod,
+		AMR:            admin.AMR,
+		Actor:          &Actor{Sub: strconv.Itoa(admin.UserID)},
+		ImpersonatorID: admin.UserID,
+	}
+	if err := loadSessionAuthorization(&sess); err == errNotOrgMember {
+		http.Error(w, "User is not a member of this organization", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading roles: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if containsString(sess.Permissions, adminPermission) {
+		http.Error(w, "Admins cannot be impersonated", http.StatusForbidden)
+		return
+	}
+	var policyErr *TenantPolicyError
+	if err := checkTenantSession(&sess); errors.As(err, &policyErr) {
+		http.Error(w, policyErr.Reason, http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading organization settings: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	ttl = elevationAccessTTL(&sess, ttl)
+
+	// 4. Record the session before any token for it exists
+	sessionID := uuid.New().String()
+	_, err = DB.Exec(`INSERT INTO impersonation_sessions (session_id, admin_id, user_id, org_id, reason, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		sessionID, admin.UserID, userID, sql.NullInt64{Int64: int64(orgID), Valid: orgID != 0}, req.Reason, time.Now().Add(ttl))
+	if err != nil {
+		log.Printf("Database error recording impersonation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// 5. A refresh-less session that ends with its only access token
+	accessToken, err := generateJWT(sessionID, sess, ttl)
+	if err != nil {
+		log.Printf("Error generating impersonation token: %v", err)
+		http.Error(w, "Failed to generate tokens", http.StatusInternalServerError)
+		return
+	}
+	if err := saveSession(r.Context(), sessionID, sess, ttl); err != nil {
+		log.Printf("Failed to save impersonation session: %v", err)
+		http.Error(w, "Server error saving session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %d started impersonation %s of user %d (org %d) for %s: %s", admin.UserID, sessionID, userID, orgID, ttl, req.Reason)
+	writeAdminJSON(w, http.StatusCreated, struct {
+		TokensResponse
+		SessionID string `json:"session_id"`
+	}{TokensResponse{AccessToken: accessToken, ExpiresIn: int(ttl.Seconds())}, sessionID})
+}
+
+// AdminListImpersonationsHandler lists impersonation sessions, newest first, optionally
+// filtered by user_id and admin_id
+func AdminListImpersonationsHandler(w http.ResponseWriter, r *http.Request) {
+	var filter [2]int
+	for i, name := range []string{"user_id", "admin_id"} {
+		if v := r.URL.Query().Get(name); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			filter[i] = id
+		}
+	}
+
+	rows, err := DB.Query(`SELECT session_id, COALESCE(admin_id, 0), COALESCE(user_id, 0), COALESCE(org_id, 0), reason,
+			started_at, expires_at, ended_at, COALESCE(ended_by, 0)
+		FROM impersonation_sessions WHERE ($1 = 0 OR user_id = $1) AND ($2 = 0 OR admin_id = $2)
+		ORDER BY started_at DESC`, filter[0], filter[1])
+	if err != nil {
+		log.Printf("Database error listing impersonations: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	impersonations := []Impersonation{}
+	for rows.Next() {
+		var imp Impersonation
+		var endedAt sql.NullTime
+		if err := rows.Scan(&imp.SessionID, &imp.AdminID, &imp.UserID, &imp.OrgID, &imp.Reason,
+			&imp.StartedAt, &imp.ExpiresAt, &endedAt, &imp.EndedBy); err != nil {
+			log.Printf("Database error listing impersonations: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		imp.EndedAt = nullTimePtr(endedAt)
+		impersonations = append(impersonations, imp)
+	}
+	writeAdminJSON(w, http.StatusOK, impersonations)
+}
+
+// AdminEndImpersonationHandler ends an impersonation session before it expires
+func AdminEndImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("session_id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		http.Error(w, "No active impersonation with this ID", http.StatusNotFound)
+		return
+	}
+	endedBy := sql.NullInt64{}
+	if _, sess := adminSession(r); sess != nil {
+		endedBy = sql.NullInt64{Int64: int64(sess.UserID), Valid: true}
+	}
+
+	res, err := DB.Exec(`UPDATE impersonation_sessions SET ended_at = NOW(), ended_by = $2
+		WHERE session_id = $1 AND ended_at IS NULL AND expires_at > NOW()`, sessionID, endedBy)
+	if err != nil {
+		log.Printf("Database error ending impersonation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "No active impersonation with this ID", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	sess, err := loadSession(ctx, sessionID)
+	if err == nil {
+		err = deleteSession(ctx, sessionID, sess)
+	}
+	if err != nil && err != ErrSessionNotFound {
+		log.Printf("Redis error ending impersonation session: %v", err)
+		http.Error(w, "Server error ending session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin ended impersonation %s", sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
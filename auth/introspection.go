@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// --- Token Introspection (RFC 7662) and Revocation (RFC 7009) ---
+
+// IntrospectionResponse is the RFC 7662 section 2.2 response plus session metadata
+type IntrospectionResponse struct {
+	Active        bool          `json:"active"`
+	Scope         string        `json:"scope,omitempty"`
+	ClientID      string        `json:"client_id,omitempty"`
+	Sub           string        `json:"sub,omitempty"`
+	TokenType     string        `json:"token_type,omitempty"`
+	TokenUse      string        `json:"token_use,omitempty"` // "access_token" or "refresh_token"
+	Exp           int64         `json:"exp,omitempty"`
+	Iat           int64         `json:"iat,omitempty"`
+	Iss           string        `json:"iss,omitempty"`
+	SessionID     string        `json:"session_id,omitempty"`
+	PrincipalType string        `json:"principal_type,omitempty"`
+	AuthTime      int64         `json:"auth_time,omitempty"`
+	Aud           []string      `json:"aud,omitempty"`
+	Act           *Actor        `json:"act,omitempty"`
+	Cnf           *Confirmation `json:"cnf,omitempty"`
+	Roles         []string      `json:"roles,omitempty"`
+	Permissions   []string      `json:"permissions,omitempty"`
+	OrgID         int           `json:"org_id,omitempty"`
+	Impersonation bool          `json:"impersonation,omitempty"` // act.sub is an admin signed in as sub
+}
+
+// tokenInfo is an active token resolved to its session
+type tokenInfo struct {
+	Use       string  // "access_token" or "refresh_token"
+	Claims    *Claims // Only set for access tokens
+	SessionID string
+	Session   *Session
+}
+
+// lookupToken resolves an access or refresh token to its active session.
+// The hint only decides which kind is tried first. Returns ErrSessionNotFound when inactive.
+func lookupToken(ctx context.Context, token, hint string) (*tokenInfo, error) {
+	lookups := []func(context.Context, string) (*tokenInfo, error){lookupAccessToken, lookupRefreshToken}
+	if hint == "refresh_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		info, err := lookup(ctx, token)
+		if err != ErrSessionNotFound {
+			return info, err
+		}
+	}
+	return nil, ErrSessionNotFound
+}
+
+func lookupAccessToken(ctx context.Context, token string) (*tokenInfo, error) {
+	claims, err := parseAccessToken(token)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	sess, err := loadSession(ctx, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenInfo{Use: "access_token", Claims: claims, SessionID: claims.SessionID, Session: sess}, nil
+}
+
+func lookupRefreshToken(ctx context.Context, token string) (*tokenInfo, error) {
+	sessionID, err := sessionIDForRefreshToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := loadSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess.RefreshToken != token {
+		return nil, ErrSessionNotFound
+	}
+	return &tokenInfo{Use: "refresh_token", SessionID: sessionID, Session: sess}, nil
+}
+
+// authenticateProtectedResource authenticates the confidential client calling introspection or revocation
+func authenticateProtectedResource(w http.ResponseWriter, r *http.Request) *OAuthClient {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return nil
+	}
+
+	client, err := authenticateClient(r)
+	if err == errInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return nil
+	} else if err != nil {
+		log.Printf("Database error authenticating client: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return nil
+	}
+	return client
+}
+
+// IntrospectHandler reports whether a token is active and what it grants
+func IntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	client := authenticateProtectedResource(w, r)
+	if client == nil {
+		return
+	}
+	if client.IsPublic() {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Public clients cannot introspect tokens")
+		return
+	}
+
+	ctx := r.Context()
+	info, err := lookupToken(ctx, r.PostForm.Get("token"), r.PostForm.Get("token_type_hint"))
+	if err == ErrSessionNotFound {
+		writeOAuthJSON(w, http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	} else if err != nil {
+		log.Printf("Redis error during introspection: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// An access token is only active while ValidateToken would still accept it for its session:
+	// not after SwitchOrg, a tenant settings rejection or the end of an elevation it carries
+	if info.Claims != nil {
+		err := checkTokenSession(ctx, info.Claims, info.Session)
+		var invalid *InvalidTokenError
+		if errors.As(err, &invalid) {
+			writeOAuthJSON(w, http.StatusOK, IntrospectionResponse{Active: false})
+			return
+		} else if err != nil {
+			log.Printf("Session check error during introspection: %v", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	sess := info.Session
+	resp := IntrospectionResponse{
+		Active:        true,
+		Scope:         sess.Scope,
+		ClientID:      sess.ClientID,
+		Sub:           sess.subject(),
+		TokenUse:      info.Use,
+		Iss:           issuerURL(),
+		SessionID:     info.SessionID,
+		PrincipalType: sess.principalType(),
+		AuthTime:      sess.AuthTime,
+		Aud:           sess.Audience,
+		Act:           sess.Actor,
+		Cnf:           sess.Cnf,
+		Roles:         sess.Roles,
+		Permissions:   sess.Permissions,
+		OrgID:         sess.OrgID,
+		Impersonation: sess.ImpersonatorID != 0,
+	}
+	if info.Claims != nil {
+		resp.TokenType = "Bearer"
+		resp.Exp = info.Claims.ExpiresAt.Unix()
+		resp.Iat = info.Claims.IssuedAt.Unix()
+	} else if ttl, err := RedisClient.TTL(ctx, sessionKey(info.SessionID)).Result(); err == nil && ttl > 0 {
+		// Refresh tokens expire together with their session
+		resp.Exp = time.Now().Add(ttl).Unix()
+	}
+
+	writeOAuthJSON(w, http.StatusOK, resp)
+}
+
+// RevokeHandler revokes the session behind an access or refresh token issued to the calling client
+func RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	client := authenticateProtectedResource(w, r)
+	if client == nil {
+		return
+	}
+
+	ctx := r.Context()
+	info, err := lookupToken(ctx, r.PostForm.Get("token"), r.PostForm.Get("token_type_hint"))
+	if err == ErrSessionNotFound {
+		// Invalid or already revoked tokens are not an error (RFC 7009 section 2.2)
+		w.WriteHeader(http.StatusOK)
+		return
+	} else if err != nil {
+		log.Printf("Redis error during revocation: %v", err)
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	if info.Session.ClientID != client.ClientID {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Token was not issued to this client")
+		return
+	}
+
+	// Access and refresh tokens share the session, so revoking either ends both
+	if err := deleteSession(ctx, info.SessionID, info.Session); err != nil {
+		log.Printf("Redis error revoking session: %v", err)
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+	if err := notifySessionRevoked(ctx, client, info.Session); err != nil {
+		log.Printf("Redis error queueing back-channel logout: %v", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
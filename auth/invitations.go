@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// --- Organization invitations and invite-only registration ---
+//
+// An invitation link carries {id}.{signature}, where the signature is an HMAC over the
+// invitation ID and its expiry. The row stays authoritative, so invitations can be
+// revoked and are accepted once.
+
+const (
+	defaultInvitationTTL = 7 * 24 * time.Hour
+	maxInvitationTTL     = 30 * 24 * time.Hour
+)
+
+// errInvalidInvitation covers unknown, forged, expired, revoked and already accepted invitations
+var errInvalidInvitation = errors.New("invitation is invalid or expired")
+
+// Invitation invites an email address to join an organization with an optional role
+type Invitation struct {
+	ID        string    `json:"id"`
+	OrgID     int       `json:"org_id"`
+	OrgSlug   string    `json:"org"`
+	OrgName   string    `json:"org_name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role,omitempty"`
+	InvitedBy int       `json:"invited_by,omitempty"` // 0 when created with ADMIN_API_TOKEN
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Link      string    `json:"link,omitempty"` // Only returned when the invitation is created
+}
+
+// registrationInviteOnly reports whether REGISTRATION_MODE closes open sign-up globally
+func registrationInviteOnly() bool {
+	return os.Getenv("REGISTRATION_MODE") == "invite_only"
+}
+
+// invitationSignature binds an invitation token to the invitation's ID and expiry
+func invitationSignature(id string, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, []byte(SecretKey))
+	mac.Write([]byte("invitation\x00" + id + "\x00" + expiresAt.UTC().Format(time.RFC3339)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func invitationToken(inv *Invitation) string {
+	return inv.ID + "." + invitationSignature(inv.ID, inv.ExpiresAt)
+}
+
+const invitationColumns = `i.id, i.org_id, o.slug, o.name, i.email, COALESCE(r.name, ''), COALESCE(i.invited_by, 0),
+	i.created_at, i.expires_at`
+
+func scanInvitation(scan func(dest ...interface{}) error) (*Invitation, error) {
+	var inv Invitation
+	err := scan(&inv.ID, &inv.OrgID, &inv.OrgSlug, &inv.OrgName, &inv.Email, &inv.Role, &inv.InvitedBy,
+		&inv.CreatedAt, &inv.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// loadInvitation verifies an invitation token and returns the pending invitation it names
+func loadInvitation(token string) (*Invitation, error) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidInvitation
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errInvalidInvitation
+	}
+
+	inv, err := scanInvitation(DB.QueryRow(`SELECT `+invitationColumns+`
+		FROM organization_invitations i JOIN organizations o ON o.id = i.org_id
+		LEFT JOIN roles r ON r.id = i.role_id
+		WHERE i.id = $1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > NOW()`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, errInvalidInvitation
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(invitationSignature(inv.ID, inv.ExpiresAt))) {
+		return nil, errInvalidInvitation
+	}
+	return inv, nil
+}
+
+// acceptInvitation makes the user a member with the invited role and marks the invitation
+// used. It returns errInvalidInvitation if a concurrent accept got there first.
+func acceptInvitation(tx *sql.Tx, inv *Invitation, userID int) error {
+	res, err := tx.Exec(`UPDATE organization_invitations SET accepted_at = NOW(), accepted_by = $2
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL`, inv.ID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errInvalidInvitation
+	}
+
+	if _, err := tx.Exec(`INSERT INTO organization_members (org_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, inv.OrgID, userID); err != nil {
+		return err
+	}
+	if inv.Role != "" {
+		_, err = tx.Exec(`INSERT INTO organization_member_roles (org_id, user_id, role_id)
+			SELECT $1, $2, id FROM roles WHERE name = $3 ON CONFLICT DO NOTHING`, inv.OrgID, userID, inv.Role)
+	}
+	return err
+}
+
+// --- Public API: invitation details and acceptance by existing users ---
+
+// GetInvitationHandler shows what an invitation link is for, so a sign-up or accept page can render it
+func GetInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	inv, err := loadInvitation(r.PathValue("token"))
+	if err == errInvalidInvitation {
+		http.Error(w, "Invitation is invalid or expired", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading invitation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"org": inv.OrgSlug, "org_name": inv.OrgName, "email": inv.Email, "role": inv.Role, "expires_at": inv.ExpiresAt,
+	})
+}
+
+// AcceptInvitationRequest accepts an invitation as an existing user
+type AcceptInvitationRequest struct {
+	Invitation string `json:"invitation"`
+}
+
+// AcceptInvitationHandler lets a signed-in user join the organization they were invited to.
+// The invitation must be addressed to the user's email.
+func AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var req AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// 1. The user's own first-party session
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+
+	// 2. The invitation, addressed to this user
+	inv, err := loadInvitation(req.Invitation)
+	if err == errInvalidInvitation {
+		http.Error(w, "Invitation is invalid or expired", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading invitation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	var email string
+	if err := DB.QueryRow("SELECT email FROM users WHERE id = $1", sess.UserID).Scan(&email); err != nil {
+		log.Printf("Database error loading user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !strings.EqualFold(email, inv.Email) {
+		http.Error(w, "This invitation is for a different email address", http.StatusForbidden)
+		return
+	}
+
+	// 3. Join
+	tx, err := DB.Begin()
+	if err != nil {
+		log.Printf("Database error accepting invitation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	err = acceptInvitation(tx, inv, sess.UserID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err == errInvalidInvitation {
+		http.Error(w, "Invitation is invalid or expired", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error accepting invitation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d accepted invitation %s to organization %s", sess.UserID, inv.ID, inv.OrgSlug)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Invitation accepted", "org": inv.OrgSlug})
+}
+
+// --- Admin API: invitations ---
+
+// InvitationRequest creates an invitation
+type InvitationRequest struct {
+	Email            string `json:"email"`
+	Role             string `json:"role,omitempty"`
+	ExpiresInSeconds int    `json:"expires_in,omitempty"` // Default 7 days, at most 30
+}
+
+// AdminCreateInvitationHandler invites an email address to the organization and returns the
+// invitation link. The link is only shown here; deliver it to the invitee out of band.
+func AdminCreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := adminOrganization(w, r)
+	if !ok {
+		return
+	}
+	var req InvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if !strings.Contains(req.Email, "@") {
+		http.Error(w, "A valid email is required", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultInvitationTTL
+	if req.ExpiresInSeconds != 0 {
+		ttl = time.Duration(req.ExpiresInSeconds) * time.Second
+		if ttl <= 0 || ttl > maxInvitationTTL {
+			http.Error(w, "expires_in must be between 1 second and 30 days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Admins calling with their own token are recorded as the inviter
+	invitedBy := sql.NullInt64{}
+	if _, sess := adminSession(r); sess != nil {
+		invitedBy = sql.NullInt64{Int64: int64(sess.UserID), Valid: true}
+	}
+
+	inv := Invitation{
+		ID: uuid.New().String(), OrgID: org.ID, OrgSlug: org.Slug, OrgName: org.Name,
+		Email: req.Email, Role: req.Role, InvitedBy: int(invitedBy.Int64),
+		ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	var roleID sql.NullInt64
+	if req.Role != "" {
+		err := DB.QueryRow("SELECT id FROM roles WHERE name = $1", req.Role).Scan(&roleID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Role not found", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Database error loading role: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if admin, err := roleGrantsAdmin(req.Role); err != nil {
+			log.Printf("Database error loading role: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		} else if admin {
+			http.Error(w, "Roles granting the admin permission cannot be assigned within an organization", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := DB.QueryRow(`INSERT INTO organization_invitations (id, org_id, email, role_id, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`,
+		inv.ID, inv.OrgID, inv.Email, roleID, invitedBy, inv.ExpiresAt).Scan(&inv.CreatedAt)
+	if err != nil {
+		log.Printf("Database error creating invitation: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	inv.Link = issuerURL() + "/invitations/" + invitationToken(&inv)
+	log.Printf("Admin invited %s to organization %s (invitation %s)", inv.Email, org.Slug, inv.ID)
+	writeAdminJSON(w, http.StatusCreated, inv)
+}
+
+// AdminListInvitationsHandler lists the organization's pending invitations
+func AdminListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := adminOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := DB.Query(`SELECT `+invitationColumns+`
+		FROM organization_invitations i JOIN organizations o ON o.id = i.org_id
+		LEFT JOIN roles r ON r.id = i.role_id
+		WHERE i.org_id = $1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > NOW()
+		ORDER BY i.created_at DESC`, org.ID)
+	if err != nil {
+		log.Printf("Database error listing invitations: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows.Scan)
+		if err != nil {
+			log.Printf("Database error listing invitations: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		invitations = append(invitations, *inv)
+	}
+	writeAdminJSON(w, http.StatusOK, invitations)
+}
+
+// AdminRevokeInvitationHandler revokes a pending invitation so its link stops working
+func AdminRevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := adminOrganization(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+	writeRBACExecResult(w, "Invitation not found or no longer pending", "revoked invitation "+id+" to organization "+org.Slug)(
+		DB.Exec(`UPDATE organization_invitations SET revoked_at = NOW()
+			WHERE id = $1 AND org_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL`, id, org.ID))
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -19,62 +21,204 @@ func init() {
 
 // Claims defines the structure for the Access Token (AT) payload
 type Claims struct {
-	UserID    int    `json:"user_id"`
-	SessionID string `json:"session_id"` // NEW: Unique ID for this session/device
+	UserID        int           `json:"user_id"`
+	SessionID     string        `json:"session_id"`               // NEW: Unique ID for this session/device
+	PrincipalType string        `json:"principal_type,omitempty"` // "user" or "service"; empty means user
+	ClientID      string        `json:"client_id,omitempty"`      // OAuth client the token was issued to
+	Scope         string        `json:"scope,omitempty"`          // Space-delimited granted scopes
+	Act           *Actor        `json:"act,omitempty"`            // Delegation chain for exchanged tokens (RFC 8693)
+	Cnf           *Confirmation `json:"cnf,omitempty"`            // Proof-of-possession key binding (DPoP)
+	Roles         []string      `json:"roles,omitempty"`          // Roles granted to the subject at issuance
+	Permissions   []string      `json:"permissions,omitempty"`    // Union of the roles' permissions
+	OrgID         int           `json:"org_id,omitempty"`         // Organization the token acts for
+	Impersonation bool          `json:"impersonation,omitempty"`  // An admin (act.sub) is signed in as the subject
+	APIKeyID      string        `json:"-"`                        // Set when built from an API key rather than parsed
 	jwt.RegisteredClaims
 }
 
+// Actor identifies the party acting on behalf of the token subject (RFC 8693 section 4.1)
+type Actor struct {
+	Sub string `json:"sub"`
+	Act *Actor `json:"act,omitempty"` // Prior actor when delegation is chained
+}
+
+// Principal types carried in Claims and Session
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
 // TokensResponse holds both the Access and Refresh Tokens
 type TokensResponse struct {
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in"` // Access token lifetime in seconds
 }
 
-// generateTokens creates both the Access Token (AT) and Refresh Token (RT)
-func generateTokens(userID int) (TokensResponse, error) {
+const (
+	accessTokenTTL  = 15 * time.Minute   // Default 15-minute validity for AT
+	refreshTokenTTL = 7 * 24 * time.Hour // Default: RT (and the session) lives for a week
+)
+
+// tokenLifetimes returns the AT and RT lifetimes for a session: those of its
+// organization, with the OAuth client's overrides applied when it has any.
+func tokenLifetimes(sess Session) (time.Duration, time.Duration) {
+	settings, err := tenantSettings(sess.OrgID)
+	if err != nil {
+		log.Printf("Could not load token lifetimes for organization %d, using defaults: %v", sess.OrgID, err)
+	}
+	accessTTL := time.Duration(settings.AccessTokenTTL) * time.Second
+	refreshTTL := time.Duration(settings.RefreshTokenTTL) * time.Second
+	if sess.ClientID == "" {
+		return accessTTL, refreshTTL
+	}
+
+	client, err := getOAuthClient(sess.ClientID)
+	if err != nil {
+		log.Printf("Could not load token lifetimes for client %s, using defaults: %v", sess.ClientID, err)
+		return accessTTL, refreshTTL
+	}
+	if client.AccessTokenTTL.Valid {
+		accessTTL = time.Duration(client.AccessTokenTTL.Int64) * time.Second
+	}
+	if client.RefreshTokenTTL.Valid {
+		refreshTTL = time.Duration(client.RefreshTokenTTL.Int64) * time.Second
+	}
+	return accessTTL, refreshTTL
+}
+
+// generateTokens creates both the Access Token (AT) and Refresh Token (RT) for a password
+// login, acting for orgID when it is not 0. amr lists the factors the user presented; cnf is
+// non-nil when the client asked for sender-constrained tokens.
+func generateTokens(userID, orgID int, amr []string, cnf *Confirmation) (TokensResponse, error) {
+	return issueSessionTokens(Session{UserID: userID, OrgID: orgID, AMR: amr, LoginMethod: LoginMethodPassword, Cnf: cnf})
+}
+
+// issueSessionTokens starts a new session from the given template and returns its tokens.
+// Any RefreshToken already present in sess is replaced. A *TenantPolicyError means the
+// session's organization no longer accepts it.
+func issueSessionTokens(sess Session) (TokensResponse, error) {
+	if err := checkTenantSession(&sess); err != nil {
+		return TokensResponse{}, err
+	}
+
 	// 1. Generate unique Session ID
 	sessionID := uuid.New().String()
+	accessTTL, refreshTTL := tokenLifetimes(sess)
+
+	// Roles and membership are re-read on every issuance, so changes apply from the next refresh.
+	// The AT never outlives a temporary role it carries.
+	if sess.principalType() == PrincipalUser {
+		if err := loadSessionAuthorization(&sess); err != nil {
+			return TokensResponse{}, err
+		}
+		accessTTL = elevationAccessTTL(&sess, accessTTL)
+	}
 
 	// 2. Access Token (Short-lived, contains session_id)
-	accessToken, err := generateJWT(userID, sessionID)
+	accessToken, err := generateJWT(sessionID, sess, accessTTL)
 	if err != nil {
 		return TokensResponse{}, err
 	}
 
 	// 3. Refresh Token (Long-lived, random string)
-	refreshToken := uuid.New().String() // RT is a simple unique string
-	rtExpiration := 7 * 24 * time.Hour
+	sess.RefreshToken = uuid.New().String() // RT is a simple unique string
 
-	// 4. Store Refresh Token in Redis (Stateful session management starts here)
-	// Key: user:{UserID}:sessions:{SessionID}
-	// Value: RefreshToken (or metadata in Phase 3)
-	redisKey := fmt.Sprintf("session:%s", sessionID)
-
-	// We store the refresh token itself in Redis for verification
-	if err := RedisClient.Set(RedisClient.Context(), redisKey, refreshToken, rtExpiration).Err(); err != nil {
+	// 4. Store the session in Redis (Stateful session management starts here)
+	// Key: session:{SessionID}
+	// Value: Session metadata, including the RT for verification
+	if err := saveSession(RedisClient.Context(), sessionID, sess, refreshTTL); err != nil {
 		return TokensResponse{}, fmt.Errorf("failed to save refresh token to redis: %w", err)
 	}
 
 	return TokensResponse{
 		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		RefreshToken: sess.RefreshToken,
+		ExpiresIn:    int(accessTTL.Seconds()),
 	}, nil
 }
 
-// generateJWT creates a signed JWT for the given user ID and session ID
-func generateJWT(userID int, sessionID string) (string, error) {
-	expirationTime := time.Now().Add(15 * time.Minute) // 15-minute validity for AT
+// issueServiceToken starts a refresh-less session for a service account (client_credentials grant)
+func issueServiceToken(clientID, scope string, cnf *Confirmation) (TokensResponse, error) {
+	sessionID := uuid.New().String()
+	sess := Session{ClientID: clientID, Scope: scope, PrincipalType: PrincipalService, Cnf: cnf}
+	accessTTL, _ := tokenLifetimes(sess)
+
+	accessToken, err := generateJWT(sessionID, sess, accessTTL)
+	if err != nil {
+		return TokensResponse{}, err
+	}
+
+	// The session only lives as long as the AT so ValidateToken can still revoke it
+	if err := saveSession(RedisClient.Context(), sessionID, sess, accessTTL); err != nil {
+		return TokensResponse{}, fmt.Errorf("failed to save service session to redis: %w", err)
+	}
+	return TokensResponse{AccessToken: accessToken, ExpiresIn: int(accessTTL.Seconds())}, nil
+}
+
+// generateJWT creates a signed JWT for the given session, valid for ttl
+func generateJWT(sessionID string, sess Session, ttl time.Duration) (string, error) {
+	expirationTime := time.Now().Add(ttl)
+
+	audience := sess.Audience
+	if len(audience) == 0 {
+		audience = defaultAudience()
+	}
 
 	claims := &Claims{
-		UserID:    userID,
-		SessionID: sessionID,
+		UserID:        sess.UserID,
+		SessionID:     sessionID,
+		PrincipalType: sess.principalType(),
+		ClientID:      sess.ClientID,
+		Scope:         sess.Scope,
+		Act:           sess.Actor,
+		Cnf:           sess.Cnf,
+		Roles:         sess.Roles,
+		Permissions:   sess.Permissions,
+		OrgID:         sess.OrgID,
+		Impersonation: sess.ImpersonatorID != 0,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuerURL(),
+			Subject:   sess.subject(),
+			Audience:  audience,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   "access_token",
+			ID:        uuid.New().String(),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(SecretKey))
 }
+
+// defaultAudience is the aud of tokens not restricted by token exchange, from the
+// comma-separated ACCESS_TOKEN_AUDIENCE. Unset means no aud claim.
+func defaultAudience() []string {
+	var audience []string
+	for _, a := range strings.Split(os.Getenv("ACCESS_TOKEN_AUDIENCE"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			audience = append(audience, a)
+		}
+	}
+	return audience
+}
+
+// parseAccessToken verifies the signature, issuer and expiry of an access token and returns its claims
+func parseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(SecretKey), nil
+	}, jwt.WithIssuer(issuerURL()))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("token is not valid")
+	}
+
+	return claims, nil
+}
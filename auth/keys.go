@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+)
+
+// --- Asymmetric signing keys (ID tokens and anything third parties must verify) ---
+
+// SigningKey is the RSA key used for RS256 signatures; SigningKeyID is its JWK thumbprint
+var SigningKey *rsa.PrivateKey
+var SigningKeyID string
+
+// JWK is a public JSON Web Key as published on the JWKS endpoint
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set, e.g. the keys a client registered for private_key_jwt
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Find returns the key with the given kid, or the only key when kid is empty
+func (s JWKSet) Find(kid string) (JWK, bool) {
+	if kid == "" && len(s.Keys) == 1 {
+		return s.Keys[0], true
+	}
+	for _, k := range s.Keys {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return JWK{}, false
+}
+
+// PublicKey converts an RSA or EC (P-256/P-384) JWK into a Go public key
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("EC point is not on curve %s", k.Crv)
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// loadSigningKey reads the PEM key from OIDC_SIGNING_KEY_FILE, or generates an
+// ephemeral key when unset (tokens will not survive a restart).
+func loadSigningKey() error {
+	path := os.Getenv("OIDC_SIGNING_KEY_FILE")
+	if path == "" {
+		log.Println("OIDC_SIGNING_KEY_FILE is not set, generating an ephemeral RSA signing key.")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		setSigningKey(key)
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("signing key file %s is not PEM encoded", path)
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed interface{}
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				err = fmt.Errorf("signing key is not an RSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	setSigningKey(key)
+	return nil
+}
+
+func setSigningKey(key *rsa.PrivateKey) {
+	SigningKey = key
+	SigningKeyID = rsaThumbprint(&key.PublicKey)
+}
+
+// publicJWK converts an RSA public key to its JWK representation
+func publicJWK(pub *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// rsaThumbprint computes the RFC 7638 JWK thumbprint of an RSA public key
+func rsaThumbprint(pub *rsa.PublicKey) string {
+	return publicJWK(pub).Thumbprint()
+}
+
+// Thumbprint computes the RFC 7638 SHA-256 thumbprint of the key
+func (k JWK) Thumbprint() string {
+	// Required members only, in lexicographic order
+	var canonical string
+	switch k.Kty {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, k.Crv, k.X, k.Y)
+	default:
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, k.E, k.N)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKSHandler publishes the public signing keys
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	jwk := publicJWK(&SigningKey.PublicKey)
+	jwk.Use = "sig"
+	jwk.Alg = "RS256"
+	jwk.Kid = SigningKeyID
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(map[string][]JWK{"keys": {jwk}})
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// --- OIDC RP-Initiated, Back-Channel and Front-Channel Logout ---
+
+const (
+	backchannelLogoutEvent   = "http://schemas.openid.net/event/backchannel-logout"
+	logoutTokenTTL           = 2 * time.Minute
+	backchannelLogoutTimeout = 5 * time.Second
+	backchannelLogoutRetries = 5                // Attempts per delivery, with exponential backoff starting at 1s
+	backchannelLogoutWorkers = 8                // Deliveries in flight per instance
+	backchannelLogoutLease   = 30 * time.Second // A claimed delivery is retried if not finished by then
+	backchannelLogoutPoll    = time.Second
+)
+
+// backchannelLogoutQueueKey holds pending deliveries scored by the Unix time they are due.
+// Key: backchannel_logout_queue, a sorted set of JSON backchannelDelivery
+const backchannelLogoutQueueKey = "backchannel_logout_queue"
+
+var backchannelClient = &http.Client{Timeout: backchannelLogoutTimeout}
+
+// LogoutTokenClaims defines the payload of a back-channel logout token
+type LogoutTokenClaims struct {
+	Events map[string]struct{} `json:"events"`
+	SID    string              `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// LoggedOutClient is a client whose sessions ended with the browser session
+type LoggedOutClient struct {
+	Client *OAuthClient
+	UserID int
+}
+
+// endOIDCSession ends the browser login identified by sid, revokes every session
+// started from it and notifies the affected clients over the back channel. It returns the
+// clients so the caller can render front-channel logout.
+func endOIDCSession(ctx context.Context, sid string) ([]LoggedOutClient, error) {
+	// 1. The browser session itself, so the next authorization request asks for a login
+	if ssoID, err := RedisClient.GetDel(ctx, ssoSIDKey(sid)).Result(); err == nil {
+		RedisClient.Del(ctx, ssoKey(ssoID))
+	}
+
+	// 2. Every session that shares the sid
+	sessionIDs, err := RedisClient.SMembers(ctx, ssoSessionsKey(sid)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var loggedOut []LoggedOutClient
+	for _, sessionID := range sessionIDs {
+		sess, err := loadSession(ctx, sessionID)
+		if err == ErrSessionNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if err := deleteSession(ctx, sessionID, sess); err != nil {
+			return nil, err
+		}
+
+		if sess.ClientID == "" || seen[sess.ClientID] {
+			continue
+		}
+		seen[sess.ClientID] = true
+
+		client, err := getOAuthClient(sess.ClientID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		loggedOut = append(loggedOut, LoggedOutClient{Client: client, UserID: sess.UserID})
+	}
+	RedisClient.Del(ctx, ssoSessionsKey(sid))
+
+	// 3. Back-channel delivery happens in the background so logout never waits on a client
+	for _, lc := range loggedOut {
+		if lc.Client.BackchannelLogoutURI.Valid {
+			if err := enqueueBackchannelLogout(ctx, lc.Client.ClientID, lc.UserID, sid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return loggedOut, nil
+}
+
+// notifySessionRevoked queues back-channel logout for the client of a user session ended
+// outside a browser logout, such as by token revocation, as endOIDCSession does for the
+// sessions it ends
+func notifySessionRevoked(ctx context.Context, client *OAuthClient, sess *Session) error {
+	if !client.BackchannelLogoutURI.Valid || sess.principalType() != PrincipalUser {
+		return nil
+	}
+	return enqueueBackchannelLogout(ctx, client.ClientID, sess.UserID, sess.SID)
+}
+
+// generateLogoutToken signs an OIDC Back-Channel Logout token for one client
+func generateLogoutToken(client *OAuthClient, userID int, sid string) (string, error) {
+	now := time.Now()
+	claims := &LogoutTokenClaims{
+		Events: map[string]struct{}{backchannelLogoutEvent: {}},
+		SID:    sid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuerURL(),
+			Subject:   strconv.Itoa(userID),
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(logoutTokenTTL)),
+			ID:        uuid.New().String(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = SigningKeyID
+	token.Header["typ"] = "logout+jwt"
+	return token.SignedString(SigningKey)
+}
+
+// backchannelDelivery is one logout token waiting to be sent
+type backchannelDelivery struct {
+	ID       string `json:"id"` // Keeps identical deliveries distinct in the queue
+	ClientID string `json:"client_id"`
+	UserID   int    `json:"user_id"`
+	SID      string `json:"sid,omitempty"`
+	Attempt  int    `json:"attempt"` // Attempts already made
+}
+
+// enqueueBackchannelLogout schedules a logout token for the client. The queue lives in
+// Redis, so deliveries pending or awaiting a retry survive a restart.
+func enqueueBackchannelLogout(ctx context.Context, clientID string, userID int, sid string) error {
+	data, _ := json.Marshal(backchannelDelivery{ID: uuid.New().String(), ClientID: clientID, UserID: userID, SID: sid})
+	return RedisClient.ZAdd(ctx, backchannelLogoutQueueKey, &redis.Z{Score: float64(time.Now().Unix()), Member: string(data)}).Err()
+}
+
+// claimDueDeliveries takes up to ARGV[3] deliveries due by ARGV[1] and pushes them back to
+// ARGV[2], so another instance picks them up if this one stops before finishing
+var claimDueDeliveries = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, member in ipairs(due) do
+	redis.call('ZADD', KEYS[1], ARGV[2], member)
+end
+return due`)
+
+// runBackchannelLogoutWorker delivers queued logout tokens until the process exits
+func runBackchannelLogoutWorker() {
+	ticker := time.NewTicker(backchannelLogoutPoll)
+	defer ticker.Stop()
+	for range ticker.C {
+		processBackchannelLogouts(context.Background())
+	}
+}
+
+// processBackchannelLogouts sends one batch of due deliveries, at most
+// backchannelLogoutWorkers at a time
+func processBackchannelLogouts(ctx context.Context) {
+	now := time.Now()
+	due, err := claimDueDeliveries.Run(ctx, RedisClient, []string{backchannelLogoutQueueKey},
+		now.Unix(), now.Add(backchannelLogoutLease).Unix(), backchannelLogoutWorkers).StringSlice()
+	if err != nil && err != redis.Nil {
+		log.Printf("Redis error claiming back-channel logouts: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, member := range due {
+		wg.Add(1)
+		go func(member string) {
+			defer wg.Done()
+			deliverBackchannelLogout(ctx, member)
+		}(member)
+	}
+	wg.Wait()
+}
+
+// deliverBackchannelLogout sends a claimed delivery, then removes it or schedules its retry
+func deliverBackchannelLogout(ctx context.Context, member string) {
+	var d backchannelDelivery
+	if err := json.Unmarshal([]byte(member), &d); err != nil {
+		log.Printf("Dropping corrupt back-channel logout delivery: %v", err)
+		RedisClient.ZRem(ctx, backchannelLogoutQueueKey, member)
+		return
+	}
+
+	err := sendBackchannelLogout(d)
+	d.Attempt++
+	pipe := RedisClient.TxPipeline()
+	pipe.ZRem(ctx, backchannelLogoutQueueKey, member)
+	if err != nil {
+		log.Printf("Back-channel logout to client %s failed (attempt %d/%d): %v",
+			d.ClientID, d.Attempt, backchannelLogoutRetries, err)
+		if d.Attempt < backchannelLogoutRetries {
+			backoff := time.Second << (d.Attempt - 1)
+			data, _ := json.Marshal(d)
+			pipe.ZAdd(ctx, backchannelLogoutQueueKey, &redis.Z{Score: float64(time.Now().Add(backoff).Unix()), Member: string(data)})
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Redis error updating back-channel logout queue: %v", err)
+	}
+}
+
+// sendBackchannelLogout POSTs a fresh logout token to the client. Clients deleted or no
+// longer registered for back-channel logout since the delivery was queued are skipped.
+func sendBackchannelLogout(d backchannelDelivery) error {
+	client, err := getOAuthClient(d.ClientID)
+	if err == sql.ErrNoRows || (err == nil && !client.BackchannelLogoutURI.Valid) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to load client: %w", err)
+	}
+
+	logoutToken, err := generateLogoutToken(client, d.UserID, d.SID)
+	if err != nil {
+		return fmt.Errorf("failed to generate logout token: %w", err)
+	}
+	resp, err := backchannelClient.PostForm(client.BackchannelLogoutURI.String, url.Values{"logout_token": {logoutToken}})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// frontchannelLogoutURL is the iframe URL that clears the client's own session cookie
+func frontchannelLogoutURL(client *OAuthClient, sid string) string {
+	if !client.FrontchannelLogoutSessionRequired {
+		return client.FrontchannelLogoutURI.String
+	}
+
+	u, err := url.Parse(client.FrontchannelLogoutURI.String)
+	if err != nil {
+		return client.FrontchannelLogoutURI.String
+	}
+	q := u.Query()
+	q.Set("iss", issuerURL())
+	q.Set("sid", sid)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// parseIDTokenHint verifies an ID token we issued. Expired tokens are accepted as hints;
+// EndSessionHandler asks the user to confirm logouts that carry one.
+func parseIDTokenHint(hint string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(hint, claims, func(token *jwt.Token) (interface{}, error) {
+		return &SigningKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Issuer != issuerURL() || len(claims.Audience) == 0 {
+		return nil, fmt.Errorf("id_token_hint was not issued by this provider")
+	}
+	return claims, nil
+}
+
+var logoutConfirmTemplate = template.Must(template.New("logout-confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign out</title></head>
+<body>
+  <h1>Sign out?</h1>
+  <form method="POST" action="/oauth/logout">
+    {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+    {{end}}<input type="hidden" name="confirm" value="yes">
+    <button type="submit">Sign out</button>
+  </form>
+</body>
+</html>`))
+
+var loggedOutTemplate = template.Must(template.New("logged-out").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Signed out</title></head>
+<body>
+  <h1>You have been signed out</h1>
+  {{range .FrontchannelURLs}}<iframe src="{{.}}" style="display:none"></iframe>
+  {{end}}{{if .RedirectURI}}<p><a href="{{.RedirectURI}}">Continue</a></p>
+  <script>window.addEventListener("load", function () { window.location.replace({{.RedirectURI}}); });</script>{{end}}
+</body>
+</html>`))
+
+// logoutCSRFToken binds a logout confirmation to the browser session it ends
+func logoutCSRFToken(sso *SSOSession) string {
+	mac := hmac.New(sha256.New, []byte(SecretKey))
+	mac.Write([]byte("logout\x00" + sso.ID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isLogoutConfirmation reports whether the request is a submission of the logout
+// confirmation form, made from the browser session it ends
+func isLogoutConfirmation(r *http.Request, sso *SSOSession) bool {
+	if r.Method != http.MethodPost || r.PostForm.Get("confirm") != "yes" {
+		return false
+	}
+	return hmac.Equal([]byte(r.PostForm.Get("logout_csrf")), []byte(logoutCSRFToken(sso)))
+}
+
+// logoutParams are carried through the confirmation form back to /oauth/logout
+var logoutParams = []string{"id_token_hint", "client_id", "post_logout_redirect_uri", "state"}
+
+// EndSessionHandler implements OIDC RP-Initiated Logout. It ends the browser session,
+// revokes every session started from it, and notifies the clients that took part.
+func EndSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// 1. Identify the client from the ID token hint or client_id
+	clientID := r.Form.Get("client_id")
+	var hint *IDTokenClaims
+	if raw := r.Form.Get("id_token_hint"); raw != "" {
+		var err error
+		if hint, err = parseIDTokenHint(raw); err != nil {
+			http.Error(w, "Invalid id_token_hint", http.StatusBadRequest)
+			return
+		}
+		if clientID != "" && !containsString(hint.Audience, clientID) {
+			http.Error(w, "client_id does not match id_token_hint", http.StatusBadRequest)
+			return
+		}
+		clientID = hint.Audience[0]
+	}
+
+	// 2. Only registered post-logout redirect URIs may be used
+	redirectURI := r.Form.Get("post_logout_redirect_uri")
+	if redirectURI != "" {
+		if clientID == "" {
+			http.Error(w, "post_logout_redirect_uri requires id_token_hint or client_id", http.StatusBadRequest)
+			return
+		}
+		client, err := getOAuthClient(clientID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Unknown client_id", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Database error loading OAuth client: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !containsString(client.PostLogoutRedirectURIs, redirectURI) {
+			http.Error(w, "post_logout_redirect_uri is not registered for this client", http.StatusBadRequest)
+			return
+		}
+		if state := r.Form.Get("state"); state != "" {
+			u, _ := url.Parse(redirectURI)
+			q := u.Query()
+			q.Set("state", state)
+			u.RawQuery = q.Encode()
+			redirectURI = u.String()
+		}
+	}
+
+	// 3. Only an unexpired hint for this browser's own session logs out without asking. Any
+	// other request may be forged or replay an old or leaked hint, so the user must confirm.
+	// Without a browser session there is nothing of this browser's to end.
+	sso, loggedIn := currentSSOSession(r)
+	if loggedIn && hint != nil && hint.SID != sso.SID {
+		http.Error(w, "id_token_hint does not belong to the current session", http.StatusBadRequest)
+		return
+	}
+	trusted := hint != nil && hint.ExpiresAt != nil && time.Now().Before(hint.ExpiresAt.Time)
+	if loggedIn && !trusted && !isLogoutConfirmation(r, sso) {
+		params := map[string]string{"logout_csrf": logoutCSRFToken(sso)}
+		for _, name := range logoutParams {
+			if v := r.Form.Get(name); v != "" {
+				params[name] = v
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := logoutConfirmTemplate.Execute(w, map[string]interface{}{"Params": params}); err != nil {
+			log.Printf("Error rendering logout confirmation: %v", err)
+		}
+		return
+	}
+
+	// 4. End the browser session and every session started from it. A hint alone never ends
+	// a session: anyone holding one of the user's ID tokens could log them out everywhere.
+	var frontchannelURLs []string
+	sid := ""
+	if loggedIn {
+		sid = sso.SID
+		RedisClient.Del(r.Context(), ssoKey(sso.ID)) // Sessions from before sids existed have no sso_sid entry
+	}
+	http.SetCookie(w, &http.Cookie{Name: ssoCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+
+	if sid != "" {
+		loggedOut, err := endOIDCSession(r.Context(), sid)
+		if err != nil {
+			log.Printf("Error ending OIDC session %s: %v", sid, err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		for _, lc := range loggedOut {
+			if lc.Client.FrontchannelLogoutURI.Valid {
+				frontchannelURLs = append(frontchannelURLs, frontchannelLogoutURL(lc.Client, sid))
+			}
+		}
+	}
+
+	// 5. Without front-channel clients we can redirect straight away
+	if len(frontchannelURLs) == 0 && redirectURI != "" {
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	data := map[string]interface{}{"FrontchannelURLs": frontchannelURLs, "RedirectURI": redirectURI}
+	if err := loggedOutTemplate.Execute(w, data); err != nil {
+		log.Printf("Error rendering logout page: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -14,7 +15,6 @@ import (
 	proto "hydraauth/auth/pb/authpb" // Import the generated protobuf package
 
 	"github.com/go-redis/redis/v8" // Using v8 context methods
-	"github.com/golang-jwt/jwt/v5" // Using the V5 JWT package
 	_ "github.com/lib/pq"
 	"google.golang.org/grpc"
 )
@@ -59,7 +59,13 @@ func main() {
 	}
 	log.Println("Successfully connected to Redis!")
 
-	// --- 3. Run Servers Concurrently ---
+	// --- 3. Signing Keys (OIDC ID tokens) ---
+	if err := loadSigningKey(); err != nil {
+		log.Fatalf("Could not load signing key: %v", err)
+	}
+	log.Printf("Loaded RS256 signing key (kid %s)", SigningKeyID)
+
+	// --- 4. Run Servers Concurrently ---
 	var wg sync.WaitGroup
 
 	// Start HTTP Server
@@ -80,6 +86,12 @@ func main() {
 		}
 	}()
 
+	// Expire temporary role elevations in the background
+	go runElevationSweeper()
+
+	// Deliver queued back-channel logout tokens, retrying failures
+	go runBackchannelLogoutWorker()
+
 	wg.Wait()
 }
 
@@ -90,6 +102,109 @@ func runHTTPServer() error {
 	router.HandleFunc("/auth/register", RegisterHandler)
 	router.HandleFunc("/auth/login", LoginHandler)
 	router.HandleFunc("/auth/refresh", RefreshHandler)
+	router.HandleFunc("POST /auth/switch-org", SwitchOrgHandler)
+
+	// OAuth 2.0 Authorization Server (see oauth.go)
+	router.HandleFunc("/oauth/authorize", AuthorizeHandler)
+	router.HandleFunc("/oauth/token", TokenHandler)
+	router.HandleFunc("/oauth/device_authorization", DeviceAuthorizationHandler)
+	router.HandleFunc("/oauth/device", DeviceVerificationHandler)
+	router.HandleFunc("/oauth/introspect", IntrospectHandler)
+	router.HandleFunc("/oauth/revoke", RevokeHandler)
+	router.HandleFunc("/oauth/par", PushedAuthorizationHandler)
+	router.HandleFunc("/oauth/logout", EndSessionHandler)
+	router.HandleFunc("POST /oauth/register", RegisterClientHandler)
+	router.HandleFunc("/oauth/register/{client_id}", ClientConfigurationHandler)
+
+	// Admin API (see admin.go)
+	router.HandleFunc("GET /admin/clients", requireAdmin(AdminListClientsHandler))
+	router.HandleFunc("POST /admin/clients", requireAdmin(AdminCreateClientHandler))
+	router.HandleFunc("GET /admin/clients/{client_id}", requireAdmin(AdminGetClientHandler))
+	router.HandleFunc("PUT /admin/clients/{client_id}", requireAdmin(AdminUpdateClientHandler))
+	router.HandleFunc("DELETE /admin/clients/{client_id}", requireAdmin(AdminDeleteClientHandler))
+	router.HandleFunc("POST /admin/clients/{client_id}/secrets", requireAdmin(AdminRotateClientSecretHandler))
+	router.HandleFunc("POST /admin/initial-access-tokens", requireAdmin(AdminCreateInitialAccessTokenHandler))
+	router.HandleFunc("DELETE /admin/sessions/{sid}", requireAdmin(AdminEndSessionHandler))
+
+	// Role-based access control (see rbac.go)
+	router.HandleFunc("GET /admin/roles", requireAdmin(AdminListRolesHandler))
+	router.HandleFunc("POST /admin/roles", requireAdmin(AdminCreateRoleHandler))
+	router.HandleFunc("GET /admin/roles/{role}", requireAdmin(AdminGetRoleHandler))
+	router.HandleFunc("DELETE /admin/roles/{role}", requireAdmin(AdminDeleteRoleHandler))
+	router.HandleFunc("PUT /admin/roles/{role}/permissions/{permission}", requireAdmin(AdminGrantPermissionHandler))
+	router.HandleFunc("DELETE /admin/roles/{role}/permissions/{permission}", requireAdmin(AdminRevokePermissionHandler))
+	router.HandleFunc("GET /admin/permissions", requireAdmin(AdminListPermissionsHandler))
+	router.HandleFunc("POST /admin/permissions", requireAdmin(AdminCreatePermissionHandler))
+	router.HandleFunc("DELETE /admin/permissions/{permission}", requireAdmin(AdminDeletePermissionHandler))
+	router.HandleFunc("GET /admin/users/{user_id}/roles", requireAdmin(AdminListUserRolesHandler))
+	router.HandleFunc("PUT /admin/users/{user_id}/roles/{role}", requireAdmin(AdminAssignRoleHandler))
+	router.HandleFunc("DELETE /admin/users/{user_id}/roles/{role}", requireAdmin(AdminUnassignRoleHandler))
+	router.HandleFunc("POST /admin/users/{user_id}/impersonate", requireAdmin(AdminImpersonateHandler))
+	router.HandleFunc("GET /admin/impersonations", requireAdmin(AdminListImpersonationsHandler))
+	router.HandleFunc("DELETE /admin/impersonations/{session_id}", requireAdmin(AdminEndImpersonationHandler))
+	router.HandleFunc("POST /admin/clients/{client_id}/api-keys", requireAdmin(AdminCreateServiceAPIKeyHandler))
+	router.HandleFunc("GET /admin/api-keys", requireAdmin(AdminListAPIKeysHandler))
+	router.HandleFunc("DELETE /admin/api-keys/{id}", requireAdmin(AdminRevokeAPIKeyHandler))
+	router.HandleFunc("GET /admin/roles/{role}/elevation", requireAdmin(AdminGetElevationPolicyHandler))
+	router.HandleFunc("PUT /admin/roles/{role}/elevation", requireAdmin(AdminPutElevationPolicyHandler))
+	router.HandleFunc("DELETE /admin/roles/{role}/elevation", requireAdmin(AdminDeleteElevationPolicyHandler))
+	router.HandleFunc("GET /admin/elevations", requireAdmin(AdminListElevationsHandler))
+	router.HandleFunc("GET /admin/elevations/{id}", requireAdmin(AdminGetElevationHandler))
+	router.HandleFunc("POST /admin/elevations/{id}/approve", requireAdmin(AdminApproveElevationHandler))
+	router.HandleFunc("POST /admin/elevations/{id}/deny", requireAdmin(AdminDenyElevationHandler))
+	router.HandleFunc("POST /admin/elevations/{id}/revoke", requireAdmin(AdminRevokeElevationHandler))
+
+	// Organizations, members and org-scoped roles (see organizations.go)
+	router.HandleFunc("GET /admin/organizations", requireAdmin(AdminListOrganizationsHandler))
+	router.HandleFunc("POST /admin/organizations", requireAdmin(AdminCreateOrganizationHandler))
+	router.HandleFunc("GET /admin/organizations/{org}", requireAdmin(AdminGetOrganizationHandler))
+	router.HandleFunc("PUT /admin/organizations/{org}", requireAdmin(AdminUpdateOrganizationHandler))
+	router.HandleFunc("DELETE /admin/organizations/{org}", requireAdmin(AdminDeleteOrganizationHandler))
+	router.HandleFunc("PUT /admin/organizations/{org}/members/{user_id}", requireAdmin(AdminAddOrgMemberHandler))
+	router.HandleFunc("DELETE /admin/organizations/{org}/members/{user_id}", requireAdmin(AdminRemoveOrgMemberHandler))
+	router.HandleFunc("PUT /admin/organizations/{org}/members/{user_id}/roles/{role}", requireAdmin(AdminAssignOrgRoleHandler))
+	router.HandleFunc("DELETE /admin/organizations/{org}/members/{user_id}/roles/{role}", requireAdmin(AdminUnassignOrgRoleHandler))
+	router.HandleFunc("GET /admin/organizations/{org}/invitations", requireAdmin(AdminListInvitationsHandler))
+	router.HandleFunc("POST /admin/organizations/{org}/invitations", requireAdmin(AdminCreateInvitationHandler))
+	router.HandleFunc("DELETE /admin/organizations/{org}/invitations/{id}", requireAdmin(AdminRevokeInvitationHandler))
+	router.HandleFunc("GET /admin/organizations/{org}/settings", requireAdmin(AdminGetTenantSettingsHandler))
+	router.HandleFunc("PUT /admin/organizations/{org}/settings", requireAdmin(AdminPutTenantSettingsHandler))
+	router.HandleFunc("DELETE /admin/organizations/{org}/settings", requireAdmin(AdminResetTenantSettingsHandler))
+
+	// Attribute-based policies evaluated by CheckPermission (see policy.go)
+	router.HandleFunc("GET /admin/policies", requireAdmin(AdminListPoliciesHandler))
+	router.HandleFunc("GET /admin/policies/{name}", requireAdmin(AdminGetPolicyHandler))
+	router.HandleFunc("PUT /admin/policies/{name}", requireAdmin(AdminPutPolicyHandler))
+	router.HandleFunc("DELETE /admin/policies/{name}", requireAdmin(AdminDeletePolicyHandler))
+
+	// Relationship schema evaluated by the Relationships gRPC service (see rebac.go)
+	router.HandleFunc("GET /admin/rebac/schema", requireAdmin(AdminGetRebacSchemaHandler))
+	router.HandleFunc("PUT /admin/rebac/schema", requireAdmin(AdminPutRebacSchemaHandler))
+
+	// OpenID Connect Provider (see oidc.go, keys.go)
+	router.HandleFunc("/.well-known/openid-configuration", DiscoveryHandler)
+	router.HandleFunc("/.well-known/jwks.json", JWKSHandler)
+	router.HandleFunc("/userinfo", UserinfoHandler)
+
+	// Account API: apps the user has granted access to (see consent.go)
+	router.HandleFunc("GET /account/apps", ListGrantedAppsHandler)
+	router.HandleFunc("DELETE /account/apps/{client_id}", RevokeGrantedAppHandler)
+	router.HandleFunc("GET /account/organizations", ListMyOrganizationsHandler)
+	router.HandleFunc("POST /account/invitations/accept", AcceptInvitationHandler)
+	router.HandleFunc("POST /account/mfa/totp", EnrollTOTPHandler)
+	router.HandleFunc("POST /account/mfa/totp/confirm", ConfirmTOTPHandler)
+	router.HandleFunc("DELETE /account/mfa/totp", DisableTOTPHandler)
+	router.HandleFunc("POST /account/elevations", RequestElevationHandler)
+	router.HandleFunc("GET /account/elevations", ListMyElevationsHandler)
+	router.HandleFunc("DELETE /account/elevations/{id}", CancelElevationHandler)
+	router.HandleFunc("POST /account/api-keys", CreatePersonalAPIKeyHandler)
+	router.HandleFunc("GET /account/api-keys", ListPersonalAPIKeysHandler)
+	router.HandleFunc("DELETE /account/api-keys/{id}", RevokePersonalAPIKeyHandler)
+	router.HandleFunc("POST /account/capabilities", IssueCapabilityHandler)
+	router.HandleFunc("GET /account/capabilities", ListCapabilitiesHandler)
+	router.HandleFunc("DELETE /account/capabilities/{id}", RevokeCapabilityHandler)
+	router.HandleFunc("POST /capabilities/attenuate", AttenuateCapabilityHandler)
+	router.HandleFunc("GET /invitations/{token}", GetInvitationHandler)
 
 	port := os.Getenv("AUTH_SERVICE_PORT")
 	if port == "" {
@@ -105,11 +220,24 @@ func runHTTPServer() error {
 		IdleTimeout:  15 * time.Second,
 	}
 
+	// Optional TLS, required for mTLS client authentication and certificate-bound tokens
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile != "" {
+		tlsConfig, err := loadTLSConfig()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+
+		fmt.Printf("HTTPS Auth Service listening on %s...\n", listenAddr)
+		return server.ListenAndServeTLS(certFile, keyFile)
+	}
+
 	fmt.Printf("HTTP Auth Service listening on %s...\n", listenAddr)
 	return server.ListenAndServe()
 }
 
-// runGRPCServer starts the internal gRPC server (ValidateToken)
+// runGRPCServer starts the internal gRPC server (AuthValidation and Relationships)
 func runGRPCServer() error {
 	grpcPort := os.Getenv("GRPC_AUTH_PORT")
 	if grpcPort == "" {
@@ -125,6 +253,7 @@ func runGRPCServer() error {
 
 	// Register the AuthValidation server implementation
 	proto.RegisterAuthValidationServer(grpcServer, &AuthValidationServer{})
+	proto.RegisterRelationshipsServer(grpcServer, &RelationshipsServer{})
 
 	fmt.Printf("gRPC Auth Service listening on :%s...\n", grpcPort)
 	return grpcServer.Serve(lis)
@@ -138,48 +267,88 @@ type AuthValidationServer struct {
 
 // ValidateToken implements the rpc from the proto file
 func (s *AuthValidationServer) ValidateToken(ctx context.Context, req *proto.ValidateTokenRequest) (*proto.ValidateTokenResponse, error) {
-	// 1. Stateless JWT Validation (Signature and Expiry)
-	// NOTE: Claims and SecretKey must be accessible (from jwt.go)
-	claims := &Claims{}
-
-	token, err := jwt.ParseWithClaims(req.Token, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(SecretKey), nil
-	})
-
-	if err != nil || !token.Valid {
+	// 1-4. Signature, binding, audience and session (see validateTokenRequest)
+	claims, errMsg := validateTokenRequest(ctx, req)
+	if claims == nil {
 		return &proto.ValidateTokenResponse{
 			IsValid: false,
-			Error:   "Token is invalid or expired: " + err.Error(),
+			Error:   errMsg,
 		}, nil
 	}
 
-	// 2. Stateful Session Check (Required for device limit/revocation)
-	redisKey := fmt.Sprintf("session:%s", claims.SessionID)
-
-	// Check for existence of the session in Redis
-	_, err = RedisClient.Get(ctx, redisKey).Result()
+	// 5. Successful Validation
+	principalType := proto.PrincipalType_PRINCIPAL_TYPE_USER
+	if claims.PrincipalType == PrincipalService {
+		principalType = proto.PrincipalType_PRINCIPAL_TYPE_SERVICE
+	}
 
-	if err == redis.Nil {
-		// Session revoked or timed out
-		return &proto.ValidateTokenResponse{
-			IsValid: false,
-			Error:   "Session revoked or not active (SessionID not found in Redis).",
-		}, nil
-	} else if err != nil {
-		log.Printf("Redis check error: %v", err)
-		return &proto.ValidateTokenResponse{
-			IsValid: false,
-			Error:   "Internal server error during session check.",
-		}, nil
+	actor := ""
+	if claims.Act != nil {
+		actor = claims.Act.Sub
 	}
 
-	// 3. Successful Validation
 	return &proto.ValidateTokenResponse{
-		IsValid: true,
-		UserId:  int32(claims.UserID),
-		Error:   "",
+		IsValid:       true,
+		UserId:        int32(claims.UserID),
+		Error:         "",
+		PrincipalType: principalType,
+		ClientId:      claims.ClientID,
+		Scope:         claims.Scope,
+		Audience:      claims.Audience,
+		Actor:         actor,
+		Subject:       claims.Subject,
+		Issuer:        claims.Issuer,
+		Roles:         claims.Roles,
+		Permissions:   claims.Permissions,
+		OrgId:         int32(claims.OrgID),
+		Impersonation: claims.Impersonation,
+		ApiKeyId:      claims.APIKeyID,
 	}, nil
 }
+
+// validateTokenRequest runs the ValidateToken checks shared by every RPC that takes a token.
+// It returns the token's claims, or nil and the reason the token was rejected.
+func validateTokenRequest(ctx context.Context, req *proto.ValidateTokenRequest) (*Claims, string) {
+	if req == nil {
+		return nil, "Token is required"
+	}
+	if isAPIKey(req.Token) {
+		return validateAPIKey(req.Token, req.ExpectedAudience)
+	}
+
+	// 1. Stateless JWT Validation (Signature, Issuer and Expiry)
+	claims, err := parseAccessToken(req.Token)
+	if err != nil {
+		return nil, "Token is invalid or expired: " + err.Error()
+	}
+
+	// 2. Sender-constrained tokens must come with a proof of possession
+	presentation := TokenPresentation{
+		DPoPProof:  req.DpopProof,
+		Method:     req.HttpMethod,
+		URL:        req.HttpUrl,
+		ClientCert: req.ClientCertificate,
+	}
+	if err := verifyTokenBinding(ctx, claims, req.Token, presentation); err != nil {
+		return nil, "Token binding check failed: " + err.Error()
+	}
+
+	// 3. The token must be meant for the caller
+	if req.ExpectedAudience != "" && !audienceIncludes(claims.Audience, req.ExpectedAudience) {
+		return nil, "Token audience does not include " + req.ExpectedAudience
+	}
+
+	// 4. Stateful Session Check: revocation, organization, its settings and temporary roles
+	sess, err := loadTokenSession(ctx, claims)
+	var invalid *InvalidTokenError
+	if errors.As(err, &invalid) {
+		return nil, invalid.Reason + "."
+	} else if err != nil {
+		log.Printf("Session check error: %v", err)
+		return nil, "Internal server error during session check."
+	}
+	if sess.ImpersonatorID != 0 {
+		logImpersonatedUse(claims.SessionID, sess, "validated for audience "+req.ExpectedAudience)
+	}
+	return claims, ""
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// --- Multi-factor authentication: TOTP (RFC 6238) ---
+
+const (
+	totpPeriod = 30 // Seconds per code
+	totpDigits = 6
+	totpSkew   = 1 // Codes from one period either side are accepted for clock drift
+
+	totpMaxFailures = 5                // Wrong codes accepted before the user's codes are locked
+	totpLockout     = 15 * time.Minute // Counted from the first wrong code
+)
+
+// Authentication method references (RFC 8176) recorded on sessions
+const (
+	amrPassword = "pwd"
+	amrOTP      = "otp"
+)
+
+// errMFARequired is returned when the user has a second factor but sent no code
+var errMFARequired = errors.New("one-time code required")
+
+// errTOTPLocked is returned while a user has sent too many wrong codes
+var errTOTPLocked = errors.New("too many invalid one-time codes")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpUsedKey remembers an accepted code so it cannot be replayed within its window
+// Key: totp_used:{userID}:{counter}
+func totpUsedKey(userID int, counter int64) string {
+	return fmt.Sprintf("totp_used:%d:%d", userID, counter)
+}
+
+// totpFailuresKey counts wrong codes, so the million possible codes cannot be tried out
+// Key: totp_failures:{userID}
+func totpFailuresKey(userID int) string {
+	return fmt.Sprintf("totp_failures:%d", userID)
+}
+
+// totpCode computes the code for one time step (RFC 4226 dynamic truncation)
+func totpCode(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP checks a code against the secret, accepting each time step only once per user.
+// It returns errInvalidCredentials for a wrong code, and errTOTPLocked without checking
+// once the user sent totpMaxFailures wrong codes within totpLockout.
+func verifyTOTP(ctx context.Context, userID int, encodedSecret, code string) error {
+	failures, err := RedisClient.Get(ctx, totpFailuresKey(userID)).Int()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if failures >= totpMaxFailures {
+		return errTOTPLocked
+	}
+
+	ok, err := matchTOTP(ctx, userID, encodedSecret, code)
+	if err != nil {
+		return err
+	}
+	if ok {
+		RedisClient.Del(ctx, totpFailuresKey(userID))
+		return nil
+	}
+
+	count, err := RedisClient.Incr(ctx, totpFailuresKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	if count == 1 {
+		RedisClient.Expire(ctx, totpFailuresKey(userID), totpLockout)
+	}
+	return errInvalidCredentials
+}
+
+// matchTOTP reports whether the code is current and was not accepted before
+func matchTOTP(ctx context.Context, userID int, encodedSecret, code string) (bool, error) {
+	secret, err := totpEncoding.DecodeString(encodedSecret)
+	if err != nil || len(code) != totpDigits {
+		return false, nil
+	}
+
+	now := time.Now().Unix() / totpPeriod
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) != 1 {
+			continue
+		}
+		return RedisClient.SetNX(ctx, totpUsedKey(userID, step), 1, (2*totpSkew+1)*totpPeriod*time.Second).Result()
+	}
+	return false, nil
+}
+
+// userTOTP returns the user's TOTP secret and whether enrollment was confirmed
+func userTOTP(userID int) (string, bool, error) {
+	var secret sql.NullString
+	var enabled bool
+	err := DB.QueryRow("SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1", userID).
+		Scan(&secret, &enabled)
+	return secret.String, enabled, err
+}
+
+// verifySecondFactor checks the one-time code of a user who just proved their password and
+// returns the session's authentication methods. Users without TOTP need no code.
+// Errors are those of verifyTOTP, or errMFARequired when the code is missing.
+func verifySecondFactor(ctx context.Context, userID int, code string) ([]string, error) {
+	secret, enabled, err := userTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return []string{amrPassword}, nil
+	}
+	if code == "" {
+		return nil, errMFARequired
+	}
+	if err := verifyTOTP(ctx, userID, secret, code); err != nil {
+		return nil, err
+	}
+	return []string{amrPassword, amrOTP}, nil
+}
+
+// --- Account API: TOTP enrollment ---
+
+// writeTOTPError answers an account request whose code verifyTOTP rejected
+func writeTOTPError(w http.ResponseWriter, err error) {
+	switch err {
+	case errInvalidCredentials:
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+	case errTOTPLocked:
+		http.Error(w, "Too many invalid codes; try again later", http.StatusTooManyRequests)
+	default:
+		log.Printf("Redis error verifying TOTP: %v", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+	}
+}
+
+// TOTPRequest carries a one-time code from the user's authenticator
+type TOTPRequest struct {
+	Code string `json:"code"`
+}
+
+// EnrollTOTPHandler generates a new secret for the user to add to an authenticator app.
+// It only takes effect once confirmed with a code.
+func EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+
+	_, enabled, err := userTOTP(sess.UserID)
+	if err != nil {
+		log.Printf("Database error loading TOTP: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "TOTP is already enabled; disable it before enrolling again", http.StatusConflict)
+		return
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		log.Printf("Failed to generate TOTP secret: %v", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	var email string
+	err = DB.QueryRow("UPDATE users SET totp_secret = $2 WHERE id = $1 RETURNING email", sess.UserID, secret).Scan(&email)
+	if err != nil {
+		log.Printf("Database error saving TOTP secret: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	issuer := issuerURL()
+	if u, err := url.Parse(issuer); err == nil && u.Host != "" {
+		issuer = u.Host
+	}
+	uri := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + issuer + ":" + email,
+		RawQuery: url.Values{"secret": {secret}, "issuer": {issuer}, "period": {fmt.Sprint(totpPeriod)}, "digits": {fmt.Sprint(totpDigits)}}.Encode()}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"secret": secret, "otpauth_uri": uri.String()})
+}
+
+// ConfirmTOTPHandler enables TOTP once the user proves their authenticator has the secret
+func ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var req TOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+
+	secret, enabled, err := userTOTP(sess.UserID)
+	if err != nil {
+		log.Printf("Database error loading TOTP: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled || secret == "" {
+		http.Error(w, "No TOTP enrollment is pending", http.StatusConflict)
+		return
+	}
+	if err := verifyTOTP(r.Context(), sess.UserID, secret, req.Code); err != nil {
+		writeTOTPError(w, err)
+		return
+	}
+
+	if _, err := DB.Exec("UPDATE users SET totp_enabled_at = NOW() WHERE id = $1", sess.UserID); err != nil {
+		log.Printf("Database error enabling TOTP: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d enabled TOTP", sess.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableTOTPHandler removes the user's second factor; a current code is required
+func DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var req TOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	sess := requireFirstPartySession(w, r)
+	if sess == nil {
+		return
+	}
+
+	secret, enabled, err := userTOTP(sess.UserID)
+	if err != nil {
+		log.Printf("Database error loading TOTP: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !enabled {
+		http.Error(w, "TOTP is not enabled", http.StatusNotFound)
+		return
+	}
+	if err := verifyTOTP(r.Context(), sess.UserID, secret, req.Code); err != nil {
+		writeTOTPError(w, err)
+		return
+	}
+
+	if _, err := DB.Exec("UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL WHERE id = $1", sess.UserID); err != nil {
+		log.Printf("Database error disabling TOTP: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d disabled TOTP", sess.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// --- Mutual TLS client authentication and certificate-bound tokens (RFC 8705) ---
+
+// loadTLSConfig builds the HTTP server's TLS configuration from TLS_CLIENT_CA_FILE.
+// Client certificates are optional, but when presented they must chain to that CA bundle.
+func loadTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	caFile := os.Getenv("TLS_CLIENT_CA_FILE")
+	if caFile == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
+}
+
+// peerCertificate returns the DER of the verified mTLS client certificate, or nil
+func peerCertificate(r *http.Request) []byte {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0].Raw
+}
+
+// certThumbprint is the base64url SHA-256 of a DER certificate (the x5t#S256 confirmation)
+func certThumbprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authenticateTLSClient checks a tls_client_auth client: the verified certificate's
+// subject DN must equal the one registered for the client.
+func authenticateTLSClient(r *http.Request, client *OAuthClient) error {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || !client.TLSClientAuthSubjectDN.Valid {
+		return errInvalidClient
+	}
+	if r.TLS.PeerCertificates[0].Subject.String() != client.TLSClientAuthSubjectDN.String {
+		return errInvalidClient
+	}
+	return nil
+}
@@ -0,0 +1,758 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// --- OAuth 2.0 Authorization Server (RFC 6749 + RFC 7636 PKCE) ---
+
+const (
+	authCodeTTL   = 5 * time.Minute // Authorization codes are single-use and short-lived
+	ssoSessionTTL = 24 * time.Hour  // Browser login session used by /oauth/authorize
+	ssoCookieName = "hydra_sso"
+)
+
+// OAuthClient defines the structure for a registered OAuth client record
+type OAuthClient struct {
+	ID           int
+	ClientID     string
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	GrantTypes   []string
+	// TokenEndpointAuthMethod is client_secret_basic (also accepts client_secret_post),
+	// private_key_jwt, tls_client_auth or none. Secrets live in oauth_client_secrets.
+	TokenEndpointAuthMethod string
+	JWKS                    []byte         // Registered public keys for private_key_jwt, NULL otherwise
+	TLSClientAuthSubjectDN  sql.NullString // Expected certificate subject for tls_client_auth
+	AccessTokenTTL          sql.NullInt64  // Seconds; NULL uses the service default
+	RefreshTokenTTL         sql.NullInt64
+	// RegistrationAccessTokenHash authorizes RFC 7592 management of dynamically registered clients
+	RegistrationAccessTokenHash sql.NullString
+	CreatedAt                   time.Time
+
+	// OIDC logout: where to notify the client, and where it may send the browser after logout
+	PostLogoutRedirectURIs            []string
+	BackchannelLogoutURI              sql.NullString
+	BackchannelLogoutSessionRequired  bool
+	FrontchannelLogoutURI             sql.NullString
+	FrontchannelLogoutSessionRequired bool
+
+	FirstParty bool // Pre-consented: users are not asked to approve scopes
+
+	// RequirePushedAuthorizationRequests rejects authorization requests not made through /oauth/par
+	RequirePushedAuthorizationRequests bool
+}
+
+// IsPublic reports whether the client cannot keep a secret (SPAs, native apps)
+func (c *OAuthClient) IsPublic() bool {
+	return c.TokenEndpointAuthMethod == "none"
+}
+
+// AllowsGrant reports whether the client is registered for the given grant type
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	return containsString(c.GrantTypes, grantType)
+}
+
+// AuthorizationCode is the grant stored in Redis between /oauth/authorize and /oauth/token
+// Key: oauth_code:{Code}
+type AuthorizationCode struct {
+	ClientID      string   `json:"client_id"`
+	RedirectURI   string   `json:"redirect_uri"`
+	UserID        int      `json:"user_id"`
+	Scope         string   `json:"scope"`
+	CodeChallenge string   `json:"code_challenge"`
+	Nonce         string   `json:"nonce,omitempty"` // OIDC nonce echoed in the ID token
+	AuthTime      int64    `json:"auth_time"`
+	AMR           []string `json:"amr,omitempty"` // Authentication methods of the browser login
+	SID           string   `json:"sid,omitempty"` // OIDC session ID of the browser login
+}
+
+// OAuthTokenResponse is the RFC 6749 section 5.1 token endpoint response
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+
+	IssuedTokenType string `json:"issued_token_type,omitempty"` // Token exchange only (RFC 8693)
+}
+
+// OAuthError is the RFC 6749 section 5.2 error response
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// getOAuthClient loads a registered client by its client_id
+func getOAuthClient(clientID string) (*OAuthClient, error) {
+	var c OAuthClient
+	err := DB.QueryRow("SELECT "+oauthClientColumns+" FROM oauth_clients WHERE client_id = $1", clientID).
+		Scan(c.scanTargets()...)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+const oauthClientColumns = `id, client_id, name, redirect_uris, scopes, grant_types, token_endpoint_auth_method,
+	jwks, tls_client_auth_subject_dn, access_token_ttl, refresh_token_ttl, registration_access_token_hash, created_at,
+	post_logout_redirect_uris, backchannel_logout_uri, backchannel_logout_session_required,
+	frontchannel_logout_uri, frontchannel_logout_session_required, first_party, require_pushed_authorization_requests`
+
+// scanTargets lists the fields matching oauthClientColumns, in order
+func (c *OAuthClient) scanTargets() []interface{} {
+	return []interface{}{&c.ID, &c.ClientID, &c.Name, pq.Array(&c.RedirectURIs), pq.Array(&c.Scopes),
+		pq.Array(&c.GrantTypes), &c.TokenEndpointAuthMethod, &c.JWKS, &c.TLSClientAuthSubjectDN,
+		&c.AccessTokenTTL, &c.RefreshTokenTTL, &c.RegistrationAccessTokenHash, &c.CreatedAt,
+		pq.Array(&c.PostLogoutRedirectURIs), &c.BackchannelLogoutURI, &c.BackchannelLogoutSessionRequired,
+		&c.FrontchannelLogoutURI, &c.FrontchannelLogoutSessionRequired, &c.FirstParty,
+		&c.RequirePushedAuthorizationRequests}
+}
+
+// AuthorizeHandler implements the authorization endpoint for the code flow with mandatory PKCE
+func AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// 1. Validate client and redirect_uri first; on failure we must not redirect anywhere
+	client, err := getOAuthClient(r.Form.Get("client_id"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown client_id", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading OAuth client: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Parameters may instead come from a pushed request (PAR) or a signed request object (JAR)
+	if err := resolveAuthorizationRequest(r, client); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	carry := authorizeCarry(r)
+
+	redirectURI := r.Form.Get("redirect_uri")
+	if !containsString(client.RedirectURIs, redirectURI) {
+		http.Error(w, "redirect_uri is not registered for this client", http.StatusBadRequest)
+		return
+	}
+	state := r.Form.Get("state")
+
+	// 2. Validate the rest of the request; from here errors are reported to the client
+	if !client.AllowsGrant("authorization_code") {
+		redirectWithError(w, r, redirectURI, state, "unauthorized_client", "Client is not allowed to use the authorization code flow")
+		return
+	}
+	if r.Form.Get("response_type") != "code" {
+		redirectWithError(w, r, redirectURI, state, "unsupported_response_type", "Only response_type=code is supported")
+		return
+	}
+
+	codeChallenge := r.Form.Get("code_challenge")
+	if codeChallenge == "" || r.Form.Get("code_challenge_method") != "S256" {
+		redirectWithError(w, r, redirectURI, state, "invalid_request", "PKCE with code_challenge_method=S256 is required")
+		return
+	}
+
+	scope, ok := resolveScope(r.Form.Get("scope"), client.Scopes)
+	if !ok {
+		redirectWithError(w, r, redirectURI, state, "invalid_scope", "Requested scope is not allowed for this client")
+		return
+	}
+
+	// 3. Authenticate the resource owner (existing browser session or login form)
+	sso, loggedIn := currentSSOSession(r)
+	if isLoginPost(r) {
+		if sso = handleLoginPost(w, r, "/oauth/authorize", carry); sso == nil {
+			return
+		}
+		loggedIn = true
+	} else if loggedIn && needsReauthentication(r.Form, sso) {
+		loggedIn = false
+	}
+
+	if !loggedIn {
+		if containsString(strings.Fields(r.Form.Get("prompt")), "none") {
+			redirectWithError(w, r, redirectURI, state, "login_required", "The user is not logged in")
+			return
+		}
+		renderLoginForm(w, r, "/oauth/authorize", carry, "")
+		return
+	}
+
+	// 4. Third-party clients need the user's consent to the requested scopes
+	if !client.FirstParty {
+		if isConsentPost(r, sso, client.ClientID, scope) {
+			if r.PostForm.Get("consent") != "allow" {
+				redirectWithError(w, r, redirectURI, state, "access_denied", "The user denied the request")
+				return
+			}
+			if err := saveConsent(sso.UserID, client.ClientID, scope); err != nil {
+				log.Printf("Database error saving consent: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			granted, err := hasConsent(sso.UserID, client.ClientID, scope)
+			if err != nil {
+				log.Printf("Database error checking consent: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			prompt := strings.Fields(r.Form.Get("prompt"))
+			if !granted || containsString(prompt, "consent") {
+				if containsString(prompt, "none") {
+					redirectWithError(w, r, redirectURI, state, "consent_required", "The user has not approved this client")
+					return
+				}
+				renderConsentForm(w, r, client, sso, scope, carry)
+				return
+			}
+		}
+	}
+
+	// 5. Issue a single-use authorization code bound to the PKCE challenge
+	code, err := randomToken(32)
+	if err != nil {
+		log.Printf("Failed to generate authorization code: %v", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	grant := AuthorizationCode{
+		ClientID:      client.ClientID,
+		RedirectURI:   redirectURI,
+		UserID:        sso.UserID,
+		Scope:         scope,
+		CodeChallenge: codeChallenge,
+		Nonce:         r.Form.Get("nonce"),
+		AuthTime:      sso.AuthTime,
+		AMR:           sso.AMR,
+		SID:           sso.SID,
+	}
+	data, _ := json.Marshal(grant)
+	if err := RedisClient.Set(r.Context(), authCodeKey(code), data, authCodeTTL).Err(); err != nil {
+		log.Printf("Failed to store authorization code: %v", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	consumePushedRequest(r)
+
+	// 6. Send the user agent back to the client
+	redirectWithParams(w, r, redirectURI, url.Values{"code": {code}, "state": {state}})
+}
+
+// TokenHandler implements the token endpoint for the authorization_code and refresh_token grants
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	client, err := authenticateClient(r)
+	if err == errInvalidClient {
+		if _, _, hasBasic := r.BasicAuth(); hasBasic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	} else if err != nil {
+		log.Printf("Database error authenticating client: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// A DPoP proof on the request binds everything issued to the client's key
+	cnf, err := requestConfirmation(r)
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	switch grantType {
+	case "authorization_code", "refresh_token", "client_credentials", deviceCodeGrantType, tokenExchangeGrantType:
+		if !client.AllowsGrant(grantType) {
+			writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Client is not allowed to use the "+grantType+" grant")
+			return
+		}
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	switch grantType {
+	case "authorization_code":
+		handleAuthorizationCodeGrant(w, r, client, cnf)
+	case "refresh_token":
+		handleRefreshTokenGrant(w, r, client, cnf)
+	case "client_credentials":
+		handleClientCredentialsGrant(w, r, client, cnf)
+	case deviceCodeGrantType:
+		handleDeviceCodeGrant(w, r, client, cnf)
+	case tokenExchangeGrantType:
+		handleTokenExchangeGrant(w, r, client, cnf)
+	}
+}
+
+// handleAuthorizationCodeGrant exchanges a code and PKCE verifier for tokens
+func handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request, client *OAuthClient, cnf *Confirmation) {
+	ctx := r.Context()
+
+	// 1. Redeem the code exactly once
+	data, err := RedisClient.GetDel(ctx, authCodeKey(r.PostForm.Get("code"))).Bytes()
+	if err == redis.Nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or already used")
+		return
+	} else if err != nil {
+		log.Printf("Redis error redeeming authorization code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	var grant AuthorizationCode
+	if err := json.Unmarshal(data, &grant); err != nil {
+		log.Printf("Corrupt authorization code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// 2. The code must be redeemed by the same client, redirect_uri and PKCE verifier
+	if grant.ClientID != client.ClientID || grant.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code was not issued to this client or redirect_uri")
+		return
+	}
+	if !verifyPKCE(r.PostForm.Get("code_verifier"), grant.CodeChallenge) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	// 3. Start a session for this client
+	sess := Session{UserID: grant.UserID, ClientID: client.ClientID, Scope: grant.Scope, AuthTime: grant.AuthTime,
+		LoginMethod: LoginMethodOAuth, AMR: grant.AMR, Cnf: cnf, SID: grant.SID}
+	tokens, err := issueSessionTokens(sess)
+	var policyErr *TenantPolicyError
+	if err == errNotOrgMember {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "User is no longer a member of the organization")
+		return
+	} else if errors.As(err, &policyErr) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", policyErr.Reason)
+		return
+	} else if err != nil {
+		log.Printf("Error generating tokens: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// 4. OpenID Connect: add an ID token when the openid scope was granted
+	resp := newTokenResponse(tokens, sess)
+	if hasScope(grant.Scope, "openid") {
+		resp.IDToken, err = generateIDToken(sess, grant.Nonce, tokens.AccessToken)
+		if err != nil {
+			log.Printf("Error generating ID token: %v", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	writeOAuthJSON(w, http.StatusOK, resp)
+}
+
+// handleRefreshTokenGrant rotates a refresh token issued to the client, optionally narrowing scope
+func handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request, client *OAuthClient, cnf *Confirmation) {
+	ctx := r.Context()
+	refreshToken := r.PostForm.Get("refresh_token")
+
+	// 1. Find the session owning the refresh token
+	sessionID, err := sessionIDForRefreshToken(ctx, refreshToken)
+	var sess *Session
+	if err == nil {
+		sess, err = loadSession(ctx, sessionID)
+	}
+	if err == ErrSessionNotFound {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid or expired")
+		return
+	} else if err != nil {
+		log.Printf("Redis error loading session: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if sess.ClientID != client.ClientID || sess.RefreshToken != refreshToken {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token was not issued to this client")
+		return
+	}
+
+	if err := checkPresentedBinding(sess.Cnf, cnf); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+		return
+	}
+
+	// 2. A refresh may only keep or narrow the originally granted scope
+	scope, ok := resolveScope(r.PostForm.Get("scope"), strings.Fields(sess.Scope))
+	if !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the original grant")
+		return
+	}
+
+	// 3. Rotate: the old session and refresh token are single-use
+	deleteSession(ctx, sessionID, sess)
+	sess.Scope = scope
+
+	tokens, err := issueSessionTokens(*sess)
+	var policyErr *TenantPolicyError
+	if err == errNotOrgMember {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "User is no longer a member of the session's organization")
+		return
+	} else if errors.As(err, &policyErr) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", policyErr.Reason)
+		return
+	} else if err != nil {
+		log.Printf("Failed to generate new tokens: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	resp := newTokenResponse(tokens, *sess)
+	if hasScope(scope, "openid") {
+		resp.IDToken, err = generateIDToken(*sess, "", tokens.AccessToken)
+		if err != nil {
+			log.Printf("Error generating ID token: %v", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	writeOAuthJSON(w, http.StatusOK, resp)
+}
+
+// handleClientCredentialsGrant issues a service principal token to a confidential client (RFC 6749 section 4.4)
+func handleClientCredentialsGrant(w http.ResponseWriter, r *http.Request, client *OAuthClient, cnf *Confirmation) {
+	if client.IsPublic() {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Public clients cannot use the client_credentials grant")
+		return
+	}
+
+	scope, ok := resolveScope(r.PostForm.Get("scope"), client.Scopes)
+	if !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for this client")
+		return
+	}
+
+	tokens, err := issueServiceToken(client.ClientID, scope, cnf)
+	if err != nil {
+		log.Printf("Error generating service token: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// No refresh token: the client can simply authenticate again
+	writeOAuthJSON(w, http.StatusOK, OAuthTokenResponse{
+		AccessToken: tokens.AccessToken,
+		TokenType:   tokenTypeFor(Session{Cnf: cnf}),
+		ExpiresIn:   tokens.ExpiresIn,
+		Scope:       scope,
+	})
+}
+
+// --- Browser session (SSO) ---
+
+func authCodeKey(code string) string {
+	return fmt.Sprintf("oauth_code:%s", code)
+}
+
+func ssoKey(ssoID string) string {
+	return fmt.Sprintf("sso:%s", ssoID)
+}
+
+// ssoSIDKey maps a public OIDC sid back to its browser session for logout
+func ssoSIDKey(sid string) string {
+	return fmt.Sprintf("sso_sid:%s", sid)
+}
+
+// SSOSession is the browser login stored in Redis behind the hydra_sso cookie
+// Key: sso:{ID}
+type SSOSession struct {
+	ID       string   `json:"-"`
+	UserID   int      `json:"user_id"`
+	AuthTime int64    `json:"auth_time"`     // Unix time the user last entered credentials
+	AMR      []string `json:"amr,omitempty"` // Authentication methods presented at that time
+	// SID is the public OIDC session ID shared with clients (sid claim). Unlike ID,
+	// it cannot be used to hijack the browser session.
+	SID string `json:"sid"`
+}
+
+// currentSSOSession returns the browser session for this request, if any
+func currentSSOSession(r *http.Request) (*SSOSession, bool) {
+	cookie, err := r.Cookie(ssoCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, false
+	}
+
+	data, err := RedisClient.Get(r.Context(), ssoKey(cookie.Value)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Redis error loading SSO session: %v", err)
+		}
+		return nil, false
+	}
+
+	sso := &SSOSession{ID: cookie.Value}
+	if err := json.Unmarshal(data, sso); err != nil {
+		return nil, false
+	}
+	return sso, true
+}
+
+// startSSOSession logs the browser in so later authorization requests skip the login form
+func startSSOSession(w http.ResponseWriter, r *http.Request, userID int, amr []string) (*SSOSession, error) {
+	ssoID, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	sso := &SSOSession{ID: ssoID, UserID: userID, AuthTime: time.Now().Unix(), AMR: amr, SID: uuid.New().String()}
+	data, _ := json.Marshal(sso)
+	pipe := RedisClient.TxPipeline()
+	pipe.Set(r.Context(), ssoKey(ssoID), data, ssoSessionTTL)
+	pipe.Set(r.Context(), ssoSIDKey(sso.SID), ssoID, ssoSessionTTL)
+	if _, err := pipe.Exec(r.Context()); err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoCookieName,
+		Value:    ssoID,
+		Path:     "/",
+		MaxAge:   int(ssoSessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return sso, nil
+}
+
+// needsReauthentication applies the OIDC prompt=login and max_age parameters to an existing session
+func needsReauthentication(form url.Values, sso *SSOSession) bool {
+	if containsString(strings.Fields(form.Get("prompt")), "login") {
+		return true
+	}
+	if maxAge := form.Get("max_age"); maxAge != "" {
+		seconds, err := strconv.Atoi(maxAge)
+		if err == nil && time.Now().Unix()-sso.AuthTime > int64(seconds) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeParams are carried through the login form back to /oauth/authorize
+var authorizeParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method", "nonce", "prompt", "max_age"}
+
+var loginFormTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in</title></head>
+<body>
+  <h1>Sign in</h1>
+  {{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+  <form method="POST" action="{{.Action}}">
+    {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+    {{end}}<label>Email <input type="email" name="email" required></label><br>
+    <label>Password <input type="password" name="password" required></label><br>
+    <label>One-time code <input type="text" name="otp" inputmode="numeric" autocomplete="one-time-code"></label> (if enabled)<br>
+    <button type="submit">Sign in</button>
+  </form>
+</body>
+</html>`))
+
+// renderLoginForm shows the sign-in page; the named request params are posted back to action
+func renderLoginForm(w http.ResponseWriter, r *http.Request, action string, carry []string, errMsg string) {
+	params := map[string]string{}
+	for _, name := range carry {
+		if v := r.Form.Get(name); v != "" {
+			params[name] = v
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if errMsg != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	data := map[string]interface{}{"Action": action, "Params": params, "Error": errMsg}
+	if err := loginFormTemplate.Execute(w, data); err != nil {
+		log.Printf("Error rendering login form: %v", err)
+	}
+}
+
+// isLoginPost reports whether the request is a submission of the login form
+func isLoginPost(r *http.Request) bool {
+	return r.Method == http.MethodPost && r.PostForm.Get("email") != ""
+}
+
+// handleLoginPost verifies credentials posted from the login form and starts a browser session.
+// On failure it has already written the response and returns nil.
+func handleLoginPost(w http.ResponseWriter, r *http.Request, action string, carry []string) *SSOSession {
+	user, err := authenticateUser(r.PostForm.Get("email"), r.PostForm.Get("password"), 0)
+	if err == errInvalidCredentials {
+		renderLoginForm(w, r, action, carry, "Invalid credentials")
+		return nil
+	} else if err != nil {
+		log.Printf("Database error during browser login: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil
+	}
+
+	amr, err := verifySecondFactor(r.Context(), user.ID, r.PostForm.Get("otp"))
+	if err == errMFARequired {
+		renderLoginForm(w, r, action, carry, "Enter the code from your authenticator app")
+		return nil
+	} else if err == errInvalidCredentials {
+		renderLoginForm(w, r, action, carry, "Invalid credentials")
+		return nil
+	} else if err == errTOTPLocked {
+		renderLoginForm(w, r, action, carry, "Too many invalid codes; try again later")
+		return nil
+	} else if err != nil {
+		log.Printf("Database error during browser login: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil
+	}
+
+	sso, err := startSSOSession(w, r, user.ID, amr)
+	if err != nil {
+		log.Printf("Failed to start SSO session: %v", err)
+		http.Error(w, "Server error starting session", http.StatusInternalServerError)
+		return nil
+	}
+	return sso
+}
+
+// --- Helpers ---
+
+// verifyPKCE checks an RFC 7636 S256 code_verifier against the stored challenge
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// resolveScope validates a requested scope string against the allowed scopes.
+// An empty request is granted every allowed scope.
+func resolveScope(requested string, allowed []string) (string, bool) {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(allowed, " "), true
+	}
+
+	var granted []string
+	for _, s := range strings.Fields(requested) {
+		if !containsString(allowed, s) {
+			return "", false
+		}
+		if !containsString(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+	return strings.Join(granted, " "), true
+}
+
+// hasScope reports whether a space-delimited scope string contains the given scope
+func hasScope(scope, want string) bool {
+	return containsString(strings.Fields(scope), want)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// randomToken returns n random bytes encoded as unpadded base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			if v != "" {
+				q.Add(k, v)
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func redirectWithError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, description string) {
+	redirectWithParams(w, r, redirectURI, url.Values{
+		"error":             {code},
+		"error_description": {description},
+		"state":             {state},
+	})
+}
+
+func writeOAuthJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeOAuthJSON(w, status, OAuthError{Error: code, ErrorDescription: description})
+}
+
+func newTokenResponse(tokens TokensResponse, sess Session) OAuthTokenResponse {
+	return OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokenTypeFor(sess),
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        sess.Scope,
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- OpenID Connect Provider (Core 1.0 + Discovery 1.0) ---
+
+const idTokenTTL = 1 * time.Hour
+
+// IDTokenClaims defines the payload of an OIDC ID token
+type IDTokenClaims struct {
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	AtHash   string `json:"at_hash,omitempty"`
+	SID      string `json:"sid,omitempty"` // OIDC session ID, used by logout
+	jwt.RegisteredClaims
+}
+
+// UserProfile holds the standard claims we can release about a user
+type UserProfile struct {
+	ID            int
+	Email         string
+	EmailVerified bool
+	Name          sql.NullString
+	UpdatedAt     time.Time
+}
+
+// issuerURL is the externally visible base URL of this provider
+func issuerURL() string {
+	if issuer := os.Getenv("ISSUER_URL"); issuer != "" {
+		return strings.TrimRight(issuer, "/")
+	}
+	port := os.Getenv("AUTH_SERVICE_PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+// DiscoveryHandler serves /.well-known/openid-configuration
+func DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := issuerURL()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                           issuer,
+		"authorization_endpoint":                           issuer + "/oauth/authorize",
+		"token_endpoint":                                   issuer + "/oauth/token",
+		"userinfo_endpoint":                                issuer + "/userinfo",
+		"device_authorization_endpoint":                    issuer + "/oauth/device_authorization",
+		"introspection_endpoint":                           issuer + "/oauth/introspect",
+		"revocation_endpoint":                              issuer + "/oauth/revoke",
+		"registration_endpoint":                            issuer + "/oauth/register",
+		"pushed_authorization_request_endpoint":            issuer + "/oauth/par",
+		"end_session_endpoint":                             issuer + "/oauth/logout",
+		"jwks_uri":                                         issuer + "/.well-known/jwks.json",
+		"scopes_supported":                                 []string{"openid", "profile", "email"},
+		"response_types_supported":                         []string{"code"},
+		"response_modes_supported":                         []string{"query"},
+		"grant_types_supported":                            supportedGrantTypes,
+		"subject_types_supported":                          []string{"public"},
+		"id_token_signing_alg_values_supported":            []string{"RS256"},
+		"token_endpoint_auth_methods_supported":            supportedAuthMethods,
+		"token_endpoint_auth_signing_alg_values_supported": []string{"RS256", "PS256", "ES256", "ES384"},
+		"tls_client_certificate_bound_access_tokens":       true,
+		"dpop_signing_alg_values_supported":                dpopAlgorithms,
+		"code_challenge_methods_supported":                 []string{"S256"},
+		"backchannel_logout_supported":                     true,
+		"backchannel_logout_session_supported":             true,
+		"frontchannel_logout_supported":                    true,
+		"frontchannel_logout_session_supported":            true,
+		"request_parameter_supported":                      true,
+		"request_object_signing_alg_values_supported":      requestObjectAlgorithms,
+		"require_pushed_authorization_requests":            false,
+		"claims_supported":                                 []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid", "email", "email_verified", "name", "updated_at"},
+	})
+}
+
+// generateIDToken signs an RS256 ID token for the session's user and client
+func generateIDToken(sess Session, nonce, accessToken string) (string, error) {
+	now := time.Now()
+	claims := &IDTokenClaims{
+		Nonce:    nonce,
+		AuthTime: sess.AuthTime,
+		AtHash:   accessTokenHash(accessToken),
+		SID:      sess.SID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuerURL(),
+			Subject:   strconv.Itoa(sess.UserID),
+			Audience:  jwt.ClaimStrings{sess.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(idTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = SigningKeyID
+	return token.SignedString(SigningKey)
+}
+
+// accessTokenHash computes at_hash: the left half of the SHA-256 of the access token
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// getUserProfile loads the claims-relevant columns of a user
+func getUserProfile(userID int) (*UserProfile, error) {
+	var p UserProfile
+	err := DB.QueryRow("SELECT id, email, email_verified, name, updated_at FROM users WHERE id = $1", userID).
+		Scan(&p.ID, &p.Email, &p.EmailVerified, &p.Name, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UserinfoHandler returns the claims allowed by the access token's scope
+func UserinfoHandler(w http.ResponseWriter, r *http.Request) {
+	// 1. Authenticate the Bearer access token
+	_, sess := authenticateAccessToken(w, r, "userinfo")
+	if sess == nil {
+		return
+	}
+
+	// 2. The session must have been granted the openid scope
+	if !hasScope(sess.Scope, "openid") {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		http.Error(w, "Token was not granted the openid scope", http.StatusForbidden)
+		return
+	}
+
+	// 3. Release claims per scope
+	profile, err := getUserProfile(sess.UserID)
+	if err != nil {
+		log.Printf("Database error loading user profile: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	info := map[string]interface{}{"sub": strconv.Itoa(profile.ID)}
+	if hasScope(sess.Scope, "email") {
+		info["email"] = profile.Email
+		info["email_verified"] = profile.EmailVerified
+	}
+	if hasScope(sess.Scope, "profile") {
+		if profile.Name.Valid {
+			info["name"] = profile.Name.String
+		}
+		info["updated_at"] = profile.UpdatedAt.Unix()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(info)
+}
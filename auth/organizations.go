@@ -0,0 +1,410 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// --- Organizations (tenants) and their members ---
+//
+// Users stay global, one account per email, and join organizations as members.
+// A session acts for at most one organization at a time: its org_id claim selects
+// the member's org-scoped roles and is the tenant that policies isolate on.
+
+// orgSlugPattern restricts organization slugs to URL-safe lowercase names like acme-corp
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// errNotOrgMember is returned when a user acts for an organization they do not belong to
+var errNotOrgMember = errors.New("user is not a member of the organization")
+
+// Organization is a tenant
+type Organization struct {
+	ID         int       `json:"id"`
+	Slug       string    `json:"slug"`
+	Name       string    `json:"name"`
+	InviteOnly bool      `json:"invite_only"` // Members only join by invitation, not by signing up with the slug
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const organizationColumns = "o.id, o.slug, o.name, o.invite_only, o.created_at"
+
+func scanOrganization(scan func(dest ...interface{}) error) (*Organization, error) {
+	var org Organization
+	if err := scan(&org.ID, &org.Slug, &org.Name, &org.InviteOnly, &org.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// OrgMember is a user's membership with their org-scoped roles
+type OrgMember struct {
+	UserID   int       `json:"user_id"`
+	Email    string    `json:"email"`
+	Roles    []string  `json:"roles"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// getOrganization loads an organization by slug; returns sql.ErrNoRows if it does not exist
+func getOrganization(slug string) (*Organization, error) {
+	return scanOrganization(DB.QueryRow("SELECT "+organizationColumns+" FROM organizations o WHERE o.slug = $1", slug).Scan)
+}
+
+// resolveOrgID maps an optional slug to an organization ID, 0 when slug is empty
+func resolveOrgID(slug string) (int, error) {
+	if slug == "" {
+		return 0, nil
+	}
+	org, err := getOrganization(slug)
+	if err != nil {
+		return 0, err
+	}
+	return org.ID, nil
+}
+
+// listOrgMembers returns the members of an organization with their org roles
+func listOrgMembers(orgID int) ([]OrgMember, error) {
+	rows, err := DB.Query(`SELECT m.user_id, u.email, m.created_at,
+		COALESCE(ARRAY(SELECT r.name FROM organization_member_roles mr JOIN roles r ON r.id = mr.role_id
+			WHERE mr.org_id = m.org_id AND mr.user_id = m.user_id ORDER BY r.name), '{}')
+		FROM organization_members m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 ORDER BY u.email`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []OrgMember{}
+	for rows.Next() {
+		var m OrgMember
+		if err := rows.Scan(&m.UserID, &m.Email, &m.JoinedAt, pq.Array(&m.Roles)); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// --- Account API: the caller's organizations and org switching ---
+
+// ListMyOrganizationsHandler lists the organizations the token's user belongs to
+func ListMyOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	_, sess := authenticateAccessToken(w, r, "account")
+	if sess == nil {
+		return
+	}
+	if sess.principalType() != PrincipalUser {
+		http.Error(w, "Only user tokens belong to organizations", http.StatusForbidden)
+		return
+	}
+
+	rows, err := DB.Query(`SELECT `+organizationColumns+` FROM organizations o
+		JOIN organization_members m ON m.org_id = o.id WHERE m.user_id = $1 ORDER BY o.name`, sess.UserID)
+	if err != nil {
+		log.Printf("Database error listing organizations: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		org, err := scanOrganization(rows.Scan)
+		if err != nil {
+			log.Printf("Database error listing organizations: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		orgs = append(orgs, *org)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{"active_org_id": sess.OrgID, "organizations": orgs})
+}
+
+// SwitchOrgRequest selects the organization a session acts for; an empty Org leaves every organization
+type SwitchOrgRequest struct {
+	Org string `json:"org"`
+}
+
+// SwitchOrgHandler moves the caller's session to another organization and mints an access
+// token for it. The session and its refresh token are kept; access tokens minted for the
+// previous organization stop validating.
+func SwitchOrgHandler(w http.ResponseWriter, r *http.Request) {
+	var req SwitchOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// 1. The session behind the access token
+	claims, sess := authenticateAccessToken(w, r, "account")
+	if sess == nil {
+		return
+	}
+	if sess.principalType() != PrincipalUser || sess.Actor != nil {
+		http.Error(w, "Only a user's own session can switch organizations", http.StatusForbidden)
+		return
+	}
+
+	// 2. The user must be a member of the target organization
+	orgID, err := resolveOrgID(req.Org)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not a member of this organization", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading organization: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	target := *sess
+	target.OrgID = orgID
+	if err := loadSessionAuthorization(&target); err == errNotOrgMember {
+		http.Error(w, "Not a member of this organization", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading roles: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// 3. The session must satisfy the target organization's MFA and login method settings
+	var policyErr *TenantPolicyError
+	if err := checkTenantSession(&target); errors.As(err, &policyErr) {
+		http.Error(w, policyErr.Reason, http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading organization settings: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// 4. Update the session in place, keeping its remaining lifetime
+	ctx := r.Context()
+	ttl, err := RedisClient.TTL(ctx, sessionKey(claims.SessionID)).Result()
+	if err != nil || ttl <= 0 {
+		http.Error(w, "Session expired or revoked", http.StatusUnauthorized)
+		return
+	}
+	sess = &target
+	if err := saveSession(ctx, claims.SessionID, *sess, ttl); err != nil {
+		log.Printf("Failed to save session: %v", err)
+		http.Error(w, "Server error saving session", http.StatusInternalServerError)
+		return
+	}
+
+	// 5. A new access token for the same session
+	accessTTL, _ := tokenLifetimes(*sess)
+	accessTTL = elevationAccessTTL(sess, accessTTL)
+	accessToken, err := generateJWT(claims.SessionID, *sess, accessTTL)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		http.Error(w, "Failed to generate tokens", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d switched session %s to organization %d", sess.UserID, claims.SessionID, orgID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(TokensResponse{AccessToken: accessToken, ExpiresIn: int(accessTTL.Seconds())})
+}
+
+// --- Admin API: organizations, members and org roles ---
+
+// OrganizationRequest creates or updates an organization
+type OrganizationRequest struct {
+	Slug       string `json:"slug"`
+	Name       string `json:"name"`
+	InviteOnly *bool  `json:"invite_only,omitempty"` // Defaults to true
+}
+
+// AdminListOrganizationsHandler lists every organization
+func AdminListOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := DB.Query("SELECT " + organizationColumns + " FROM organizations o ORDER BY o.slug")
+	if err != nil {
+		log.Printf("Database error listing organizations: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		org, err := scanOrganization(rows.Scan)
+		if err != nil {
+			log.Printf("Database error listing organizations: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		orgs = append(orgs, *org)
+	}
+	writeAdminJSON(w, http.StatusOK, orgs)
+}
+
+// AdminCreateOrganizationHandler creates an organization without members
+func AdminCreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var req OrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !orgSlugPattern.MatchString(req.Slug) || req.Name == "" {
+		http.Error(w, "A slug of lowercase letters, digits and - and a name are required", http.StatusBadRequest)
+		return
+	}
+
+	org := Organization{Slug: req.Slug, Name: req.Name, InviteOnly: req.InviteOnly == nil || *req.InviteOnly}
+	err := DB.QueryRow("INSERT INTO organizations (slug, name, invite_only) VALUES ($1, $2, $3) RETURNING id, created_at",
+		org.Slug, org.Name, org.InviteOnly).Scan(&org.ID, &org.CreatedAt)
+	if isUniqueViolation(err) {
+		http.Error(w, "Organization already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Database error creating organization: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin created organization %s", org.Slug)
+	writeAdminJSON(w, http.StatusCreated, org)
+}
+
+// AdminGetOrganizationHandler returns an organization with its members
+func AdminGetOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := adminOrganization(w, r)
+	if !ok {
+		return
+	}
+	members, err := listOrgMembers(org.ID)
+	if err != nil {
+		log.Printf("Database error listing members: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"organization": org, "members": members})
+}
+
+// AdminUpdateOrganizationHandler renames an organization or changes its sign-up mode
+func AdminUpdateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := adminOrganization(w, r)
+	if !ok {
+		return
+	}
+	var req OrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		org.Name = name
+	}
+	if req.InviteOnly != nil {
+		org.InviteOnly = *req.InviteOnly
+	}
+
+	if _, err := DB.Exec("UPDATE organizations SET name = $2, invite_only = $3 WHERE id = $1", org.ID, org.Name, org.InviteOnly); err != nil {
+		log.Printf("Database error updating organization: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Admin updated organization %s (invite_only=%t)", org.Slug, org.InviteOnly)
+	writeAdminJSON(w, http.StatusOK, org)
+}
+
+// AdminDeleteOrganizationHandler deletes an organization and its memberships. Sessions
+// acting for it fail their next refresh.
+func AdminDeleteOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("org")
+	writeRBACExecResult(w, "Organization not found", "deleted organization "+slug)(
+		DB.Exec("DELETE FROM organizations WHERE slug = $1", slug))
+}
+
+// AdminAddOrgMemberHandler adds a user to an organization
+func AdminAddOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	org, userID, ok := adminOrgMember(w, r)
+	if !ok {
+		return
+	}
+	writeRBACExecResult(w, "User not found", "added user "+strconv.Itoa(userID)+" to organization "+org.Slug)(
+		DB.Exec(`INSERT INTO organization_members (org_id, user_id) SELECT $1, id FROM users WHERE id = $2
+			ON CONFLICT (org_id, user_id) DO UPDATE SET user_id = EXCLUDED.user_id`, org.ID, userID))
+}
+
+// AdminRemoveOrgMemberHandler removes a user and their org roles from an organization
+func AdminRemoveOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	org, userID, ok := adminOrgMember(w, r)
+	if !ok {
+		return
+	}
+	writeRBACExecResult(w, "User is not a member", "removed user "+strconv.Itoa(userID)+" from organization "+org.Slug)(
+		DB.Exec("DELETE FROM organization_members WHERE org_id = $1 AND user_id = $2", org.ID, userID))
+}
+
+// AdminAssignOrgRoleHandler gives a member a role within the organization only
+func AdminAssignOrgRoleHandler(w http.ResponseWriter, r *http.Request) {
+	org, userID, ok := adminOrgMember(w, r)
+	if !ok {
+		return
+	}
+	role := r.PathValue("role")
+	if admin, err := roleGrantsAdmin(role); err != nil {
+		log.Printf("Database error loading role: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	} else if admin {
+		http.Error(w, "Roles granting the admin permission cannot be assigned within an organization", http.StatusBadRequest)
+		return
+	}
+	writeRBACExecResult(w, "Member or role not found", "assigned role "+role+" to user "+strconv.Itoa(userID)+" in organization "+org.Slug)(
+		DB.Exec(`INSERT INTO organization_member_roles (org_id, user_id, role_id)
+			SELECT m.org_id, m.user_id, r.id FROM organization_members m, roles r
+			WHERE m.org_id = $1 AND m.user_id = $2 AND r.name = $3
+			ON CONFLICT (org_id, user_id, role_id) DO UPDATE SET role_id = EXCLUDED.role_id`, org.ID, userID, role))
+}
+
+// AdminUnassignOrgRoleHandler removes an org role from a member
+func AdminUnassignOrgRoleHandler(w http.ResponseWriter, r *http.Request) {
+	org, userID, ok := adminOrgMember(w, r)
+	if !ok {
+		return
+	}
+	role := r.PathValue("role")
+	writeRBACExecResult(w, "Member does not have this role", "unassigned role "+role+" from user "+strconv.Itoa(userID)+" in organization "+org.Slug)(
+		DB.Exec(`DELETE FROM organization_member_roles mr USING roles r
+			WHERE mr.role_id = r.id AND mr.org_id = $1 AND mr.user_id = $2 AND r.name = $3`, org.ID, userID, role))
+}
+
+// adminOrganization loads the {org} path parameter, writing a 404 if it does not exist
+func adminOrganization(w http.ResponseWriter, r *http.Request) (*Organization, bool) {
+	org, err := getOrganization(r.PathValue("org"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("Database error loading organization: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return org, true
+}
+
+// adminOrgMember loads the {org} and {user_id} path parameters
+func adminOrgMember(w http.ResponseWriter, r *http.Request) (*Organization, int, bool) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	org, ok := adminOrganization(w, r)
+	return org, userID, ok
+}
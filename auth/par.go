@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- Pushed Authorization Requests (RFC 9126) and JWT-Secured Authorization Requests (RFC 9101) ---
+
+const (
+	parTTL           = 60 * time.Second
+	requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+)
+
+var requestObjectAlgorithms = []string{"RS256", "PS256", "ES256", "ES384"}
+
+// requestObjectClaims are JWT claims of a request object that are not authorization parameters
+var requestObjectClaims = []string{"iss", "aud", "exp", "iat", "nbf", "jti"}
+
+// PushedAuthorizationRequest is a validated authorization request waiting to be used at /oauth/authorize
+// Key: par:{handle}, where request_uri = urn:ietf:params:oauth:request_uri:{handle}
+type PushedAuthorizationRequest struct {
+	ClientID string     `json:"client_id"`
+	Params   url.Values `json:"params"`
+}
+
+func parKey(handle string) string {
+	return fmt.Sprintf("par:%s", handle)
+}
+
+// PushedAuthorizationResponse is the RFC 9126 section 2.2 response
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// PushedAuthorizationHandler accepts authorization parameters from an authenticated client
+// over the back channel and returns a short-lived request_uri for the browser redirect.
+func PushedAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	// 1. The same client authentication as the token endpoint
+	client, err := authenticateClient(r)
+	if err == errInvalidClient {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	} else if err != nil {
+		log.Printf("Database error authenticating client: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// 2. Collect the parameters, from a signed request object if one was sent
+	params := url.Values{}
+	for name, values := range r.PostForm {
+		switch name {
+		case "client_secret", "client_assertion", "client_assertion_type":
+			continue // Client credentials are not authorization parameters
+		}
+		params[name] = values
+	}
+	if params.Get("request_uri") != "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "request_uri is not allowed in a pushed request")
+		return
+	}
+	if raw := params.Get("request"); raw != "" {
+		if params, err = resolveRequestObject(client, raw); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request_object", err.Error())
+			return
+		}
+	}
+	params.Set("client_id", client.ClientID)
+
+	// 3. Fail early on the checks that would otherwise only show in the browser
+	if !containsString(client.RedirectURIs, params.Get("redirect_uri")) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+		return
+	}
+	if _, ok := resolveScope(params.Get("scope"), client.Scopes); !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for this client")
+		return
+	}
+
+	// 4. Store the request behind an opaque handle
+	handle, err := randomToken(32)
+	if err != nil {
+		log.Printf("Failed to generate request_uri: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	data, _ := json.Marshal(PushedAuthorizationRequest{ClientID: client.ClientID, Params: params})
+	if err := RedisClient.Set(r.Context(), parKey(handle), data, parTTL).Err(); err != nil {
+		log.Printf("Failed to store pushed authorization request: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusCreated, PushedAuthorizationResponse{
+		RequestURI: requestURIPrefix + handle,
+		ExpiresIn:  int(parTTL.Seconds()),
+	})
+}
+
+// resolveAuthorizationRequest replaces the request's form with the parameters of a pushed
+// request (request_uri) or a signed request object (request), and enforces the client's
+// PAR policy. Only client_id is taken from the URL in either case.
+func resolveAuthorizationRequest(r *http.Request, client *OAuthClient) error {
+	requestURI := r.Form.Get("request_uri")
+	requestObject := r.Form.Get("request")
+
+	switch {
+	case requestURI != "":
+		handle, ok := strings.CutPrefix(requestURI, requestURIPrefix)
+		if !ok {
+			return fmt.Errorf("request_uri must be obtained from the pushed authorization endpoint")
+		}
+		data, err := RedisClient.Get(r.Context(), parKey(handle)).Bytes()
+		if err == redis.Nil {
+			return fmt.Errorf("request_uri is invalid or expired")
+		} else if err != nil {
+			return fmt.Errorf("request_uri could not be loaded: %w", err)
+		}
+
+		var par PushedAuthorizationRequest
+		if err := json.Unmarshal(data, &par); err != nil || par.ClientID != client.ClientID {
+			return fmt.Errorf("request_uri was not issued to this client")
+		}
+		r.Form = par.Params
+		r.Form.Set("request_uri", requestURI)
+		return nil
+
+	case client.RequirePushedAuthorizationRequests:
+		return fmt.Errorf("this client must use pushed authorization requests")
+
+	case requestObject != "":
+		params, err := resolveRequestObject(client, requestObject)
+		if err != nil {
+			return fmt.Errorf("invalid request object: %w", err)
+		}
+		params.Set("client_id", client.ClientID)
+		params.Set("request", requestObject) // Re-verified when the login form posts back
+		r.Form = params
+		return nil
+	}
+	return nil
+}
+
+// resolveRequestObject verifies a request object signed with one of the client's registered
+// keys and returns the authorization parameters it carries.
+func resolveRequestObject(client *OAuthClient, raw string) (url.Values, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, clientKeyFunc(client),
+		jwt.WithValidMethods(requestObjectAlgorithms),
+		jwt.WithIssuer(client.ClientID),
+		jwt.WithAudience(issuerURL()))
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := claims["client_id"]; ok && id != client.ClientID {
+		return nil, fmt.Errorf("client_id does not match the authenticated client")
+	}
+
+	params := url.Values{}
+	for name, value := range claims {
+		if containsString(requestObjectClaims, name) {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			params.Set(name, v)
+		case float64:
+			params.Set(name, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			params.Set(name, strconv.FormatBool(v))
+		default:
+			// Structured parameters such as "claims" travel as JSON
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			params.Set(name, string(encoded))
+		}
+	}
+	return params, nil
+}
+
+// authorizeCarry lists the params the login and consent forms post back to /oauth/authorize.
+// Pushed requests and request objects are carried as they came so they are verified again.
+func authorizeCarry(r *http.Request) []string {
+	if r.Form.Get("request_uri") != "" {
+		return []string{"client_id", "request_uri"}
+	}
+	if r.Form.Get("request") != "" {
+		return []string{"client_id", "request"}
+	}
+	return authorizeParams
+}
+
+// consumePushedRequest makes a request_uri single-use once it has produced an authorization code
+func consumePushedRequest(r *http.Request) {
+	requestURI := r.Form.Get("request_uri")
+	if handle, ok := strings.CutPrefix(requestURI, requestURIPrefix); ok {
+		RedisClient.Del(r.Context(), parKey(handle))
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	proto "hydraauth/auth/pb/authpb"
+
+	"github.com/lib/pq"
+)
+
+// --- Policy engine: role permissions plus attribute-based allow/deny policies ---
+//
+// A check is decided in this order:
+//  1. A matching deny policy denies.
+//  2. A permission from the subject's roles that matches the action allows.
+//  3. A matching allow policy allows.
+//  4. Otherwise the action is denied.
+
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// weekdays maps the day names used in time conditions
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Policy grants or denies actions on resources when all of its conditions hold
+type Policy struct {
+	Name          string           `json:"name"`
+	Description   string           `json:"description"`
+	Effect        string           `json:"effect"`         // allow or deny
+	Actions       []string         `json:"actions"`        // Action patterns: exact, "documents:*" or "*"
+	ResourceTypes []string         `json:"resource_types"` // Empty matches every type
+	Roles         []string         `json:"roles"`          // Subjects holding any of these roles; empty matches everyone
+	Conditions    PolicyConditions `json:"conditions"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+// PolicyConditions are attribute checks; every condition that is set must hold
+type PolicyConditions struct {
+	Tenant   string            `json:"tenant,omitempty"`    // "same" or "different" from the subject's tenant
+	Owner    string            `json:"owner,omitempty"`     // "self" or "other" than the subject
+	Time     *TimeWindow       `json:"time,omitempty"`      // When the request is made
+	IPRanges []string          `json:"ip_ranges,omitempty"` // CIDRs the client IP must be in
+	Not      *PolicyConditions `json:"not,omitempty"`       // Holds when the nested conditions do not all hold
+}
+
+// TimeWindow is a daily window in a time zone; End before Start wraps past midnight
+type TimeWindow struct {
+	Days     []string `json:"days,omitempty"` // sun..sat; empty means every day
+	Start    string   `json:"start"`          // HH:MM
+	End      string   `json:"end"`            // HH:MM
+	Timezone string   `json:"timezone,omitempty"`
+}
+
+// AccessRequest is everything a decision depends on
+type AccessRequest struct {
+	Subject     string // sub claim
+	Tenant      string // Subject's tenant, empty when the token carries none
+	Roles       []string
+	Permissions []string
+	Action      string
+	Resource    *proto.Resource
+	ClientIP    net.IP
+	Time        time.Time
+}
+
+// Decision is the outcome of a check
+type Decision struct {
+	Allowed bool
+	Reason  string
+	Policy  string
+}
+
+// accessRequestFor builds the subject side of a request from validated token claims.
+// The subject's tenant is the organization the token acts for.
+func accessRequestFor(claims *Claims, clientIP string) AccessRequest {
+	tenant := ""
+	if claims.OrgID != 0 {
+		tenant = strconv.Itoa(claims.OrgID)
+	}
+	return AccessRequest{
+		Subject:     claims.Subject,
+		Tenant:      tenant,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		ClientIP:    net.ParseIP(clientIP),
+		Time:        time.Now(),
+	}
+}
+
+// actionMatches reports whether an action pattern covers the action
+func actionMatches(pattern, action string) bool {
+	if pattern == "*" || pattern == action {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	return ok && strings.HasPrefix(action, prefix)
+}
+
+func anyActionMatches(patterns []string, action string) (string, bool) {
+	for _, p := range patterns {
+		if actionMatches(p, action) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// applies reports whether the policy targets the request, ignoring conditions
+func (p *Policy) applies(req *AccessRequest) bool {
+	if _, ok := anyActionMatches(p.Actions, req.Action); !ok {
+		return false
+	}
+	if len(p.ResourceTypes) > 0 && !containsString(p.ResourceTypes, req.Resource.GetType()) {
+		return false
+	}
+	if len(p.Roles) == 0 {
+		return true
+	}
+	for _, role := range req.Roles {
+		if containsString(p.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// holds reports whether every condition that is set is met by the request
+func (c *PolicyConditions) holds(req *AccessRequest) bool {
+	switch c.Tenant {
+	case "same":
+		if req.Tenant == "" || req.Tenant != req.Resource.GetTenantId() {
+			return false
+		}
+	case "different":
+		if req.Tenant != "" && req.Tenant == req.Resource.GetTenantId() {
+			return false
+		}
+	}
+
+	switch c.Owner {
+	case "self":
+		if req.Resource.GetOwnerId() == "" || req.Resource.GetOwnerId() != req.Subject {
+			return false
+		}
+	case "other":
+		if req.Resource.GetOwnerId() == req.Subject {
+			return false
+		}
+	}
+
+	if c.Time != nil && !c.Time.contains(req.Time) {
+		return false
+	}
+
+	if len(c.IPRanges) > 0 {
+		if req.ClientIP == nil {
+			return false
+		}
+		inRange := false
+		for _, cidr := range c.IPRanges {
+			if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(req.ClientIP) {
+				inRange = true
+				break
+			}
+		}
+		if !inRange {
+			return false
+		}
+	}
+
+	if c.Not != nil && c.Not.holds(req) {
+		return false
+	}
+	return true
+}
+
+// contains reports whether t falls inside the window
+func (tw *TimeWindow) contains(t time.Time) bool {
+	if loc, err := time.LoadLocation(tw.Timezone); err == nil {
+		t = t.In(loc)
+	}
+	if len(tw.Days) > 0 {
+		dayMatches := false
+		for _, d := range tw.Days {
+			if weekdays[d] == t.Weekday() {
+				dayMatches = true
+				break
+			}
+		}
+		if !dayMatches {
+			return false
+		}
+	}
+
+	start, _ := time.Parse("15:04", tw.Start)
+	end, _ := time.Parse("15:04", tw.End)
+	now := t.Hour()*60 + t.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to // Wraps past midnight
+}
+
+// validate checks the conditions so evaluation never meets a malformed one
+func (c *PolicyConditions) validate() error {
+	if c.Tenant != "" && c.Tenant != "same" && c.Tenant != "different" {
+		return fmt.Errorf(`tenant condition must be "same" or "different"`)
+	}
+	if c.Owner != "" && c.Owner != "self" && c.Owner != "other" {
+		return fmt.Errorf(`owner condition must be "self" or "other"`)
+	}
+	if tw := c.Time; tw != nil {
+		for _, d := range tw.Days {
+			if _, ok := weekdays[d]; !ok {
+				return fmt.Errorf("unknown day %q, use sun..sat", d)
+			}
+		}
+		if _, err := time.Parse("15:04", tw.Start); err != nil {
+			return fmt.Errorf("time start must be HH:MM")
+		}
+		if _, err := time.Parse("15:04", tw.End); err != nil {
+			return fmt.Errorf("time end must be HH:MM")
+		}
+		if _, err := time.LoadLocation(tw.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", tw.Timezone)
+		}
+	}
+	for _, cidr := range c.IPRanges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid CIDR %q", cidr)
+		}
+	}
+	if c.Not != nil {
+		return c.Not.validate()
+	}
+	return nil
+}
+
+// validate checks a policy submitted through the admin API
+func (p *Policy) validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if !rbacNamePattern.MatchString(p.Name) {
+		return errInvalidRBACName
+	}
+	if p.Effect != PolicyAllow && p.Effect != PolicyDeny {
+		return fmt.Errorf(`effect must be "allow" or "deny"`)
+	}
+	if len(p.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	if p.ResourceTypes == nil {
+		p.ResourceTypes = []string{}
+	}
+	if p.Roles == nil {
+		p.Roles = []string{}
+	}
+	return p.Conditions.validate()
+}
+
+// evaluate decides one request against the loaded policies
+func evaluate(policies []Policy, req *AccessRequest) Decision {
+	// 1. Deny overrides everything else
+	for i := range policies {
+		p := &policies[i]
+		if p.Effect == PolicyDeny && p.applies(req) && p.Conditions.holds(req) {
+			return Decision{Allowed: false, Reason: fmt.Sprintf("Denied by policy %s", p.Name), Policy: p.Name}
+		}
+	}
+
+	// 2. Permissions from the subject's roles
+	if perm, ok := anyActionMatches(req.Permissions, req.Action); ok {
+		return Decision{Allowed: true, Reason: fmt.Sprintf("Granted by permission %s", perm)}
+	}
+
+	// 3. Conditional grants
+	for i := range policies {
+		p := &policies[i]
+		if p.Effect == PolicyAllow && p.applies(req) && p.Conditions.holds(req) {
+			return Decision{Allowed: true, Reason: fmt.Sprintf("Allowed by policy %s", p.Name), Policy: p.Name}
+		}
+	}
+
+	// 4. Default deny
+	return Decision{Allowed: false, Reason: fmt.Sprintf("No permission or policy grants %s", req.Action)}
+}
+
+const policyColumns = "name, description, effect, actions, resource_types, roles, conditions, created_at, updated_at"
+
+func scanPolicy(scan func(dest ...interface{}) error) (*Policy, error) {
+	var p Policy
+	var conditions []byte
+	err := scan(&p.Name, &p.Description, &p.Effect, pq.Array(&p.Actions), pq.Array(&p.ResourceTypes),
+		pq.Array(&p.Roles), &conditions, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(conditions, &p.Conditions); err != nil {
+		return nil, fmt.Errorf("policy %s has malformed conditions: %w", p.Name, err)
+	}
+	return &p, nil
+}
+
+// listPolicies loads every policy
+func listPolicies() ([]Policy, error) {
+	rows, err := DB.Query("SELECT " + policyColumns + " FROM access_policies ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []Policy{}
+	for rows.Next() {
+		p, err := scanPolicy(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *p)
+	}
+	return policies, rows.Err()
+}
+
+// --- gRPC: CheckPermission ---
+
+// CheckPermission decides whether the token's subject may perform one action on one resource
+func (s *AuthValidationServer) CheckPermission(ctx context.Context, req *proto.CheckPermissionRequest) (*proto.CheckPermissionResponse, error) {
+	// 1. The token must pass every ValidateToken check
+	claims, errMsg := validateTokenRequest(ctx, req.Token)
+	if claims == nil {
+		return &proto.CheckPermissionResponse{Allowed: false, Error: errMsg}, nil
+	}
+	if req.Check.GetAction() == "" {
+		return &proto.CheckPermissionResponse{Allowed: false, Error: "action is required"}, nil
+	}
+
+	// 2. Load the policies
+	policies, err := listPolicies()
+	if err != nil {
+		log.Printf("Database error loading policies: %v", err)
+		return &proto.CheckPermissionResponse{Allowed: false, Error: "Internal server error loading policies."}, nil
+	}
+
+	// 3. Decide
+	access := accessRequestFor(claims, req.ClientIp)
+	access.Action, access.Resource = req.Check.Action, req.Check.Resource
+	decision := evaluate(policies, &access)
+	return &proto.CheckPermissionResponse{Allowed: decision.Allowed, Reason: decision.Reason, Policy: decision.Policy}, nil
+}
+
+// BatchCheckPermission decides several checks for one token, loading the policies once
+func (s *AuthValidationServer) BatchCheckPermission(ctx context.Context, req *proto.BatchCheckPermissionRequest) (*proto.BatchCheckPermissionResponse, error) {
+	claims, errMsg := validateTokenRequest(ctx, req.Token)
+	if claims == nil {
+		return &proto.BatchCheckPermissionResponse{Error: errMsg}, nil
+	}
+
+	policies, err := listPolicies()
+	if err != nil {
+		log.Printf("Database error loading policies: %v", err)
+		return &proto.BatchCheckPermissionResponse{Error: "Internal server error loading policies."}, nil
+	}
+
+	base := accessRequestFor(claims, req.ClientIp)
+	results := make([]*proto.CheckPermissionResponse, 0, len(req.Checks))
+	for _, check := range req.Checks {
+		if check.GetAction() == "" {
+			results = append(results, &proto.CheckPermissionResponse{Allowed: false, Error: "action is required"})
+			continue
+		}
+		access := base
+		access.Action, access.Resource = check.Action, check.Resource
+		decision := evaluate(policies, &access)
+		results = append(results, &proto.CheckPermissionResponse{Allowed: decision.Allowed, Reason: decision.Reason, Policy: decision.Policy})
+	}
+	return &proto.BatchCheckPermissionResponse{Results: results}, nil
+}
+
+// --- Admin API: policies ---
+
+// AdminListPoliciesHandler lists every policy
+func AdminListPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	policies, err := listPolicies()
+	if err != nil {
+		log.Printf("Database error listing policies: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, policies)
+}
+
+// AdminGetPolicyHandler returns one policy
+func AdminGetPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := scanPolicy(DB.QueryRow("SELECT "+policyColumns+" FROM access_policies WHERE name = $1", r.PathValue("name")).Scan)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Policy not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading policy: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, p)
+}
+
+// AdminPutPolicyHandler creates the named policy or replaces it
+func AdminPutPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var p Policy
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	p.Name = r.PathValue("name")
+	if err := p.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conditions, _ := json.Marshal(p.Conditions)
+	err := DB.QueryRow(`INSERT INTO access_policies (name, description, effect, actions, resource_types, roles, conditions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description, effect = EXCLUDED.effect,
+			actions = EXCLUDED.actions, resource_types = EXCLUDED.resource_types, roles = EXCLUDED.roles,
+			conditions = EXCLUDED.conditions, updated_at = NOW()
+		RETURNING created_at, updated_at`,
+		p.Name, p.Description, p.Effect, pq.Array(p.Actions), pq.Array(p.ResourceTypes), pq.Array(p.Roles), conditions).
+		Scan(&p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		log.Printf("Database error saving policy: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin saved %s policy %s", p.Effect, p.Name)
+	writeAdminJSON(w, http.StatusOK, p)
+}
+
+// AdminDeletePolicyHandler deletes a policy
+func AdminDeletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	writeRBACExecResult(w, "Policy not found", "deleted policy "+name)(
+		DB.Exec("DELETE FROM access_policies WHERE name = $1", name))
+}
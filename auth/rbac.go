@@ -0,0 +1,341 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// --- Role-based access control: roles, permissions and user assignments ---
+
+// adminPermission lets a user call the admin API with their own access token
+const adminPermission = "admin"
+
+// rbacNamePattern restricts role and permission names to URL-safe identifiers like documents:read
+var rbacNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:*-]{0,99}$`)
+
+var errInvalidRBACName = errors.New("names must be lowercase letters, digits and _ . : * -")
+
+// Role is a named set of permissions assignable to users
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Permission is an action that roles grant, named resource:action by convention
+type Permission struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// userAuthorization loads the user's role names and the union of their permissions: global
+// roles and active elevations plus, when orgID is set, the roles they hold in that
+// organization. It returns errNotOrgMember if the user does not belong to the organization.
+func userAuthorization(userID, orgID int) ([]string, []string, error) {
+	return queryUserAuthorization(DB, userID, orgID)
+}
+
+// rowQuerier is satisfied by *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Org roles share the roles table with global ones, but adminPermission only ever comes
+// from a global role or elevation: organizations cannot grant the platform admin API.
+func queryUserAuthorization(q rowQuerier, userID, orgID int) ([]string, []string, error) {
+	var member bool
+	var roles, permissions []string
+	err := q.QueryRow(`WITH global AS (
+			SELECT role_id FROM user_roles WHERE user_id = $1
+			UNION SELECT role_id FROM role_elevations
+				WHERE user_id = $1 AND status = 'active' AND expires_at > NOW() AND role_id IS NOT NULL),
+		held AS (
+			SELECT role_id FROM global
+			UNION SELECT role_id FROM organization_member_roles WHERE user_id = $1 AND org_id = $2)
+		SELECT
+			$2 = 0 OR EXISTS(SELECT 1 FROM organization_members WHERE user_id = $1 AND org_id = $2),
+			COALESCE(ARRAY(SELECT r.name FROM held JOIN roles r ON r.id = held.role_id ORDER BY r.name), '{}'),
+			COALESCE(ARRAY(SELECT DISTINCT p.name FROM held
+				JOIN role_permissions rp ON rp.role_id = held.role_id
+				JOIN permissions p ON p.id = rp.permission_id
+				WHERE p.name <> $3 OR held.role_id IN (SELECT role_id FROM global) ORDER BY p.name), '{}')`,
+		userID, orgID, adminPermission).
+		Scan(&member, pq.Array(&roles), pq.Array(&permissions))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !member {
+		return nil, nil, errNotOrgMember
+	}
+	return roles, permissions, nil
+}
+
+// roleGrantsAdmin reports whether the role includes adminPermission. Such roles can only
+// be held globally, never assigned within an organization.
+func roleGrantsAdmin(name string) (bool, error) {
+	var grants bool
+	err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM roles r
+		JOIN role_permissions rp ON rp.role_id = r.id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE r.name = $1 AND p.name = $2)`, name, adminPermission).Scan(&grants)
+	return grants, err
+}
+
+// listRoles returns every role with its permissions
+func listRoles() ([]Role, error) {
+	rows, err := DB.Query(`SELECT r.name, r.description, r.created_at,
+		COALESCE(ARRAY(SELECT p.name FROM role_permissions rp JOIN permissions p ON p.id = rp.permission_id
+			WHERE rp.role_id = r.id ORDER BY p.name), '{}')
+		FROM roles r ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.CreatedAt, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// getRole loads one role by name; returns sql.ErrNoRows if it does not exist
+func getRole(name string) (*Role, error) {
+	var role Role
+	err := DB.QueryRow(`SELECT r.name, r.description, r.created_at,
+		COALESCE(ARRAY(SELECT p.name FROM role_permissions rp JOIN permissions p ON p.id = rp.permission_id
+			WHERE rp.role_id = r.id ORDER BY p.name), '{}')
+		FROM roles r WHERE r.name = $1`, name).
+		Scan(&role.Name, &role.Description, &role.CreatedAt, pq.Array(&role.Permissions))
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// --- Admin API: roles, permissions and assignments ---
+
+// RBACRequest creates a role or permission
+type RBACRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func decodeRBACRequest(w http.ResponseWriter, r *http.Request) (*RBACRequest, bool) {
+	var req RBACRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return nil, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !rbacNamePattern.MatchString(req.Name) {
+		http.Error(w, errInvalidRBACName.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
+
+// AdminListRolesHandler lists every role with its permissions
+func AdminListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := listRoles()
+	if err != nil {
+		log.Printf("Database error listing roles: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, roles)
+}
+
+// AdminCreateRoleHandler creates an empty role
+func AdminCreateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRBACRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := DB.Exec("INSERT INTO roles (name, description) VALUES ($1, $2)", req.Name, req.Description)
+	if isUniqueViolation(err) {
+		http.Error(w, "Role already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Database error creating role: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin created role %s", req.Name)
+	writeAdminJSON(w, http.StatusCreated, Role{Name: req.Name, Description: req.Description, Permissions: []string{}, CreatedAt: time.Now()})
+}
+
+// AdminGetRoleHandler returns one role with its permissions
+func AdminGetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role, err := getRole(r.PathValue("role"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error loading role: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, role)
+}
+
+// AdminDeleteRoleHandler deletes a role and unassigns it from every user
+func AdminDeleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("role")
+	writeRBACExecResult(w, "Role not found", "deleted role "+name)(
+		DB.Exec("DELETE FROM roles WHERE name = $1", name))
+}
+
+// AdminGrantPermissionHandler adds a permission to a role
+func AdminGrantPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	role, permission := r.PathValue("role"), r.PathValue("permission")
+	writeRBACExecResult(w, "Role or permission not found", "granted "+permission+" to role "+role)(
+		DB.Exec(`INSERT INTO role_permissions (role_id, permission_id)
+			SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = $1 AND p.name = $2
+			ON CONFLICT (role_id, permission_id) DO UPDATE SET role_id = EXCLUDED.role_id`, role, permission))
+}
+
+// AdminRevokePermissionHandler removes a permission from a role
+func AdminRevokePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	role, permission := r.PathValue("role"), r.PathValue("permission")
+	writeRBACExecResult(w, "Role does not have this permission", "revoked "+permission+" from role "+role)(
+		DB.Exec(`DELETE FROM role_permissions rp USING roles r, permissions p
+			WHERE rp.role_id = r.id AND rp.permission_id = p.id AND r.name = $1 AND p.name = $2`, role, permission))
+}
+
+// AdminListPermissionsHandler lists every permission
+func AdminListPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := DB.Query("SELECT name, description, created_at FROM permissions ORDER BY name")
+	if err != nil {
+		log.Printf("Database error listing permissions: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	permissions := []Permission{}
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.Name, &p.Description, &p.CreatedAt); err != nil {
+			log.Printf("Database error listing permissions: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		permissions = append(permissions, p)
+	}
+	writeAdminJSON(w, http.StatusOK, permissions)
+}
+
+// AdminCreatePermissionHandler creates a permission
+func AdminCreatePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRBACRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := DB.Exec("INSERT INTO permissions (name, description) VALUES ($1, $2)", req.Name, req.Description)
+	if isUniqueViolation(err) {
+		http.Error(w, "Permission already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Database error creating permission: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin created permission %s", req.Name)
+	writeAdminJSON(w, http.StatusCreated, Permission{Name: req.Name, Description: req.Description, CreatedAt: time.Now()})
+}
+
+// AdminDeletePermissionHandler deletes a permission and removes it from every role
+func AdminDeletePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("permission")
+	writeRBACExecResult(w, "Permission not found", "deleted permission "+name)(
+		DB.Exec("DELETE FROM permissions WHERE name = $1", name))
+}
+
+// AdminListUserRolesHandler returns a user's global roles and the permissions they grant
+func AdminListUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	roles, permissions, err := userAuthorization(userID, 0)
+	if err != nil {
+		log.Printf("Database error loading user roles: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"user_id": userID, "roles": roles, "permissions": permissions})
+}
+
+// AdminAssignRoleHandler assigns a role to a user. The change applies to tokens issued
+// from the next login or refresh onwards.
+func AdminAssignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	role := r.PathValue("role")
+	writeRBACExecResult(w, "User or role not found", "assigned role "+role+" to user "+strconv.Itoa(userID))(
+		DB.Exec(`INSERT INTO user_roles (user_id, role_id)
+			SELECT u.id, r.id FROM users u, roles r WHERE u.id = $1 AND r.name = $2
+			ON CONFLICT (user_id, role_id) DO UPDATE SET user_id = EXCLUDED.user_id`, userID, role))
+}
+
+// AdminUnassignRoleHandler removes a role from a user
+func AdminUnassignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	role := r.PathValue("role")
+	writeRBACExecResult(w, "User does not have this role", "unassigned role "+role+" from user "+strconv.Itoa(userID))(
+		DB.Exec(`DELETE FROM user_roles ur USING roles r
+			WHERE ur.role_id = r.id AND ur.user_id = $1 AND r.name = $2`, userID, role))
+}
+
+// writeRBACExecResult responds to a single-statement change, with 404 when it matched nothing.
+// Grants and assignments upsert with a no-op update so an existing row still counts.
+func writeRBACExecResult(w http.ResponseWriter, notFound, action string) func(sql.Result, error) {
+	return func(res sql.Result, err error) {
+		if err != nil {
+			log.Printf("Database error managing access control: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, notFound, http.StatusNotFound)
+			return
+		}
+		log.Printf("Admin %s", action)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
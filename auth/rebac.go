@@ -0,0 +1,693 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	proto "hydraauth/auth/pb/authpb"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// --- Relationship-based access control: relation tuples, Check, Expand and ListObjects ---
+//
+// Every write bumps a single revision counter inside its transaction, so revisions follow
+// commit order. A zookie encodes a revision: a read carrying one must reflect every write
+// up to it. Reads always evaluate against the latest data unless a cached Check result is
+// recent enough for the requested consistency.
+
+const (
+	rebacMaxDepth    = 32               // Longest chain of usersets followed by one check
+	rebacCheckTTL    = 30 * time.Second // How long a Check result may be served from cache
+	listObjectsLimit = 1000             // Candidate objects examined by one ListObjects page
+	maxSchemaSize    = 64 << 10
+	maxTupleUpdates  = 100
+	zookiePrefix     = "rev:"
+)
+
+// rebacWritePermission lets a user write relation tuples; service clients need it as a scope
+const rebacWritePermission = "relationships:write"
+
+var rebacObjectIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.@|/=+-]{1,255}$`)
+
+// rebacCheckKey caches one Check result, tagged with the revision it was evaluated at.
+// Results of an older schema are never looked up again once a new one is stored.
+// Key: rebac_check:{schema_id}:{namespace}:{object_id}#{relation}@{subject}
+func rebacCheckKey(schemaID int, namespace, objectID, relation string, subject *proto.Subject) string {
+	return fmt.Sprintf("rebac_check:%d:%s:%s#%s@%s", schemaID, namespace, objectID, relation, formatSubject(subject))
+}
+
+// CachedCheck is a Check result stored in Redis
+type CachedCheck struct {
+	Allowed  bool  `json:"allowed"`
+	Revision int64 `json:"revision"`
+}
+
+// formatSubject renders a subject as namespace:object_id or namespace:object_id#relation
+func formatSubject(s *proto.Subject) string {
+	if s.GetRelation() == "" {
+		return s.GetNamespace() + ":" + s.GetObjectId()
+	}
+	return s.GetNamespace() + ":" + s.GetObjectId() + "#" + s.GetRelation()
+}
+
+func encodeZookie(revision int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(zookiePrefix + strconv.FormatInt(revision, 10)))
+}
+
+func decodeZookie(zookie string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(zookie)
+	if err == nil && len(raw) > len(zookiePrefix) && string(raw[:len(zookiePrefix)]) == zookiePrefix {
+		if revision, err := strconv.ParseInt(string(raw[len(zookiePrefix):]), 10, 64); err == nil {
+			return revision, nil
+		}
+	}
+	return 0, fmt.Errorf("malformed zookie")
+}
+
+// consistencyRequirement returns the lowest revision a cached result must have,
+// and whether the cache may be used at all
+func consistencyRequirement(c *proto.Consistency) (int64, bool, error) {
+	switch c.GetRequirement() {
+	case proto.Consistency_REQUIREMENT_AT_LEAST_AS_FRESH:
+		revision, err := decodeZookie(c.GetZookie())
+		return revision, true, err
+	case proto.Consistency_REQUIREMENT_FULLY_CONSISTENT:
+		return 0, false, nil
+	default:
+		return 0, true, nil
+	}
+}
+
+// currentRevision returns the revision of the latest committed write
+func currentRevision() (int64, error) {
+	var revision int64
+	err := DB.QueryRow("SELECT revision FROM rebac_revision").Scan(&revision)
+	return revision, err
+}
+
+// schemaCache keeps the parsed schema until a newer one is stored
+var schemaCache struct {
+	sync.Mutex
+	schema *RebacSchema
+}
+
+// currentSchema returns the latest stored schema, or an empty one if none was stored
+func currentSchema() (*RebacSchema, error) {
+	var id int
+	err := DB.QueryRow("SELECT COALESCE(MAX(id), 0) FROM rebac_schema").Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaCache.Lock()
+	defer schemaCache.Unlock()
+	if schemaCache.schema != nil && schemaCache.schema.ID == id {
+		return schemaCache.schema, nil
+	}
+	if id == 0 {
+		return &RebacSchema{Namespaces: map[string]*NamespaceConfig{}}, nil
+	}
+
+	var source string
+	if err := DB.QueryRow("SELECT source FROM rebac_schema WHERE id = $1", id).Scan(&source); err != nil {
+		return nil, err
+	}
+	schema, err := parseRebacSchema(source)
+	if err != nil {
+		return nil, fmt.Errorf("stored schema %d is invalid: %w", id, err)
+	}
+	schema.ID = id
+	schemaCache.schema = schema
+	return schema, nil
+}
+
+// validateSubject checks that a subject names a declared namespace (and relation, for usersets)
+func (s *RebacSchema) validateSubject(subject *proto.Subject) error {
+	if subject == nil || !rebacObjectIDPattern.MatchString(subject.ObjectId) {
+		return fmt.Errorf("subject must have a namespace and a valid object_id")
+	}
+	if _, ok := s.Namespaces[subject.Namespace]; !ok {
+		return fmt.Errorf("undefined namespace %q", subject.Namespace)
+	}
+	if subject.Relation != "" && s.relation(subject.Namespace, subject.Relation) == nil {
+		return fmt.Errorf("undefined relation %s#%s", subject.Namespace, subject.Relation)
+	}
+	return nil
+}
+
+// validateObject checks that namespace#relation is declared and the object ID is well formed
+func (s *RebacSchema) validateObject(namespace, objectID, relation string) error {
+	if s.relation(namespace, relation) == nil {
+		return fmt.Errorf("undefined relation %s#%s", namespace, relation)
+	}
+	if objectID != "" && !rebacObjectIDPattern.MatchString(objectID) {
+		return fmt.Errorf("invalid object_id %q", objectID)
+	}
+	return nil
+}
+
+// writeTuples applies updates in one transaction and returns the new revision
+func writeTuples(ctx context.Context, updates []*proto.RelationTupleUpdate) (int64, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The row lock serializes writers, so revisions are assigned in commit order
+	var revision int64
+	if err := tx.QueryRow("UPDATE rebac_revision SET revision = revision + 1 RETURNING revision").Scan(&revision); err != nil {
+		return 0, err
+	}
+
+	for _, u := range updates {
+		t := u.Tuple
+		switch u.Operation {
+		case proto.RelationTupleUpdate_OPERATION_TOUCH:
+			_, err = tx.Exec(`INSERT INTO relation_tuples
+				(namespace, object_id, relation, subject_namespace, subject_id, subject_relation, revision)
+				VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`,
+				t.Namespace, t.ObjectId, t.Relation, t.Subject.Namespace, t.Subject.ObjectId, t.Subject.Relation, revision)
+		case proto.RelationTupleUpdate_OPERATION_DELETE:
+			_, err = tx.Exec(`DELETE FROM relation_tuples WHERE namespace = $1 AND object_id = $2 AND relation = $3
+				AND subject_namespace = $4 AND subject_id = $5 AND subject_relation = $6`,
+				t.Namespace, t.ObjectId, t.Relation, t.Subject.Namespace, t.Subject.ObjectId, t.Subject.Relation)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return revision, tx.Commit()
+}
+
+// storeRebacSchema makes the schema current. Changing rewrites changes answers just like
+// writing tuples does, so it bumps the revision too: reads carrying the returned revision's
+// zookie are evaluated against the new schema.
+func storeRebacSchema(ctx context.Context, schema *RebacSchema) (int64, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var revision int64
+	if err := tx.QueryRow("UPDATE rebac_revision SET revision = revision + 1 RETURNING revision").Scan(&revision); err != nil {
+		return 0, err
+	}
+	if err := tx.QueryRow("INSERT INTO rebac_schema (source) VALUES ($1) RETURNING id", schema.Source).Scan(&schema.ID); err != nil {
+		return 0, err
+	}
+	return revision, tx.Commit()
+}
+
+// directSubjects loads the subjects stored for namespace:object_id#relation
+func directSubjects(ctx context.Context, namespace, objectID, relation string) ([]*proto.Subject, error) {
+	rows, err := DB.QueryContext(ctx, `SELECT subject_namespace, subject_id, subject_relation FROM relation_tuples
+		WHERE namespace = $1 AND object_id = $2 AND relation = $3`, namespace, objectID, relation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subjects []*proto.Subject
+	for rows.Next() {
+		s := &proto.Subject{}
+		if err := rows.Scan(&s.Namespace, &s.ObjectId, &s.Relation); err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, s)
+	}
+	return subjects, rows.Err()
+}
+
+// Memo states of a checker. Negative results are not remembered: one found while a
+// cycle was open may only be false because the cycle was cut.
+const (
+	checkInProgress = iota + 1
+	checkTrue
+)
+
+// checker evaluates relations for one request, remembering the usersets found to match
+type checker struct {
+	ctx      context.Context
+	schema   *RebacSchema
+	subjects func(ctx context.Context, namespace, objectID, relation string) ([]*proto.Subject, error)
+	memo     map[string]int
+	depth    int
+}
+
+func newChecker(ctx context.Context, schema *RebacSchema) *checker {
+	return &checker{ctx: ctx, schema: schema, subjects: directSubjects, memo: map[string]int{}}
+}
+
+// check reports whether subject has relation to namespace:objectID
+func (c *checker) check(namespace, objectID, relation string, subject *proto.Subject) (bool, error) {
+	// A userset always contains itself
+	if subject.Namespace == namespace && subject.ObjectId == objectID && subject.Relation == relation {
+		return true, nil
+	}
+	rewrite := c.schema.relation(namespace, relation)
+	if rewrite == nil {
+		return false, nil // Tuple-to-userset target missing from the tupleset's namespace
+	}
+
+	key := namespace + ":" + objectID + "#" + relation
+	switch c.memo[key] {
+	case checkTrue:
+		return true, nil
+	case checkInProgress: // A cycle adds nothing the outer evaluation lacks
+		return false, nil
+	}
+	if c.depth >= rebacMaxDepth {
+		return false, fmt.Errorf("maximum depth of %d exceeded at %s", rebacMaxDepth, key)
+	}
+
+	c.memo[key] = checkInProgress
+	c.depth++
+	allowed, err := c.eval(namespace, objectID, relation, rewrite, subject)
+	c.depth--
+	delete(c.memo, key)
+	if err != nil {
+		return false, err
+	}
+	if allowed {
+		c.memo[key] = checkTrue
+	}
+	return allowed, nil
+}
+
+func (c *checker) eval(namespace, objectID, relation string, rw *Rewrite, subject *proto.Subject) (bool, error) {
+	switch rw.Op {
+	case rewriteThis:
+		subjects, err := c.subjects(c.ctx, namespace, objectID, relation)
+		if err != nil {
+			return false, err
+		}
+		for _, s := range subjects {
+			if formatSubject(s) == formatSubject(subject) {
+				return true, nil
+			}
+		}
+		for _, s := range subjects {
+			if s.Relation == "" {
+				continue
+			}
+			if ok, err := c.check(s.Namespace, s.ObjectId, s.Relation, subject); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case rewriteComputed:
+		return c.check(namespace, objectID, rw.Relation, subject)
+
+	case rewriteTupleToUserset:
+		targets, err := c.subjects(c.ctx, namespace, objectID, rw.Tupleset)
+		if err != nil {
+			return false, err
+		}
+		for _, t := range targets {
+			if ok, err := c.check(t.Namespace, t.ObjectId, rw.Relation, subject); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case rewriteUnion:
+		for _, child := range rw.Children {
+			if ok, err := c.eval(namespace, objectID, relation, child, subject); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case rewriteIntersection:
+		for _, child := range rw.Children {
+			if ok, err := c.eval(namespace, objectID, relation, child, subject); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case rewriteExclusion:
+		ok, err := c.eval(namespace, objectID, relation, rw.Children[0], subject)
+		if !ok || err != nil {
+			return false, err
+		}
+		excluded, err := c.eval(namespace, objectID, relation, rw.Children[1], subject)
+		return !excluded, err
+	}
+	return false, fmt.Errorf("unknown rewrite %q", rw.Op)
+}
+
+// expand builds the userset tree of namespace:objectID#relation, following usersets
+// until a cycle or the depth limit
+func (c *checker) expand(namespace, objectID, relation string) (*proto.UsersetTree, error) {
+	userset := namespace + ":" + objectID + "#" + relation
+	rewrite := c.schema.relation(namespace, relation)
+	if rewrite == nil || c.memo[userset] == checkInProgress || c.depth >= rebacMaxDepth {
+		return &proto.UsersetTree{Operation: "leaf", Userset: userset}, nil
+	}
+
+	c.memo[userset] = checkInProgress
+	c.depth++
+	tree, err := c.expandRewrite(namespace, objectID, relation, rewrite)
+	c.depth--
+	delete(c.memo, userset)
+	if err != nil {
+		return nil, err
+	}
+	if tree.Userset == "" {
+		tree.Userset = userset
+	}
+	return tree, nil
+}
+
+func (c *checker) expandRewrite(namespace, objectID, relation string, rw *Rewrite) (*proto.UsersetTree, error) {
+	switch rw.Op {
+	case rewriteThis:
+		subjects, err := c.subjects(c.ctx, namespace, objectID, relation)
+		if err != nil {
+			return nil, err
+		}
+		leaf := &proto.UsersetTree{Operation: "leaf", Subjects: subjects}
+		for _, s := range subjects {
+			if s.Relation == "" {
+				continue
+			}
+			child, err := c.expand(s.Namespace, s.ObjectId, s.Relation)
+			if err != nil {
+				return nil, err
+			}
+			leaf.Children = append(leaf.Children, child)
+		}
+		return leaf, nil
+
+	case rewriteComputed:
+		return c.expand(namespace, objectID, rw.Relation)
+
+	case rewriteTupleToUserset:
+		targets, err := c.subjects(c.ctx, namespace, objectID, rw.Tupleset)
+		if err != nil {
+			return nil, err
+		}
+		node := &proto.UsersetTree{Operation: rewriteUnion, Userset: namespace + ":" + objectID + "#" + rw.Tupleset + "->" + rw.Relation}
+		for _, t := range targets {
+			child, err := c.expand(t.Namespace, t.ObjectId, rw.Relation)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+	}
+
+	node := &proto.UsersetTree{Operation: rw.Op}
+	for _, child := range rw.Children {
+		sub, err := c.expandRewrite(namespace, objectID, relation, child)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, sub)
+	}
+	return node, nil
+}
+
+// --- gRPC: Relationships service ---
+
+// RelationshipsServer implements the Relationships service defined in auth.proto
+type RelationshipsServer struct {
+	proto.UnimplementedRelationshipsServer
+}
+
+// authorizeTupleWrite validates the writer's token and returns why it may not write tuples,
+// or "" if it may. Users are decided like CheckPermission, so roles and policies both apply;
+// service clients have no roles and need the permission as a granted scope.
+func authorizeTupleWrite(ctx context.Context, token *proto.ValidateTokenRequest) string {
+	claims, errMsg := validateTokenRequest(ctx, token)
+	if claims == nil {
+		return errMsg
+	}
+	if claims.PrincipalType == PrincipalService {
+		if !hasScope(claims.Scope, rebacWritePermission) {
+			return "The " + rebacWritePermission + " scope is required"
+		}
+		return ""
+	}
+
+	policies, err := listPolicies()
+	if err != nil {
+		log.Printf("Database error loading policies: %v", err)
+		return "Internal server error loading policies."
+	}
+	access := accessRequestFor(claims, "")
+	access.Action = rebacWritePermission
+	if decision := evaluate(policies, &access); !decision.Allowed {
+		return "The " + rebacWritePermission + " permission is required: " + decision.Reason
+	}
+	return ""
+}
+
+// WriteRelationTuples validates every update against the schema and applies them atomically
+func (s *RelationshipsServer) WriteRelationTuples(ctx context.Context, req *proto.WriteRelationTuplesRequest) (*proto.WriteRelationTuplesResponse, error) {
+	// 1. Only authorized writers may change relationships
+	if errMsg := authorizeTupleWrite(ctx, req.Token); errMsg != "" {
+		return &proto.WriteRelationTuplesResponse{Error: errMsg}, nil
+	}
+
+	// 2. Validate against the current schema
+	if len(req.Updates) == 0 || len(req.Updates) > maxTupleUpdates {
+		return &proto.WriteRelationTuplesResponse{Error: fmt.Sprintf("between 1 and %d updates are required", maxTupleUpdates)}, nil
+	}
+	schema, err := currentSchema()
+	if err != nil {
+		log.Printf("Error loading relationship schema: %v", err)
+		return &proto.WriteRelationTuplesResponse{Error: "Internal server error loading schema."}, nil
+	}
+	for _, u := range req.Updates {
+		t := u.GetTuple()
+		if t == nil || u.Operation == proto.RelationTupleUpdate_OPERATION_UNSPECIFIED {
+			return &proto.WriteRelationTuplesResponse{Error: "every update needs an operation and a tuple"}, nil
+		}
+		if err := schema.validateObject(t.Namespace, t.ObjectId, t.Relation); err != nil || t.ObjectId == "" {
+			return &proto.WriteRelationTuplesResponse{Error: fmt.Sprintf("invalid tuple %s:%s#%s", t.Namespace, t.ObjectId, t.Relation)}, nil
+		}
+		if !schema.relation(t.Namespace, t.Relation).allowsDirect() {
+			return &proto.WriteRelationTuplesResponse{Error: fmt.Sprintf("%s#%s is computed and cannot hold tuples", t.Namespace, t.Relation)}, nil
+		}
+		if err := schema.validateSubject(t.Subject); err != nil {
+			return &proto.WriteRelationTuplesResponse{Error: err.Error()}, nil
+		}
+	}
+
+	// 3. Apply
+	revision, err := writeTuples(ctx, req.Updates)
+	if err != nil {
+		log.Printf("Database error writing relation tuples: %v", err)
+		return &proto.WriteRelationTuplesResponse{Error: "Internal server error writing tuples."}, nil
+	}
+	return &proto.WriteRelationTuplesResponse{Zookie: encodeZookie(revision)}, nil
+}
+
+// Check answers whether the subject has the relation to the object
+func (s *RelationshipsServer) Check(ctx context.Context, req *proto.CheckRequest) (*proto.CheckResponse, error) {
+	// 1. Validate the request
+	schema, err := currentSchema()
+	if err != nil {
+		log.Printf("Error loading relationship schema: %v", err)
+		return &proto.CheckResponse{Error: "Internal server error loading schema."}, nil
+	}
+	if err := schema.validateObject(req.Namespace, req.ObjectId, req.Relation); err != nil || req.ObjectId == "" {
+		return &proto.CheckResponse{Error: fmt.Sprintf("invalid object %s:%s#%s", req.Namespace, req.ObjectId, req.Relation)}, nil
+	}
+	if err := schema.validateSubject(req.Subject); err != nil {
+		return &proto.CheckResponse{Error: err.Error()}, nil
+	}
+	minRevision, useCache, err := consistencyRequirement(req.Consistency)
+	if err != nil {
+		return &proto.CheckResponse{Error: err.Error()}, nil
+	}
+
+	// 2. A cached answer is good enough if it is at least as fresh as required
+	key := rebacCheckKey(schema.ID, req.Namespace, req.ObjectId, req.Relation, req.Subject)
+	if useCache {
+		if data, err := RedisClient.Get(ctx, key).Bytes(); err == nil {
+			var cached CachedCheck
+			if json.Unmarshal(data, &cached) == nil && cached.Revision >= minRevision {
+				return &proto.CheckResponse{Allowed: cached.Allowed, CheckedAt: encodeZookie(cached.Revision)}, nil
+			}
+		} else if err != redis.Nil {
+			log.Printf("Redis error reading cached check: %v", err)
+		}
+	}
+
+	// 3. Evaluate against the latest data; it reflects at least the revision read first
+	revision, err := currentRevision()
+	if err != nil {
+		log.Printf("Database error reading revision: %v", err)
+		return &proto.CheckResponse{Error: "Internal server error reading revision."}, nil
+	}
+	// Storing a schema bumps the revision, so the schema read after it is at least as new
+	if schema, err = currentSchema(); err != nil {
+		log.Printf("Error loading relationship schema: %v", err)
+		return &proto.CheckResponse{Error: "Internal server error loading schema."}, nil
+	}
+	key = rebacCheckKey(schema.ID, req.Namespace, req.ObjectId, req.Relation, req.Subject)
+	allowed, err := newChecker(ctx, schema).check(req.Namespace, req.ObjectId, req.Relation, req.Subject)
+	if err != nil {
+		log.Printf("Error checking %s: %v", key, err)
+		return &proto.CheckResponse{Error: "Check failed: " + err.Error()}, nil
+	}
+
+	data, _ := json.Marshal(CachedCheck{Allowed: allowed, Revision: revision})
+	RedisClient.Set(ctx, key, data, rebacCheckTTL)
+	return &proto.CheckResponse{Allowed: allowed, CheckedAt: encodeZookie(revision)}, nil
+}
+
+// Expand returns the tree of subjects that have the relation to the object
+func (s *RelationshipsServer) Expand(ctx context.Context, req *proto.ExpandRequest) (*proto.ExpandResponse, error) {
+	schema, err := currentSchema()
+	if err != nil {
+		log.Printf("Error loading relationship schema: %v", err)
+		return &proto.ExpandResponse{Error: "Internal server error loading schema."}, nil
+	}
+	if err := schema.validateObject(req.Namespace, req.ObjectId, req.Relation); err != nil || req.ObjectId == "" {
+		return &proto.ExpandResponse{Error: fmt.Sprintf("invalid object %s:%s#%s", req.Namespace, req.ObjectId, req.Relation)}, nil
+	}
+	if _, _, err := consistencyRequirement(req.Consistency); err != nil {
+		return &proto.ExpandResponse{Error: err.Error()}, nil
+	}
+
+	// Expansions are never cached, so they satisfy every consistency requirement
+	revision, err := currentRevision()
+	if err != nil {
+		log.Printf("Database error reading revision: %v", err)
+		return &proto.ExpandResponse{Error: "Internal server error reading revision."}, nil
+	}
+	tree, err := newChecker(ctx, schema).expand(req.Namespace, req.ObjectId, req.Relation)
+	if err != nil {
+		log.Printf("Error expanding %s:%s#%s: %v", req.Namespace, req.ObjectId, req.Relation, err)
+		return &proto.ExpandResponse{Error: "Expand failed: " + err.Error()}, nil
+	}
+	return &proto.ExpandResponse{Tree: tree, ExpandedAt: encodeZookie(revision)}, nil
+}
+
+// ListObjects returns the objects of a namespace the subject has the relation to.
+// Only objects that appear in some tuple can have a relation, so those are the candidates.
+// They are examined in object ID order, listObjectsLimit per page.
+func (s *RelationshipsServer) ListObjects(ctx context.Context, req *proto.ListObjectsRequest) (*proto.ListObjectsResponse, error) {
+	schema, err := currentSchema()
+	if err != nil {
+		log.Printf("Error loading relationship schema: %v", err)
+		return &proto.ListObjectsResponse{Error: "Internal server error loading schema."}, nil
+	}
+	if err := schema.validateObject(req.Namespace, "", req.Relation); err != nil {
+		return &proto.ListObjectsResponse{Error: err.Error()}, nil
+	}
+	if err := schema.validateSubject(req.Subject); err != nil {
+		return &proto.ListObjectsResponse{Error: err.Error()}, nil
+	}
+	if _, _, err := consistencyRequirement(req.Consistency); err != nil {
+		return &proto.ListObjectsResponse{Error: err.Error()}, nil
+	}
+
+	revision, err := currentRevision()
+	if err != nil {
+		log.Printf("Database error reading revision: %v", err)
+		return &proto.ListObjectsResponse{Error: "Internal server error reading revision."}, nil
+	}
+	// One more candidate than a page examines tells whether another page follows
+	rows, err := DB.QueryContext(ctx, `SELECT DISTINCT object_id FROM relation_tuples WHERE namespace = $1
+		AND object_id > $2 ORDER BY object_id LIMIT $3`, req.Namespace, req.Cursor, listObjectsLimit+1)
+	if err != nil {
+		log.Printf("Database error listing objects: %v", err)
+		return &proto.ListObjectsResponse{Error: "Internal server error listing objects."}, nil
+	}
+	var candidates []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Printf("Database error listing objects: %v", err)
+			return &proto.ListObjectsResponse{Error: "Internal server error listing objects."}, nil
+		}
+		candidates = append(candidates, id)
+	}
+	rows.Close()
+	nextCursor := ""
+	if len(candidates) > listObjectsLimit {
+		candidates = candidates[:listObjectsLimit]
+		nextCursor = candidates[len(candidates)-1]
+	}
+
+	// One checker shares sub-results (e.g. a common parent folder) across candidates
+	c := newChecker(ctx, schema)
+	objectIDs := []string{}
+	for _, id := range candidates {
+		allowed, err := c.check(req.Namespace, id, req.Relation, req.Subject)
+		if err != nil {
+			log.Printf("Error checking %s:%s#%s: %v", req.Namespace, id, req.Relation, err)
+			return &proto.ListObjectsResponse{Error: "ListObjects failed: " + err.Error()}, nil
+		}
+		if allowed {
+			objectIDs = append(objectIDs, id)
+		}
+	}
+	return &proto.ListObjectsResponse{ObjectIds: objectIDs, ListedAt: encodeZookie(revision), NextCursor: nextCursor}, nil
+}
+
+// --- Admin API: relationship schema ---
+
+// AdminGetRebacSchemaHandler returns the current schema source
+func AdminGetRebacSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	schema, err := currentSchema()
+	if err != nil {
+		log.Printf("Error loading relationship schema: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, schema.Source)
+}
+
+// AdminPutRebacSchemaHandler parses the request body as a schema and makes it current.
+// Tuples of relations the new schema drops are kept but no longer evaluated.
+func AdminPutRebacSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSchemaSize))
+	if err != nil {
+		http.Error(w, "Schema is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	schema, err := parseRebacSchema(string(body))
+	if err != nil {
+		http.Error(w, "Invalid schema: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	revision, err := storeRebacSchema(r.Context(), schema)
+	if err != nil {
+		log.Printf("Database error saving relationship schema: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	namespaces := []string{}
+	for name := range schema.Namespaces {
+		namespaces = append(namespaces, name)
+	}
+	sort.Strings(namespaces)
+	log.Printf("Admin stored relationship schema %d at revision %d", schema.ID, revision)
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"id": schema.ID, "namespaces": namespaces, "zookie": encodeZookie(revision)})
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// --- Relationship-based access control: namespace configuration language ---
+//
+// A schema declares namespaces and their relations. A relation without a rewrite
+// only holds direct tuples; a rewrite combines:
+//
+//	this             tuples stored for the relation itself
+//	editor           another relation of the same object (computed userset)
+//	parent->viewer   viewer on every object the parent relation points to (tuple to userset)
+//	a | b, a & b     union and intersection
+//	a - b            exclusion
+//	( ... )          grouping
+//
+// Example:
+//
+//	namespace group {
+//	  relation member
+//	}
+//	namespace folder {
+//	  relation parent
+//	  relation editor
+//	  relation viewer = this | editor | parent->viewer
+//	}
+//	namespace document {
+//	  relation parent
+//	  relation banned
+//	  relation editor = this | parent->editor
+//	  relation viewer = (this | editor | parent->viewer) - banned
+//	}
+//
+// Lines may carry // comments.
+
+// Rewrite operations
+const (
+	rewriteThis           = "this"
+	rewriteComputed       = "computed_userset"
+	rewriteTupleToUserset = "tuple_to_userset"
+	rewriteUnion          = "union"
+	rewriteIntersection   = "intersection"
+	rewriteExclusion      = "exclusion"
+)
+
+var rebacIdentPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Rewrite is a node of a relation's userset rewrite expression
+type Rewrite struct {
+	Op       string
+	Relation string     // Target relation of computed_userset and tuple_to_userset
+	Tupleset string     // Relation followed by tuple_to_userset
+	Children []*Rewrite // Operands of union, intersection and exclusion
+}
+
+// allowsDirect reports whether tuples may be written for the relation
+func (rw *Rewrite) allowsDirect() bool {
+	if rw.Op == rewriteThis {
+		return true
+	}
+	for _, c := range rw.Children {
+		if c.allowsDirect() {
+			return true
+		}
+	}
+	return false
+}
+
+// NamespaceConfig holds the relations of one object type
+type NamespaceConfig struct {
+	Name      string
+	Relations map[string]*Rewrite
+}
+
+// RebacSchema is a parsed set of namespace configurations
+type RebacSchema struct {
+	ID         int
+	Source     string
+	Namespaces map[string]*NamespaceConfig
+}
+
+// relation returns the rewrite of a relation, or nil if the namespace or relation is undefined
+func (s *RebacSchema) relation(namespace, relation string) *Rewrite {
+	ns, ok := s.Namespaces[namespace]
+	if !ok {
+		return nil
+	}
+	return ns.Relations[relation]
+}
+
+type schemaParser struct {
+	tokens []string
+	lines  []int
+	pos    int
+}
+
+// tokenizeSchema splits the source into identifiers and the symbols { } = | & - ( ) ->
+func tokenizeSchema(src string) ([]string, []int, error) {
+	var tokens []string
+	var lines []int
+	for n, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		for i := 0; i < len(line); {
+			c := rune(line[i])
+			switch {
+			case unicode.IsSpace(c):
+				i++
+			case strings.HasPrefix(line[i:], "->"):
+				tokens, lines = append(tokens, "->"), append(lines, n+1)
+				i += 2
+			case strings.ContainsRune("{}=|&-()", c):
+				tokens, lines = append(tokens, string(c)), append(lines, n+1)
+				i++
+			case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+				j := i
+				for j < len(line) && (line[j] == '_' || unicode.IsLetter(rune(line[j])) || unicode.IsDigit(rune(line[j]))) {
+					j++
+				}
+				tokens, lines = append(tokens, line[i:j]), append(lines, n+1)
+				i = j
+			default:
+				return nil, nil, fmt.Errorf("line %d: unexpected character %q", n+1, c)
+			}
+		}
+	}
+	return tokens, lines, nil
+}
+
+func (p *schemaParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *schemaParser) errorf(format string, args ...interface{}) error {
+	line := 0
+	if p.pos < len(p.lines) {
+		line = p.lines[p.pos]
+	} else if len(p.lines) > 0 {
+		line = p.lines[len(p.lines)-1]
+	}
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *schemaParser) expect(token string) error {
+	if p.peek() != token {
+		return p.errorf("expected %q, found %q", token, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *schemaParser) ident(what string) (string, error) {
+	name := p.peek()
+	if !rebacIdentPattern.MatchString(name) {
+		return "", p.errorf("expected %s name, found %q", what, name)
+	}
+	p.pos++
+	return name, nil
+}
+
+// parseRebacSchema parses and validates a schema
+func parseRebacSchema(src string) (*RebacSchema, error) {
+	tokens, lines, err := tokenizeSchema(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &schemaParser{tokens: tokens, lines: lines}
+	schema := &RebacSchema{Source: src, Namespaces: map[string]*NamespaceConfig{}}
+
+	for p.pos < len(p.tokens) {
+		if err := p.expect("namespace"); err != nil {
+			return nil, err
+		}
+		name, err := p.ident("namespace")
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := schema.Namespaces[name]; dup {
+			p.pos-- // Report the line of the name
+			return nil, p.errorf("namespace %s is declared twice", name)
+		}
+		ns := &NamespaceConfig{Name: name, Relations: map[string]*Rewrite{}}
+		schema.Namespaces[name] = ns
+
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		for p.peek() != "}" {
+			if err := p.expect("relation"); err != nil {
+				return nil, err
+			}
+			rel, err := p.ident("relation")
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := ns.Relations[rel]; dup {
+				p.pos-- // Report the line of the name
+				return nil, p.errorf("relation %s#%s is declared twice", name, rel)
+			}
+			rewrite := &Rewrite{Op: rewriteThis}
+			if p.peek() == "=" {
+				p.pos++
+				if rewrite, err = p.parseUnion(); err != nil {
+					return nil, err
+				}
+			}
+			ns.Relations[rel] = rewrite
+		}
+		p.pos++ // }
+	}
+
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// parseUnion := intersection ('|' intersection)*
+func (p *schemaParser) parseUnion() (*Rewrite, error) {
+	return p.parseBinary("|", rewriteUnion, p.parseIntersection)
+}
+
+// parseIntersection := exclusion ('&' exclusion)*
+func (p *schemaParser) parseIntersection() (*Rewrite, error) {
+	return p.parseBinary("&", rewriteIntersection, p.parseExclusion)
+}
+
+// parseExclusion := primary ('-' primary)?
+func (p *schemaParser) parseExclusion() (*Rewrite, error) {
+	base, err := p.parsePrimary()
+	if err != nil || p.peek() != "-" {
+		return base, err
+	}
+	p.pos++
+	subtract, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return &Rewrite{Op: rewriteExclusion, Children: []*Rewrite{base, subtract}}, nil
+}
+
+func (p *schemaParser) parseBinary(symbol, op string, operand func() (*Rewrite, error)) (*Rewrite, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != symbol {
+		return first, nil
+	}
+	node := &Rewrite{Op: op, Children: []*Rewrite{first}}
+	for p.peek() == symbol {
+		p.pos++
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, next)
+	}
+	return node, nil
+}
+
+// parsePrimary := 'this' | relation | tupleset '->' relation | '(' union ')'
+func (p *schemaParser) parsePrimary() (*Rewrite, error) {
+	if p.peek() == "(" {
+		p.pos++
+		node, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	}
+	if p.peek() == rewriteThis {
+		p.pos++
+		return &Rewrite{Op: rewriteThis}, nil
+	}
+
+	name, err := p.ident("relation")
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != "->" {
+		return &Rewrite{Op: rewriteComputed, Relation: name}, nil
+	}
+	p.pos++
+	target, err := p.ident("relation")
+	if err != nil {
+		return nil, err
+	}
+	return &Rewrite{Op: rewriteTupleToUserset, Tupleset: name, Relation: target}, nil
+}
+
+// validate checks that every relation a rewrite names exists. Tuple-to-userset targets
+// are resolved in whichever namespace the tupleset points to, so they are checked at
+// evaluation time instead.
+func (s *RebacSchema) validate() error {
+	for _, ns := range s.Namespaces {
+		for rel, rw := range ns.Relations {
+			if err := ns.validateRewrite(rel, rw); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ns *NamespaceConfig) validateRewrite(rel string, rw *Rewrite) error {
+	switch rw.Op {
+	case rewriteComputed:
+		if _, ok := ns.Relations[rw.Relation]; !ok {
+			return fmt.Errorf("%s#%s refers to undefined relation %s", ns.Name, rel, rw.Relation)
+		}
+	case rewriteTupleToUserset:
+		tupleset, ok := ns.Relations[rw.Tupleset]
+		if !ok {
+			return fmt.Errorf("%s#%s refers to undefined relation %s", ns.Name, rel, rw.Tupleset)
+		}
+		if !tupleset.allowsDirect() {
+			return fmt.Errorf("%s#%s follows %s, which cannot hold tuples", ns.Name, rel, rw.Tupleset)
+		}
+	}
+	for _, c := range rw.Children {
+		if err := ns.validateRewrite(rel, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	proto "hydraauth/auth/pb/authpb"
+)
+
+// testSchemaSource is the example from rebac_schema.go, plus a namespace for users
+const testSchemaSource = `
+namespace user {
+}
+namespace group {
+  relation member
+}
+namespace folder {
+  relation parent
+  relation editor
+  relation viewer = this | editor | parent->viewer
+}
+namespace document {
+  relation parent
+  relation banned
+  relation editor = this | parent->editor
+  relation viewer = (this | editor | parent->viewer) - banned // banned users lose every other grant
+}
+`
+
+func mustParseSchema(t *testing.T, src string) *RebacSchema {
+	t.Helper()
+	schema, err := parseRebacSchema(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// parseTestSubject parses namespace:object_id or namespace:object_id#relation
+func parseTestSubject(s string) *proto.Subject {
+	ns, rest, _ := strings.Cut(s, ":")
+	id, rel, _ := strings.Cut(rest, "#")
+	return &proto.Subject{Namespace: ns, ObjectId: id, Relation: rel}
+}
+
+// testChecker evaluates against tuples written as namespace:object_id#relation@subject
+// instead of the database
+func testChecker(t *testing.T, schema *RebacSchema, tuples ...string) *checker {
+	t.Helper()
+	stored := map[string][]*proto.Subject{}
+	for _, tuple := range tuples {
+		object, subject, ok := strings.Cut(tuple, "@")
+		if !ok {
+			t.Fatalf("malformed tuple %q", tuple)
+		}
+		stored[object] = append(stored[object], parseTestSubject(subject))
+	}
+	c := newChecker(context.Background(), schema)
+	c.subjects = func(_ context.Context, namespace, objectID, relation string) ([]*proto.Subject, error) {
+		return stored[namespace+":"+objectID+"#"+relation], nil
+	}
+	return c
+}
+
+func TestParseRebacSchema(t *testing.T) {
+	schema := mustParseSchema(t, testSchemaSource)
+
+	if len(schema.Namespaces) != 4 {
+		t.Fatalf("parsed %d namespaces, want 4", len(schema.Namespaces))
+	}
+	viewer := schema.relation("document", "viewer")
+	if viewer == nil || viewer.Op != rewriteExclusion || len(viewer.Children) != 2 {
+		t.Fatalf("document#viewer = %+v, want an exclusion", viewer)
+	}
+	base, banned := viewer.Children[0], viewer.Children[1]
+	if base.Op != rewriteUnion || len(base.Children) != 3 {
+		t.Fatalf("document#viewer base = %+v, want a union of three", base)
+	}
+	if ttu := base.Children[2]; ttu.Op != rewriteTupleToUserset || ttu.Tupleset != "parent" || ttu.Relation != "viewer" {
+		t.Fatalf("third operand = %+v, want parent->viewer", ttu)
+	}
+	if banned.Op != rewriteComputed || banned.Relation != "banned" {
+		t.Fatalf("subtrahend = %+v, want banned", banned)
+	}
+	if !schema.relation("document", "editor").allowsDirect() || !schema.relation("document", "viewer").allowsDirect() {
+		t.Fatal("relations including this must allow direct tuples")
+	}
+	if mustParseSchema(t, "namespace doc {\n relation owner\n relation viewer = owner\n}").relation("doc", "viewer").allowsDirect() {
+		t.Fatal("doc#viewer = owner must not allow direct tuples")
+	}
+}
+
+func TestParseRebacSchemaPrecedence(t *testing.T) {
+	schema := mustParseSchema(t, `namespace doc {
+	  relation a
+	  relation b
+	  relation c
+	  relation x = a | b & c - a
+	}`)
+
+	// & binds tighter than |, and - tighter than &
+	x := schema.relation("doc", "x")
+	if x.Op != rewriteUnion || len(x.Children) != 2 {
+		t.Fatalf("x = %+v, want a union of two", x)
+	}
+	and := x.Children[1]
+	if and.Op != rewriteIntersection || len(and.Children) != 2 || and.Children[1].Op != rewriteExclusion {
+		t.Fatalf("second operand = %+v, want b & (c - a)", and)
+	}
+}
+
+func TestParseRebacSchemaErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // Substring of the error
+	}{
+		{"unexpected character", "namespace doc { relation a = b * c }", `unexpected character '*'`},
+		{"missing namespace keyword", "doc { }", `line 1: expected "namespace"`},
+		{"invalid namespace name", "namespace Doc { }", "expected namespace name"},
+		{"unclosed namespace", "namespace doc {\n  relation a\n", `line 2: expected "relation", found ""`},
+		{"missing relation name", "namespace doc { relation = this }", "expected relation name"},
+		{"duplicate namespace", "namespace doc { }\nnamespace doc { }", "line 2: namespace doc is declared twice"},
+		{"duplicate relation", "namespace doc {\n relation a\n relation a\n}", "line 3: relation doc#a is declared twice"},
+		{"empty rewrite", "namespace doc { relation a = }", "expected relation name"},
+		{"unclosed group", "namespace doc { relation a relation b = (this | a }", `expected ")"`},
+		{"dangling operator", "namespace doc { relation a relation b = a | }", "expected relation name"},
+		{"missing tupleset target", "namespace doc { relation a relation b = a-> }", "expected relation name"},
+		{"undefined computed relation", "namespace doc { relation a = b }", "doc#a refers to undefined relation b"},
+		{"undefined tupleset", "namespace doc { relation a = parent->viewer }", "doc#a refers to undefined relation parent"},
+		{"tupleset without tuples", "namespace doc {\n relation owner\n relation parent = owner\n relation a = parent->viewer\n}",
+			"doc#a follows parent, which cannot hold tuples"},
+		{"undefined relation in a nested operand", "namespace doc { relation a = this | (this & b) }", "undefined relation b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRebacSchema(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebacSchemaValidateTuple(t *testing.T) {
+	schema := mustParseSchema(t, testSchemaSource)
+
+	objects := []struct {
+		namespace, objectID, relation string
+		valid                         bool
+	}{
+		{"document", "doc-1", "viewer", true},
+		{"document", "a/b@c.d|e=f+g", "viewer", true},
+		{"document", "", "viewer", true}, // ListObjects leaves the object out
+		{"document", "doc 1", "viewer", false},
+		{"document", "doc-1", "owner", false},
+		{"file", "doc-1", "viewer", false},
+	}
+	for _, o := range objects {
+		if err := schema.validateObject(o.namespace, o.objectID, o.relation); (err == nil) != o.valid {
+			t.Errorf("validateObject(%q, %q, %q) = %v, want valid %v", o.namespace, o.objectID, o.relation, err, o.valid)
+		}
+	}
+
+	subjects := []struct {
+		subject *proto.Subject
+		valid   bool
+	}{
+		{parseTestSubject("user:1"), true},
+		{parseTestSubject("group:eng#member"), true},
+		{parseTestSubject("group:eng#owner"), false},
+		{parseTestSubject("robot:1"), false},
+		{parseTestSubject("user:"), false},
+		{nil, false},
+	}
+	for _, s := range subjects {
+		if err := schema.validateSubject(s.subject); (err == nil) != s.valid {
+			t.Errorf("validateSubject(%v) = %v, want valid %v", s.subject, err, s.valid)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	schema := mustParseSchema(t, testSchemaSource)
+	tuples := []string{
+		"group:eng#member@user:1",
+		"group:eng#member@group:oncall#member",
+		"group:oncall#member@user:2",
+		"folder:root#viewer@group:eng#member",
+		"folder:root#editor@user:3",
+		"folder:sub#parent@folder:root",
+		"document:spec#parent@folder:sub",
+		"document:spec#viewer@user:4",
+		"document:spec#banned@user:2",
+	}
+
+	tests := []struct {
+		object, relation, subject string
+		want                      bool
+	}{
+		{"group:eng", "member", "user:1", true},
+		{"group:eng", "member", "user:2", true}, // Through the nested group
+		{"group:eng", "member", "group:oncall#member", true},
+		{"group:oncall", "member", "user:1", false},
+		{"folder:root", "viewer", "user:3", true}, // Editors view
+		{"folder:sub", "viewer", "user:1", true},  // Inherited from the parent folder
+		{"folder:sub", "editor", "user:3", false}, // folder#editor does not follow parent
+		{"document:spec", "viewer", "user:1", true},
+		{"document:spec", "viewer", "user:4", true},
+		{"document:spec", "viewer", "user:2", false}, // Banned, although a member of eng
+		{"document:spec", "editor", "user:3", false},
+		{"document:spec", "viewer", "user:5", false},
+		{"document:spec", "viewer", "group:eng#member", true},
+		{"document:spec", "viewer", "document:spec#viewer", true}, // A userset contains itself
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s#%s@%s", tt.object, tt.relation, tt.subject), func(t *testing.T) {
+			object := parseTestSubject(tt.object)
+			got, err := testChecker(t, schema, tuples...).check(object.Namespace, object.ObjectId, tt.relation, parseTestSubject(tt.subject))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCycles(t *testing.T) {
+	schema := mustParseSchema(t, testSchemaSource)
+	tuples := []string{
+		"group:a#member@group:b#member",
+		"group:a#member@group:c#member",
+		"group:b#member@group:a#member",
+		"group:c#member@user:1",
+		"folder:x#parent@folder:y",
+		"folder:y#parent@folder:x",
+		"folder:y#viewer@user:2",
+	}
+
+	// Like ListObjects, one checker evaluates every object for a subject. Checking group:a
+	// cuts the cycle at group:b before reaching group:c, so group:b must not be remembered
+	// as a non-member.
+	tests := []struct {
+		subject string
+		objects []string // Checked in order
+		want    []bool
+	}{
+		{"user:1", []string{"group:a#member", "group:b#member", "group:c#member"}, []bool{true, true, true}},
+		{"user:2", []string{"group:a#member", "group:b#member"}, []bool{false, false}},
+		{"user:2", []string{"folder:x#viewer", "folder:y#viewer"}, []bool{true, true}},
+		{"user:1", []string{"folder:x#viewer", "folder:y#viewer"}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subject+"@"+strings.Join(tt.objects, ","), func(t *testing.T) {
+			c := testChecker(t, schema, tuples...)
+			for i, o := range tt.objects {
+				object := parseTestSubject(o)
+				got, err := c.check(object.Namespace, object.ObjectId, object.Relation, parseTestSubject(tt.subject))
+				if err != nil {
+					t.Fatalf("%s: %v", o, err)
+				}
+				if got != tt.want[i] {
+					t.Fatalf("%s: check() = %v, want %v", o, got, tt.want[i])
+				}
+				if c.depth != 0 {
+					t.Fatalf("%s: depth = %d after the check, want 0", o, c.depth)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckMaxDepth(t *testing.T) {
+	schema := mustParseSchema(t, testSchemaSource)
+
+	// group:g0 contains group:g1, which contains group:g2 ... down to user:1
+	nested := func(groups int) *checker {
+		var tuples []string
+		for i := 0; i < groups-1; i++ {
+			tuples = append(tuples, fmt.Sprintf("group:g%d#member@group:g%d#member", i, i+1))
+		}
+		tuples = append(tuples, fmt.Sprintf("group:g%d#member@user:1", groups-1))
+		return testChecker(t, schema, tuples...)
+	}
+
+	if ok, err := nested(rebacMaxDepth).check("group", "g0", "member", parseTestSubject("user:1")); !ok || err != nil {
+		t.Fatalf("%d nested groups: check() = %v, %v; want true", rebacMaxDepth, ok, err)
+	}
+	if _, err := nested(rebacMaxDepth+1).check("group", "g0", "member", parseTestSubject("user:1")); err == nil ||
+		!strings.Contains(err.Error(), "maximum depth") {
+		t.Fatalf("%d nested groups: error = %v, want the depth limit", rebacMaxDepth+1, err)
+	}
+}
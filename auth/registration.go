@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// --- Dynamic Client Registration (RFC 7591) and Management (RFC 7592) ---
+
+// RegisterClientHandler registers a new client. Registration is closed: callers must
+// present an initial access token issued through the admin API.
+func RegisterClientHandler(w http.ResponseWriter, r *http.Request) {
+	// 1. Spend one use of the initial access token
+	token, _ := bearerToken(r)
+	ok, err := consumeInitialAccessToken(token)
+	if err != nil {
+		log.Printf("Database error checking initial access token: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "A valid initial access token is required")
+		return
+	}
+
+	// 2. Parse the metadata; lifetimes and first-party status are only configurable by administrators
+	var m ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "Malformed JSON body")
+		return
+	}
+	m.AccessTokenTTL, m.RefreshTokenTTL = 0, 0
+	m.FirstParty = false
+
+	// 3. Store the client and hand back its credentials
+	created, err := createClient(m, true)
+	if writeClientMetadataError(w, err) {
+		return
+	}
+
+	log.Printf("Dynamically registered client %s (%s)", created.ClientID, created.ClientName)
+	writeOAuthJSON(w, http.StatusCreated, created)
+}
+
+// ClientConfigurationHandler reads, replaces or deletes a dynamically registered client,
+// authenticated with the registration access token returned at registration.
+func ClientConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	client := authenticateRegistrationAccess(w, r)
+	if client == nil {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeClientConfiguration(w, http.StatusOK, clientMetadataFor(client))
+
+	case http.MethodPut:
+		var m ClientMetadata
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "Malformed JSON body")
+			return
+		}
+		if m.ClientID != client.ClientID {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "client_id must match the client being updated")
+			return
+		}
+		// Settings owned by an administrator are kept as they are
+		m.AccessTokenTTL, m.RefreshTokenTTL = client.AccessTokenTTL.Int64, client.RefreshTokenTTL.Int64
+		m.FirstParty = client.FirstParty
+
+		updated, err := updateClient(client.ClientID, m)
+		if writeClientMetadataError(w, err) {
+			return
+		}
+		writeClientConfiguration(w, http.StatusOK, updated)
+
+	case http.MethodDelete:
+		if err := deleteClient(client.ClientID); err != nil && err != sql.ErrNoRows {
+			log.Printf("Database error deleting client: %v", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		log.Printf("Client %s deleted itself", client.ClientID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authenticateRegistrationAccess loads the client named in the path and checks the
+// registration access token against it. Unknown clients and bad tokens look the same.
+func authenticateRegistrationAccess(w http.ResponseWriter, r *http.Request) *OAuthClient {
+	token, _ := bearerToken(r)
+
+	client, err := getOAuthClient(r.PathValue("client_id"))
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Database error loading client: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return nil
+	}
+	if err == sql.ErrNoRows || token == "" || !client.RegistrationAccessTokenHash.Valid ||
+		subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(client.RegistrationAccessTokenHash.String)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "Invalid registration access token")
+		return nil
+	}
+	return client
+}
+
+// writeClientConfiguration responds with the client's metadata and its management URI
+func writeClientConfiguration(w http.ResponseWriter, status int, m ClientMetadata) {
+	m.RegistrationClientURI = issuerURL() + "/oauth/register/" + m.ClientID
+	writeOAuthJSON(w, status, m)
+}
+
+// writeClientMetadataError reports a createClient/updateClient failure, returning false if err is nil
+func writeClientMetadataError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var metaErr *clientMetadataError
+	if errors.As(err, &metaErr) {
+		writeOAuthError(w, http.StatusBadRequest, metaErr.Code, metaErr.Description)
+	} else if err == sql.ErrNoRows {
+		writeOAuthError(w, http.StatusNotFound, "invalid_client_id", "Client not found")
+	} else {
+		log.Printf("Database error saving client: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+	}
+	return true
+}
+
+// consumeInitialAccessToken counts one registration against an initial access token,
+// reporting false if the token is unknown, expired or used up.
+func consumeInitialAccessToken(token string) (bool, error) {
+	if strings.TrimSpace(token) == "" {
+		return false, nil
+	}
+
+	var id int
+	err := DB.QueryRow(`UPDATE initial_access_tokens SET use_count = use_count + 1
+		WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		AND (max_uses IS NULL OR use_count < max_uses)
+		RETURNING id`, hashToken(token)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
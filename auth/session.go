@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Session is the metadata stored in Redis for every active login session.
+// Key: session:{SessionID}
+type Session struct {
+	UserID       int    `json:"user_id"`
+	RefreshToken string `json:"refresh_token"`
+	ClientID     string `json:"client_id,omitempty"` // OAuth client the session was issued to, empty for /auth/login
+	Scope        string `json:"scope,omitempty"`     // Space-delimited OAuth scopes granted to the session
+	AuthTime     int64  `json:"auth_time,omitempty"` // Unix time the user authenticated (OIDC auth_time)
+
+	// How the user logged in: the LoginMethod* constant and the authentication
+	// methods presented (RFC 8176 amr values). Checked against the organization's settings.
+	LoginMethod string   `json:"login_method,omitempty"`
+	AMR         []string `json:"amr,omitempty"`
+
+	// PrincipalType is PrincipalService for client_credentials sessions, which have no
+	// user and no refresh token. Empty means PrincipalUser.
+	PrincipalType string `json:"principal_type,omitempty"`
+
+	// Set on sessions created by token exchange: the token is restricted to Audience,
+	// Actor is the delegating client, and the session dies with its parent.
+	Audience        []string `json:"aud,omitempty"`
+	Actor           *Actor   `json:"act,omitempty"`
+	ParentSessionID string   `json:"parent_session_id,omitempty"`
+
+	// ImpersonatorID is the admin signed in as the user, 0 for the user's own sessions.
+	// Actor then names the admin as well.
+	ImpersonatorID int `json:"impersonator_id,omitempty"`
+
+	// Cnf binds every token of the session to a client key (DPoP)
+	Cnf *Confirmation `json:"cnf,omitempty"`
+
+	// OrgID is the organization the session acts for, 0 for none. Switching
+	// organizations updates it in place.
+	OrgID int `json:"org_id,omitempty"`
+
+	// Roles and the permissions they grant, loaded when the session's tokens are issued
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+
+	// Temporary role elevations included in Roles, and the Unix time the first of them
+	// expires. Tokens stop validating once any of them ends.
+	Elevations    []string `json:"elevations,omitempty"`
+	ElevatedUntil int64    `json:"elevated_until,omitempty"`
+
+	// SID is the OIDC session ID of the browser login that started this session.
+	// Logging that browser out ends every session sharing the SID.
+	SID string `json:"sid,omitempty"`
+}
+
+func (s *Session) principalType() string {
+	if s.PrincipalType == "" {
+		return PrincipalUser
+	}
+	return s.PrincipalType
+}
+
+// subject is the principal's ID as used in the sub claim: the user ID, or the
+// client ID for service principals
+func (s *Session) subject() string {
+	if s.principalType() == PrincipalService {
+		return s.ClientID
+	}
+	return strconv.Itoa(s.UserID)
+}
+
+// ErrSessionNotFound is returned when a session has expired or been revoked
+var ErrSessionNotFound = errors.New("session not found")
+
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+// refreshTokenKey indexes sessions by refresh token so OAuth clients can
+// refresh without presenting the expired access token.
+func refreshTokenKey(refreshToken string) string {
+	return fmt.Sprintf("refresh_token:%s", refreshToken)
+}
+
+// ssoSessionsKey indexes the sessions started from one browser login, for logout.
+// Key: sso_sessions:{SID}, a set of session IDs
+func ssoSessionsKey(sid string) string {
+	return fmt.Sprintf("sso_sessions:%s", sid)
+}
+
+// userSessionsKey indexes a user's sessions so they can be revoked per client.
+// Key: user_sessions:{UserID}, a set of session IDs
+func userSessionsKey(userID int) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
+
+// saveSession stores the session and its refresh token index in Redis
+func saveSession(ctx context.Context, sessionID string, sess Session, ttl time.Duration) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	pipe := RedisClient.TxPipeline()
+	pipe.Set(ctx, sessionKey(sessionID), data, ttl)
+	if sess.RefreshToken != "" {
+		pipe.Set(ctx, refreshTokenKey(sess.RefreshToken), sessionID, ttl)
+	}
+	if sess.SID != "" {
+		// The index must outlive every member; stale IDs are skipped on logout
+		pipe.SAdd(ctx, ssoSessionsKey(sess.SID), sessionID)
+		pipe.Expire(ctx, ssoSessionsKey(sess.SID), maxRefreshTokenTTL)
+	}
+	if sess.principalType() == PrincipalUser {
+		pipe.SAdd(ctx, userSessionsKey(sess.UserID), sessionID)
+		pipe.Expire(ctx, userSessionsKey(sess.UserID), maxRefreshTokenTTL)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// loadSession fetches an active session by its ID. A session derived from
+// another (token exchange) is only active while its parent is.
+func loadSession(ctx context.Context, sessionID string) (*Session, error) {
+	data, err := RedisClient.Get(ctx, sessionKey(sessionID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("corrupt session %s: %w", sessionID, err)
+	}
+
+	if sess.ParentSessionID != "" {
+		if _, err := loadSession(ctx, sess.ParentSessionID); err != nil {
+			return nil, err
+		}
+	}
+	return &sess, nil
+}
+
+// InvalidTokenError is returned when an access token's session no longer accepts it.
+// Reason can be shown to whoever presented the token.
+type InvalidTokenError struct {
+	Reason string
+}
+
+func (e *InvalidTokenError) Error() string {
+	return e.Reason
+}
+
+// loadTokenSession loads the session of a verified access token and checks that it still
+// accepts the token, as every place that accepts access tokens must. Rejections are
+// *InvalidTokenError; other errors are internal.
+func loadTokenSession(ctx context.Context, claims *Claims) (*Session, error) {
+	sess, err := loadSession(ctx, claims.SessionID)
+	if err == ErrSessionNotFound {
+		return nil, &InvalidTokenError{Reason: "Session revoked or not active"}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	if err := checkTokenSession(ctx, claims, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// checkTokenSession checks an access token against its loaded session: the token must be
+// for the organization the session acts for now, the organization's settings must accept
+// both, and every temporary role the token carries must still be active.
+func checkTokenSession(ctx context.Context, claims *Claims, sess *Session) error {
+	// Tokens minted before the session switched organizations no longer apply
+	if claims.OrgID != sess.OrgID {
+		return &InvalidTokenError{Reason: "Token was issued for a different organization"}
+	}
+	var policyErr *TenantPolicyError
+	if err := checkTenantToken(claims, sess); errors.As(err, &policyErr) {
+		return &InvalidTokenError{Reason: "Token rejected by " + policyErr.Error()}
+	} else if err != nil {
+		return err
+	}
+	if err := checkElevations(ctx, sess); err == errElevationEnded {
+		return &InvalidTokenError{Reason: "Token rejected: " + err.Error()}
+	} else if err != nil {
+		return fmt.Errorf("failed to check elevations: %w", err)
+	}
+	return nil
+}
+
+// sessionIDForRefreshToken resolves a refresh token to the session it belongs to
+func sessionIDForRefreshToken(ctx context.Context, refreshToken string) (string, error) {
+	sessionID, err := RedisClient.Get(ctx, refreshTokenKey(refreshToken)).Result()
+	if err == redis.Nil {
+		return "", ErrSessionNotFound
+	}
+	return sessionID, err
+}
+
+// deleteSession revokes a session and its refresh token index
+func deleteSession(ctx context.Context, sessionID string, sess *Session) error {
+	keys := []string{sessionKey(sessionID)}
+	if sess != nil && sess.RefreshToken != "" {
+		keys = append(keys, refreshTokenKey(sess.RefreshToken))
+	}
+
+	pipe := RedisClient.TxPipeline()
+	pipe.Del(ctx, keys...)
+	if sess != nil && sess.SID != "" {
+		pipe.SRem(ctx, ssoSessionsKey(sess.SID), sessionID)
+	}
+	if sess != nil && sess.principalType() == PrincipalUser {
+		pipe.SRem(ctx, userSessionsKey(sess.UserID), sessionID)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// --- Per-tenant settings ---
+//
+// Each organization may override token lifetimes, the password policy, whether MFA is
+// required and which login methods its sessions may come from. Organizations without a
+// row, and sessions acting for no organization, use defaultTenantSettings.
+
+// Login methods a session can be started with
+const (
+	LoginMethodPassword = "password" // POST /auth/login
+	LoginMethodOAuth    = "oauth"    // Authorization code grant
+	LoginMethodDevice   = "device"   // Device authorization grant
+	LoginMethodAPIKey   = "api_key"  // Personal API key presented to ValidateToken
+)
+
+var loginMethods = []string{LoginMethodPassword, LoginMethodOAuth, LoginMethodDevice, LoginMethodAPIKey}
+
+const (
+	minTenantTokenTTL   = 60 // Seconds; shorter lifetimes are refused
+	maxPasswordLength   = 128
+	tenantSettingsCache = 30 * time.Second // How long other instances may serve stale settings
+)
+
+// PasswordPolicy lists the requirements for new passwords
+type PasswordPolicy struct {
+	MinLength        int  `json:"min_length"`
+	RequireUppercase bool `json:"require_uppercase"`
+	RequireLowercase bool `json:"require_lowercase"`
+	RequireDigit     bool `json:"require_digit"`
+	RequireSymbol    bool `json:"require_symbol"`
+}
+
+// TenantSettings is the configuration of one organization. Lifetimes are in seconds.
+type TenantSettings struct {
+	AccessTokenTTL  int            `json:"access_token_ttl"`
+	RefreshTokenTTL int            `json:"refresh_token_ttl"`
+	PasswordPolicy  PasswordPolicy `json:"password_policy"`
+	MFARequired     bool           `json:"mfa_required"`
+	LoginMethods    []string       `json:"login_methods"`
+}
+
+func defaultTenantSettings() TenantSettings {
+	return TenantSettings{
+		AccessTokenTTL:  int(accessTokenTTL.Seconds()),
+		RefreshTokenTTL: int(refreshTokenTTL.Seconds()),
+		PasswordPolicy:  PasswordPolicy{MinLength: 8},
+		LoginMethods:    append([]string(nil), loginMethods...),
+	}
+}
+
+// validate rejects settings outside the limits the server enforces for every client
+func (s *TenantSettings) validate() error {
+	if s.AccessTokenTTL < minTenantTokenTTL || time.Duration(s.AccessTokenTTL)*time.Second > maxAccessTokenTTL {
+		return fmt.Errorf("access_token_ttl must be between %d and %d seconds", minTenantTokenTTL, int(maxAccessTokenTTL.Seconds()))
+	}
+	if s.RefreshTokenTTL < s.AccessTokenTTL || time.Duration(s.RefreshTokenTTL)*time.Second > maxRefreshTokenTTL {
+		return fmt.Errorf("refresh_token_ttl must be between access_token_ttl and %d seconds", int(maxRefreshTokenTTL.Seconds()))
+	}
+	if s.PasswordPolicy.MinLength < 1 || s.PasswordPolicy.MinLength > maxPasswordLength {
+		return fmt.Errorf("password_policy.min_length must be between 1 and %d", maxPasswordLength)
+	}
+	if len(s.LoginMethods) == 0 {
+		return fmt.Errorf("at least one login method is required")
+	}
+	for _, m := range s.LoginMethods {
+		if !containsString(loginMethods, m) {
+			return fmt.Errorf("unknown login method %q", m)
+		}
+	}
+	return nil
+}
+
+// check returns a description of the first requirement the password does not meet
+func (p PasswordPolicy) check(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUppercase && !upper:
+		return errors.New("password must contain an uppercase letter")
+	case p.RequireLowercase && !lower:
+		return errors.New("password must contain a lowercase letter")
+	case p.RequireDigit && !digit:
+		return errors.New("password must contain a digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("password must contain a symbol")
+	}
+	return nil
+}
+
+// settingsCache keeps recently loaded settings in process. Writes through the admin API
+// invalidate the local entry; other instances pick changes up within tenantSettingsCache.
+var settingsCache = struct {
+	sync.Mutex
+	entries map[int]cachedTenantSettings
+}{entries: map[int]cachedTenantSettings{}}
+
+type cachedTenantSettings struct {
+	settings TenantSettings
+	loadedAt time.Time
+}
+
+// tenantSettings returns the effective settings of an organization, or the defaults for orgID 0
+func tenantSettings(orgID int) (TenantSettings, error) {
+	if orgID == 0 {
+		return defaultTenantSettings(), nil
+	}
+
+	settingsCache.Lock()
+	cached, ok := settingsCache.entries[orgID]
+	settingsCache.Unlock()
+	if ok && time.Since(cached.loadedAt) < tenantSettingsCache {
+		return cached.settings, nil
+	}
+
+	// Stored settings are decoded over the defaults so fields added later get their default
+	settings := defaultTenantSettings()
+	var data []byte
+	err := DB.QueryRow("SELECT settings FROM tenant_settings WHERE org_id = $1", orgID).Scan(&data)
+	if err != nil && err != sql.ErrNoRows {
+		return settings, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return defaultTenantSettings(), fmt.Errorf("corrupt settings for organization %d: %w", orgID, err)
+		}
+	}
+
+	settingsCache.Lock()
+	settingsCache.entries[orgID] = cachedTenantSettings{settings: settings, loadedAt: time.Now()}
+	settingsCache.Unlock()
+	return settings, nil
+}
+
+func invalidateTenantSettings(orgID int) {
+	settingsCache.Lock()
+	delete(settingsCache.entries, orgID)
+	settingsCache.Unlock()
+}
+
+// TenantPolicyError is returned when a session no longer satisfies its organization's settings
+type TenantPolicyError struct {
+	Reason string
+}
+
+func (e *TenantPolicyError) Error() string {
+	return "organization policy: " + e.Reason
+}
+
+// checkTenantSession enforces the organization's MFA and login method requirements.
+// It runs whenever tokens are issued for a session, so tightening the settings takes
+// effect at the next refresh.
+func checkTenantSession(sess *Session) error {
+	if sess.OrgID == 0 || sess.principalType() != PrincipalUser {
+		return nil
+	}
+	settings, err := tenantSettings(sess.OrgID)
+	if err != nil {
+		return fmt.Errorf("failed to load organization settings: %w", err)
+	}
+
+	if settings.MFARequired && !containsString(sess.AMR, amrOTP) {
+		return &TenantPolicyError{Reason: "multi-factor authentication is required"}
+	}
+	// Sessions from before login methods were recorded came from /auth/login
+	method := sess.LoginMethod
+	if method == "" {
+		method = LoginMethodPassword
+	}
+	if !containsString(settings.LoginMethods, method) {
+		return &TenantPolicyError{Reason: fmt.Sprintf("login method %q is not allowed", method)}
+	}
+	return nil
+}
+
+// checkTenantToken is checkTenantSession for a presented access token, which must also
+// be younger than the access token lifetime the session would be issued today. Lowering
+// an organization's lifetime therefore applies to tokens already handed out.
+func checkTenantToken(claims *Claims, sess *Session) error {
+	if err := checkTenantSession(sess); err != nil || sess.OrgID == 0 {
+		return err
+	}
+	accessTTL, _ := tokenLifetimes(*sess)
+	if claims.IssuedAt != nil && time.Since(claims.IssuedAt.Time) > accessTTL {
+		return &TenantPolicyError{Reason: "access token exceeds the organization's lifetime"}
+	}
+	return nil
+}
+
+// --- Admin API ---
+
+// AdminGetTenantSettingsHandler returns an organization's effective settings
+func AdminGetTenantSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := adminOrganization(w, r)
+	if !ok {
+		return
+	}
+	invalidateTenantSettings(org.ID)
+	settings, err := tenantSettings(org.ID)
+	if err != nil {
+		log.Printf("Database error loading organization settings: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, settings)
+}
+
+// AdminPutTenantSettingsHandler replaces an organization's settings. Omitted fields take
+// their defaults.
+func AdminPutTenantSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := adminOrganization(w, r)
+	if !ok {
+		return
+	}
+	settings := defaultTenantSettings()
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := settings.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, _ := json.Marshal(settings)
+	_, err := DB.Exec(`INSERT INTO tenant_settings (org_id, settings) VALUES ($1, $2)
+		ON CONFLICT (org_id) DO UPDATE SET settings = EXCLUDED.settings, updated_at = NOW()`, org.ID, data)
+	if err != nil {
+		log.Printf("Database error saving organization settings: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	invalidateTenantSettings(org.ID)
+
+	log.Printf("Admin updated settings of organization %s", org.Slug)
+	writeAdminJSON(w, http.StatusOK, settings)
+}
+
+// AdminResetTenantSettingsHandler returns an organization to the default settings
+func AdminResetTenantSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := adminOrganization(w, r)
+	if !ok {
+		return
+	}
+	if _, err := DB.Exec("DELETE FROM tenant_settings WHERE org_id = $1", org.ID); err != nil {
+		log.Printf("Database error resetting organization settings: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	invalidateTenantSettings(org.ID)
+
+	log.Printf("Admin reset settings of organization %s", org.Slug)
+	w.WriteHeader(http.StatusNoContent)
+}
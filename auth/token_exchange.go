@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// --- OAuth 2.0 Token Exchange (RFC 8693) ---
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+	jwtTokenType           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// handleTokenExchangeGrant trades a subject's access token for a new token restricted to
+// the requested audience and scope, with the calling client recorded in the act claim.
+func handleTokenExchangeGrant(w http.ResponseWriter, r *http.Request, client *OAuthClient, cnf *Confirmation) {
+	ctx := r.Context()
+
+	if client.IsPublic() {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Public clients cannot exchange tokens")
+		return
+	}
+	if r.PostForm.Get("actor_token") != "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "actor_token is not supported; the authenticated client is the actor")
+		return
+	}
+
+	// 1. Validate the subject token through the same checks as ValidateToken
+	switch r.PostForm.Get("subject_token_type") {
+	case accessTokenType, jwtTokenType:
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "subject_token_type must be an access token")
+		return
+	}
+
+	subject, err := parseAccessToken(r.PostForm.Get("subject_token"))
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Subject token is invalid or expired")
+		return
+	}
+	// A bound subject token is presented by proving its key on this request: the DPoP proof
+	// and client certificate already checked for cnf must be the ones it is bound to
+	if err := checkPresentedBinding(subject.Cnf, cnf); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Subject token binding check failed: "+err.Error())
+		return
+	}
+	subjectSession, err := loadTokenSession(ctx, subject)
+	var invalid *InvalidTokenError
+	if errors.As(err, &invalid) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Subject token rejected: "+invalid.Reason)
+		return
+	} else if err != nil {
+		log.Printf("Error checking subject session: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// 2. Only a client the subject token was issued to or meant for may exchange it
+	if subject.ClientID != client.ClientID && !audienceIncludes(subject.Audience, client.ClientID) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Subject token is not intended for this client")
+		return
+	}
+
+	// 3. The target audience must be named, and each target must be a registered client
+	audience, err := exchangeAudience(r)
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", err.Error())
+		return
+	}
+
+	// 4. Scope may only be narrowed
+	scope, ok := resolveScope(r.PostForm.Get("scope"), strings.Fields(subjectSession.Scope))
+	if !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the subject token's scope")
+		return
+	}
+
+	// 5. Issue a refresh-less token tied to the subject's session, never outliving it
+	ttl, _ := tokenLifetimes(Session{ClientID: client.ClientID, OrgID: subjectSession.OrgID})
+	if remaining := time.Until(subject.ExpiresAt.Time); remaining < ttl {
+		ttl = remaining
+	}
+
+	sessionID := uuid.New().String()
+	sess := Session{
+		UserID:          subjectSession.UserID,
+		ClientID:        client.ClientID,
+		Scope:           scope,
+		AuthTime:        subjectSession.AuthTime,
+		LoginMethod:     subjectSession.LoginMethod,
+		AMR:             subjectSession.AMR,
+		PrincipalType:   subjectSession.PrincipalType,
+		Audience:        audience,
+		Actor:           &Actor{Sub: client.ClientID, Act: subject.Act},
+		ParentSessionID: subject.SessionID,
+		ImpersonatorID:  subjectSession.ImpersonatorID,
+		Cnf:             cnf,
+		Roles:           subjectSession.Roles,
+		Permissions:     subjectSession.Permissions,
+		Elevations:      subjectSession.Elevations,
+		ElevatedUntil:   subjectSession.ElevatedUntil,
+		OrgID:           subjectSession.OrgID,
+	}
+	if sess.PrincipalType == PrincipalService {
+		// The subject is itself a service; keep its identity as the subject
+		sess.ClientID = subjectSession.ClientID
+	}
+	ttl = elevationAccessTTL(&sess, ttl)
+
+	accessToken, err := generateJWT(sessionID, sess, ttl)
+	if err != nil {
+		log.Printf("Error generating exchanged token: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if err := saveSession(ctx, sessionID, sess, ttl); err != nil {
+		log.Printf("Failed to save exchanged session: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, OAuthTokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: accessTokenType,
+		TokenType:       tokenTypeFor(sess),
+		ExpiresIn:       int(ttl.Seconds()),
+		Scope:           scope,
+	})
+}
+
+// exchangeAudience collects the audience and resource parameters; each must name a registered client
+func exchangeAudience(r *http.Request) ([]string, error) {
+	var audience []string
+	for _, a := range append(r.PostForm["audience"], r.PostForm["resource"]...) {
+		if a != "" && !containsString(audience, a) {
+			audience = append(audience, a)
+		}
+	}
+	if len(audience) == 0 {
+		return nil, fmt.Errorf("audience is required")
+	}
+
+	for _, a := range audience {
+		if _, err := getOAuthClient(a); err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown audience %q", a)
+		} else if err != nil {
+			log.Printf("Database error checking audience: %v", err)
+			return nil, fmt.Errorf("audience could not be verified")
+		}
+	}
+	return audience, nil
+}
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS name,
+    DROP COLUMN IF EXISTS email_verified,
+    DROP COLUMN IF EXISTS updated_at;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN name VARCHAR(255),
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
\ No newline at end of file
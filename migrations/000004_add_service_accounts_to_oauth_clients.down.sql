@@ -0,0 +1,4 @@
+ALTER TABLE oauth_clients
+    DROP COLUMN IF EXISTS grant_types,
+    DROP COLUMN IF EXISTS token_endpoint_auth_method,
+    DROP COLUMN IF EXISTS jwks;
\ No newline at end of file
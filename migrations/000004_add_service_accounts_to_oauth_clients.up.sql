@@ -0,0 +1,7 @@
+ALTER TABLE oauth_clients
+    ADD COLUMN grant_types TEXT[] NOT NULL DEFAULT '{authorization_code,refresh_token}',
+    ADD COLUMN token_endpoint_auth_method VARCHAR(50) NOT NULL DEFAULT 'client_secret_basic',
+    ADD COLUMN jwks JSONB; -- Public keys for private_key_jwt client authentication
+
+-- Existing clients without a secret are public clients
+UPDATE oauth_clients SET token_endpoint_auth_method = 'none' WHERE client_secret_hash IS NULL;
\ No newline at end of file
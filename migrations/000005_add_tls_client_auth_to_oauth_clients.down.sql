@@ -0,0 +1,2 @@
+ALTER TABLE oauth_clients
+    DROP COLUMN IF EXISTS tls_client_auth_subject_dn;
\ No newline at end of file
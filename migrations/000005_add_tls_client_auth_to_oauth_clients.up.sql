@@ -0,0 +1,2 @@
+ALTER TABLE oauth_clients
+    ADD COLUMN tls_client_auth_subject_dn TEXT; -- Expected certificate subject for tls_client_auth clients
\ No newline at end of file
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS initial_access_tokens;
+
+ALTER TABLE oauth_clients
+    ADD COLUMN client_secret_hash TEXT,
+    DROP COLUMN IF EXISTS access_token_ttl,
+    DROP COLUMN IF EXISTS refresh_token_ttl,
+    DROP COLUMN IF EXISTS registration_access_token_hash,
+    DROP COLUMN IF EXISTS updated_at;
+
+-- Keep the newest unexpired secret of each client
+UPDATE oauth_clients c SET client_secret_hash = (
+    SELECT s.secret_hash FROM oauth_client_secrets s
+    WHERE s.client_id = c.client_id AND (s.expires_at IS NULL OR s.expires_at > NOW())
+    ORDER BY s.created_at DESC LIMIT 1
+);
+
+DROP TABLE IF EXISTS oauth_client_secrets;
\ No newline at end of file
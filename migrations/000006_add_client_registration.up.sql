@@ -0,0 +1,29 @@
+CREATE TABLE oauth_client_secrets (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    secret_hash TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE -- NULL for the current secret; set on rotated-out secrets
+);
+
+CREATE INDEX idx_oauth_client_secrets_client_id ON oauth_client_secrets(client_id);
+
+INSERT INTO oauth_client_secrets (client_id, secret_hash)
+    SELECT client_id, client_secret_hash FROM oauth_clients WHERE client_secret_hash IS NOT NULL;
+
+ALTER TABLE oauth_clients
+    DROP COLUMN client_secret_hash,
+    ADD COLUMN access_token_ttl INTEGER, -- Seconds; NULL uses the service default
+    ADD COLUMN refresh_token_ttl INTEGER,
+    ADD COLUMN registration_access_token_hash TEXT, -- SHA-256 of the RFC 7592 registration access token
+    ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+CREATE TABLE initial_access_tokens (
+    id SERIAL PRIMARY KEY,
+    token_hash TEXT UNIQUE NOT NULL, -- SHA-256 of the token
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    max_uses INTEGER, -- NULL for unlimited registrations
+    use_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
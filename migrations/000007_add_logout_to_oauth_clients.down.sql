@@ -0,0 +1,6 @@
+ALTER TABLE oauth_clients
+    DROP COLUMN IF EXISTS post_logout_redirect_uris,
+    DROP COLUMN IF EXISTS backchannel_logout_uri,
+    DROP COLUMN IF EXISTS backchannel_logout_session_required,
+    DROP COLUMN IF EXISTS frontchannel_logout_uri,
+    DROP COLUMN IF EXISTS frontchannel_logout_session_required;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE oauth_clients
+    ADD COLUMN post_logout_redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN backchannel_logout_uri TEXT, -- Receives signed logout tokens (OIDC Back-Channel Logout)
+    ADD COLUMN backchannel_logout_session_required BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN frontchannel_logout_uri TEXT, -- Loaded in an iframe on logout (OIDC Front-Channel Logout)
+    ADD COLUMN frontchannel_logout_session_required BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS oauth_consents;
+
+ALTER TABLE oauth_clients
+    DROP COLUMN IF EXISTS first_party;
\ No newline at end of file
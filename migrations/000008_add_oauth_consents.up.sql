@@ -0,0 +1,12 @@
+ALTER TABLE oauth_clients
+    ADD COLUMN first_party BOOLEAN NOT NULL DEFAULT FALSE; -- First-party clients are pre-consented
+
+CREATE TABLE oauth_consents (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(255) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, client_id)
+);
\ No newline at end of file
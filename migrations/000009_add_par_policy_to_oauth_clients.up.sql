@@ -0,0 +1,2 @@
+ALTER TABLE oauth_clients
+    ADD COLUMN require_pushed_authorization_requests BOOLEAN NOT NULL DEFAULT FALSE; -- Reject authorization requests not made through PAR
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS access_policies;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE access_policies (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    effect VARCHAR(5) NOT NULL CHECK (effect IN ('allow', 'deny')),
+    actions TEXT[] NOT NULL, -- e.g. {documents:read,documents:*}
+    resource_types TEXT[] NOT NULL DEFAULT '{}', -- empty matches every type
+    roles TEXT[] NOT NULL DEFAULT '{}', -- empty matches every subject
+    conditions JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS relation_tuples;
+DROP TABLE IF EXISTS rebac_revision;
+DROP TABLE IF EXISTS rebac_schema;
\ No newline at end of file
@@ -0,0 +1,28 @@
+-- Namespace configurations; the row with the highest id is current
+CREATE TABLE rebac_schema (
+    id SERIAL PRIMARY KEY,
+    source TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Single-row counter bumped by every tuple write, encoded in zookies
+CREATE TABLE rebac_revision (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    revision BIGINT NOT NULL
+);
+INSERT INTO rebac_revision (revision) VALUES (0);
+
+-- namespace:object_id#relation@subject_namespace:subject_id[#subject_relation]
+CREATE TABLE relation_tuples (
+    namespace VARCHAR(64) NOT NULL,
+    object_id VARCHAR(255) NOT NULL,
+    relation VARCHAR(64) NOT NULL,
+    subject_namespace VARCHAR(64) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    subject_relation VARCHAR(64) NOT NULL DEFAULT '', -- set for usersets
+    revision BIGINT NOT NULL, -- revision of the write that added the tuple
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (namespace, object_id, relation, subject_namespace, subject_id, subject_relation)
+);
+
+CREATE INDEX idx_relation_tuples_subject ON relation_tuples(subject_namespace, subject_id, subject_relation);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS organization_member_roles;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
\ No newline at end of file
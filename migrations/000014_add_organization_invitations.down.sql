@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS organization_invitations;
+ALTER TABLE organizations DROP COLUMN IF EXISTS invite_only;
\ No newline at end of file
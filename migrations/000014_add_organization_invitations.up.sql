@@ -0,0 +1,18 @@
+-- Existing organizations keep accepting self sign-up with their slug;
+-- AdminCreateOrganizationHandler makes new ones invite-only unless asked otherwise
+ALTER TABLE organizations ADD COLUMN invite_only BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE organization_invitations (
+    id UUID PRIMARY KEY,
+    org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role_id INTEGER REFERENCES roles(id) ON DELETE SET NULL,
+    invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL, -- NULL when created with ADMIN_API_TOKEN
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    accepted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_organization_invitations_org_id ON organization_invitations(org_id);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS tenant_settings;
\ No newline at end of file
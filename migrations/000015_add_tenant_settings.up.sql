@@ -0,0 +1,6 @@
+-- Per-organization overrides of token lifetimes, password policy, MFA and login methods
+CREATE TABLE tenant_settings (
+    org_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    settings JSONB NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
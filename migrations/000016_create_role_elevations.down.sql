@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS role_elevation_events;
+DROP TABLE IF EXISTS role_elevations;
+DROP TABLE IF EXISTS role_elevation_policies;
\ No newline at end of file
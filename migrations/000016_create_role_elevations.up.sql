@@ -0,0 +1,37 @@
+-- Roles users may request for a limited time, and for how long
+CREATE TABLE role_elevation_policies (
+    role_id INTEGER PRIMARY KEY REFERENCES roles(id) ON DELETE CASCADE,
+    max_duration INTEGER NOT NULL, -- Seconds
+    requires_approval BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE TABLE role_elevations (
+    id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INTEGER REFERENCES roles(id) ON DELETE SET NULL,
+    role VARCHAR(100) NOT NULL, -- Name at request time, kept for the audit trail
+    reason TEXT NOT NULL,
+    duration INTEGER NOT NULL, -- Seconds, counted from activation
+    status VARCHAR(20) NOT NULL, -- pending, active, denied, expired, revoked or cancelled
+    requested_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    decided_by INTEGER REFERENCES users(id) ON DELETE SET NULL, -- NULL when decided with ADMIN_API_TOKEN
+    decided_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE, -- Set once active
+    ended_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_role_elevations_user_id ON role_elevations(user_id);
+-- At most one open request per user and role
+CREATE UNIQUE INDEX idx_role_elevations_open ON role_elevations(user_id, role_id) WHERE status IN ('pending', 'active');
+
+-- Audit trail: one row per state change
+CREATE TABLE role_elevation_events (
+    id SERIAL PRIMARY KEY,
+    elevation_id UUID NOT NULL REFERENCES role_elevations(id) ON DELETE CASCADE,
+    event VARCHAR(20) NOT NULL, -- requested, activated, approved, denied, expired, revoked or cancelled
+    actor VARCHAR(100) NOT NULL, -- user:{id}, admin_token or system
+    detail TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_role_elevation_events_elevation_id ON role_elevation_events(elevation_id);
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- Audit trail of admins signing in as users
+CREATE TABLE impersonation_sessions (
+    session_id UUID PRIMARY KEY,
+    admin_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    org_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_at TIMESTAMP WITH TIME ZONE, -- Set when ended early
+    ended_by INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_impersonation_sessions_user_id ON impersonation_sessions(user_id);
+CREATE INDEX idx_impersonation_sessions_admin_id ON impersonation_sessions(admin_id);
\ No newline at end of file
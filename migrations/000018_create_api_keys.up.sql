@@ -0,0 +1,21 @@
+-- Long-lived credentials for scripts and integrations, owned by a user or a service client
+CREATE TABLE api_keys (
+    id VARCHAR(32) PRIMARY KEY, -- Public part of the key, also shown in listings
+    kind VARCHAR(20) NOT NULL, -- personal or service
+    name VARCHAR(255) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(255) REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    org_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    secret_hash TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '', -- Space-delimited
+    amr TEXT[] NOT NULL DEFAULT '{}', -- Authentication methods of the session that created a personal key
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    CHECK ((user_id IS NULL) <> (client_id IS NULL))
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX idx_api_keys_client_id ON api_keys(client_id);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS capabilities;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- Attenuable capability tokens. The token itself carries its caveats and signature; the
+-- row records who issued it, for verification against their permissions and revocation.
+CREATE TABLE capabilities (
+    id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    org_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    caveats TEXT[] NOT NULL DEFAULT '{}', -- Caveats set at issuance; holders may have added more
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_capabilities_user_id ON capabilities(user_id);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- TOTP second factor; the secret is pending until totp_enabled_at is set
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMP WITH TIME ZONE;
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM permissions WHERE name = 'relationships:write';
\ No newline at end of file
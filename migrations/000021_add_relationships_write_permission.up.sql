@@ -0,0 +1,4 @@
+-- Users need this permission to write relation tuples; service clients need it as a scope
+INSERT INTO permissions (name, description) VALUES ('relationships:write', 'Write relation tuples');
+INSERT INTO role_permissions (role_id, permission_id)
+    SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin' AND p.name = 'relationships:write';
\ No newline at end of file
@@ -21,12 +21,171 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Kind of principal a token was issued to
+type PrincipalType int32
+
+const (
+	PrincipalType_PRINCIPAL_TYPE_UNSPECIFIED PrincipalType = 0
+	PrincipalType_PRINCIPAL_TYPE_USER        PrincipalType = 1 // A human user (password login or OAuth authorization code)
+	PrincipalType_PRINCIPAL_TYPE_SERVICE     PrincipalType = 2 // A service account (OAuth client_credentials)
+)
+
+// Enum value maps for PrincipalType.
+var (
+	PrincipalType_name = map[int32]string{
+		0: "PRINCIPAL_TYPE_UNSPECIFIED",
+		1: "PRINCIPAL_TYPE_USER",
+		2: "PRINCIPAL_TYPE_SERVICE",
+	}
+	PrincipalType_value = map[string]int32{
+		"PRINCIPAL_TYPE_UNSPECIFIED": 0,
+		"PRINCIPAL_TYPE_USER":        1,
+		"PRINCIPAL_TYPE_SERVICE":     2,
+	}
+)
+
+func (x PrincipalType) Enum() *PrincipalType {
+	p := new(PrincipalType)
+	*p = x
+	return p
+}
+
+func (x PrincipalType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PrincipalType) Descriptor() protoreflect.EnumDescriptor {
+	return file_auth_proto_enumTypes[0].Descriptor()
+}
+
+func (PrincipalType) Type() protoreflect.EnumType {
+	return &file_auth_proto_enumTypes[0]
+}
+
+func (x PrincipalType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PrincipalType.Descriptor instead.
+func (PrincipalType) EnumDescriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{0}
+}
+
+type RelationTupleUpdate_Operation int32
+
+const (
+	RelationTupleUpdate_OPERATION_UNSPECIFIED RelationTupleUpdate_Operation = 0
+	RelationTupleUpdate_OPERATION_TOUCH       RelationTupleUpdate_Operation = 1 // Insert, or keep if present
+	RelationTupleUpdate_OPERATION_DELETE      RelationTupleUpdate_Operation = 2
+)
+
+// Enum value maps for RelationTupleUpdate_Operation.
+var (
+	RelationTupleUpdate_Operation_name = map[int32]string{
+		0: "OPERATION_UNSPECIFIED",
+		1: "OPERATION_TOUCH",
+		2: "OPERATION_DELETE",
+	}
+	RelationTupleUpdate_Operation_value = map[string]int32{
+		"OPERATION_UNSPECIFIED": 0,
+		"OPERATION_TOUCH":       1,
+		"OPERATION_DELETE":      2,
+	}
+)
+
+func (x RelationTupleUpdate_Operation) Enum() *RelationTupleUpdate_Operation {
+	p := new(RelationTupleUpdate_Operation)
+	*p = x
+	return p
+}
+
+func (x RelationTupleUpdate_Operation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (RelationTupleUpdate_Operation) Descriptor() protoreflect.EnumDescriptor {
+	return file_auth_proto_enumTypes[1].Descriptor()
+}
+
+func (RelationTupleUpdate_Operation) Type() protoreflect.EnumType {
+	return &file_auth_proto_enumTypes[1]
+}
+
+func (x RelationTupleUpdate_Operation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use RelationTupleUpdate_Operation.Descriptor instead.
+func (RelationTupleUpdate_Operation) EnumDescriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{14, 0}
+}
+
+type Consistency_Requirement int32
+
+const (
+	Consistency_REQUIREMENT_MINIMIZE_LATENCY  Consistency_Requirement = 0 // Cached results may be used
+	Consistency_REQUIREMENT_AT_LEAST_AS_FRESH Consistency_Requirement = 1 // Results must reflect every write up to zookie
+	Consistency_REQUIREMENT_FULLY_CONSISTENT  Consistency_Requirement = 2 // Evaluate against the latest data
+)
+
+// Enum value maps for Consistency_Requirement.
+var (
+	Consistency_Requirement_name = map[int32]string{
+		0: "REQUIREMENT_MINIMIZE_LATENCY",
+		1: "REQUIREMENT_AT_LEAST_AS_FRESH",
+		2: "REQUIREMENT_FULLY_CONSISTENT",
+	}
+	Consistency_Requirement_value = map[string]int32{
+		"REQUIREMENT_MINIMIZE_LATENCY":  0,
+		"REQUIREMENT_AT_LEAST_AS_FRESH": 1,
+		"REQUIREMENT_FULLY_CONSISTENT":  2,
+	}
+)
+
+func (x Consistency_Requirement) Enum() *Consistency_Requirement {
+	p := new(Consistency_Requirement)
+	*p = x
+	return p
+}
+
+func (x Consistency_Requirement) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Consistency_Requirement) Descriptor() protoreflect.EnumDescriptor {
+	return file_auth_proto_enumTypes[2].Descriptor()
+}
+
+func (Consistency_Requirement) Type() protoreflect.EnumType {
+	return &file_auth_proto_enumTypes[2]
+}
+
+func (x Consistency_Requirement) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Consistency_Requirement.Descriptor instead.
+func (Consistency_Requirement) EnumDescriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{15, 0}
+}
+
 // Request message for ValidateToken
 type ValidateTokenRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Token string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	// DPoP-bound tokens (cnf.jkt) must be presented with the client's proof
+	// and the method and URL of the request it was sent with.
+	DpopProof  string `protobuf:"bytes,2,opt,name=dpop_proof,json=dpopProof,proto3" json:"dpop_proof,omitempty"`
+	HttpMethod string `protobuf:"bytes,3,opt,name=http_method,json=httpMethod,proto3" json:"http_method,omitempty"`
+	HttpUrl    string `protobuf:"bytes,4,opt,name=http_url,json=httpUrl,proto3" json:"http_url,omitempty"`
+	// Certificate-bound tokens (cnf.x5t#S256) must be presented over mTLS;
+	// pass the DER-encoded client certificate the caller authenticated with.
+	ClientCertificate []byte `protobuf:"bytes,5,opt,name=client_certificate,json=clientCertificate,proto3" json:"client_certificate,omitempty"`
+	// When set, the token's aud claim must contain this value (typically the
+	// calling service's own identifier).
+	ExpectedAudience string `protobuf:"bytes,6,opt,name=expected_audience,json=expectedAudience,proto3" json:"expected_audience,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *ValidateTokenRequest) Reset() {
@@ -66,12 +225,59 @@ func (x *ValidateTokenRequest) GetToken() string {
 	return ""
 }
 
+func (x *ValidateTokenRequest) GetDpopProof() string {
+	if x != nil {
+		return x.DpopProof
+	}
+	return ""
+}
+
+func (x *ValidateTokenRequest) GetHttpMethod() string {
+	if x != nil {
+		return x.HttpMethod
+	}
+	return ""
+}
+
+func (x *ValidateTokenRequest) GetHttpUrl() string {
+	if x != nil {
+		return x.HttpUrl
+	}
+	return ""
+}
+
+func (x *ValidateTokenRequest) GetClientCertificate() []byte {
+	if x != nil {
+		return x.ClientCertificate
+	}
+	return nil
+}
+
+func (x *ValidateTokenRequest) GetExpectedAudience() string {
+	if x != nil {
+		return x.ExpectedAudience
+	}
+	return ""
+}
+
 // Response message for ValidateToken
 type ValidateTokenResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	IsValid       bool                   `protobuf:"varint,1,opt,name=is_valid,json=isValid,proto3" json:"is_valid,omitempty"`
-	UserId        int32                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"` // User ID extracted from the token claims
+	UserId        int32                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"` // User ID extracted from the token claims (0 for service principals)
 	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`                  // Error message if not valid
+	PrincipalType PrincipalType          `protobuf:"varint,4,opt,name=principal_type,json=principalType,proto3,enum=auth.PrincipalType" json:"principal_type,omitempty"`
+	ClientId      string                 `protobuf:"bytes,5,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`    // OAuth client the token was issued to, empty for /auth/login tokens
+	Scope         string                 `protobuf:"bytes,6,opt,name=scope,proto3" json:"scope,omitempty"`                          // Space-delimited granted scopes
+	Audience      []string               `protobuf:"bytes,7,rep,name=audience,proto3" json:"audience,omitempty"`                    // Intended recipients; empty means unrestricted
+	Actor         string                 `protobuf:"bytes,8,opt,name=actor,proto3" json:"actor,omitempty"`                          // Client acting on behalf of the subject for exchanged tokens (act.sub)
+	Subject       string                 `protobuf:"bytes,9,opt,name=subject,proto3" json:"subject,omitempty"`                      // sub claim: user ID for users, client ID for service principals
+	Issuer        string                 `protobuf:"bytes,10,opt,name=issuer,proto3" json:"issuer,omitempty"`                       // iss claim
+	Roles         []string               `protobuf:"bytes,11,rep,name=roles,proto3" json:"roles,omitempty"`                         // Roles granted to the subject when the token was issued
+	Permissions   []string               `protobuf:"bytes,12,rep,name=permissions,proto3" json:"permissions,omitempty"`             // Permissions granted by those roles
+	OrgId         int32                  `protobuf:"varint,13,opt,name=org_id,json=orgId,proto3" json:"org_id,omitempty"`           // Organization (tenant) the token acts for, 0 for none
+	Impersonation bool                   `protobuf:"varint,14,opt,name=impersonation,proto3" json:"impersonation,omitempty"`        // An admin (actor) is signed in as the user; treat as read-only
+	ApiKeyId      string                 `protobuf:"bytes,15,opt,name=api_key_id,json=apiKeyId,proto3" json:"api_key_id,omitempty"` // Set when the token is an API key rather than a session's access token
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -127,20 +333,1749 @@ func (x *ValidateTokenResponse) GetError() string {
 	return ""
 }
 
-var File_auth_proto protoreflect.FileDescriptor
+func (x *ValidateTokenResponse) GetPrincipalType() PrincipalType {
+	if x != nil {
+		return x.PrincipalType
+	}
+	return PrincipalType_PRINCIPAL_TYPE_UNSPECIFIED
+}
 
-const file_auth_proto_rawDesc = "" +
-	"\n" +
-	"\n" +
-	"auth.proto\x12\x04auth\",\n" +
-	"\x14ValidateTokenRequest\x12\x14\n" +
-	"\x05token\x18\x01 \x01(\tR\x05token\"a\n" +
-	"\x15ValidateTokenResponse\x12\x19\n" +
-	"\bis_valid\x18\x01 \x01(\bR\aisValid\x12\x17\n" +
-	"\auser_id\x18\x02 \x01(\x05R\x06userId\x12\x14\n" +
-	"\x05error\x18\x03 \x01(\tR\x05error2\\\n" +
+func (x *ValidateTokenResponse) GetClientId() string {
+	if x != nil {
+		return x.ClientId
+	}
+	return ""
+}
+
+func (x *ValidateTokenResponse) GetScope() string {
+	if x != nil {
+		return x.Scope
+	}
+	return ""
+}
+
+func (x *ValidateTokenResponse) GetAudience() []string {
+	if x != nil {
+		return x.Audience
+	}
+	return nil
+}
+
+func (x *ValidateTokenResponse) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *ValidateTokenResponse) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *ValidateTokenResponse) GetIssuer() string {
+	if x != nil {
+		return x.Issuer
+	}
+	return ""
+}
+
+func (x *ValidateTokenResponse) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+func (x *ValidateTokenResponse) GetPermissions() []string {
+	if x != nil {
+		return x.Permissions
+	}
+	return nil
+}
+
+func (x *ValidateTokenResponse) GetOrgId() int32 {
+	if x != nil {
+		return x.OrgId
+	}
+	return 0
+}
+
+func (x *ValidateTokenResponse) GetImpersonation() bool {
+	if x != nil {
+		return x.Impersonation
+	}
+	return false
+}
+
+func (x *ValidateTokenResponse) GetApiKeyId() string {
+	if x != nil {
+		return x.ApiKeyId
+	}
+	return ""
+}
+
+// Resource an action is performed on. Attributes are supplied by the calling
+// service, which owns the resource.
+type Resource struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"` // e.g. "document"
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	OwnerId       string                 `protobuf:"bytes,3,opt,name=owner_id,json=ownerId,proto3" json:"owner_id,omitempty"`    // sub of the resource's owner, for owner conditions
+	TenantId      string                 `protobuf:"bytes,4,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"` // Tenant the resource belongs to, for tenant conditions
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Resource) Reset() {
+	*x = Resource{}
+	mi := &file_auth_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Resource) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Resource) ProtoMessage() {}
+
+func (x *Resource) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Resource.ProtoReflect.Descriptor instead.
+func (*Resource) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Resource) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Resource) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Resource) GetOwnerId() string {
+	if x != nil {
+		return x.OwnerId
+	}
+	return ""
+}
+
+func (x *Resource) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+// A single action on a single resource
+type PermissionCheck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Action        string                 `protobuf:"bytes,1,opt,name=action,proto3" json:"action,omitempty"` // Permission name, e.g. "documents:read"
+	Resource      *Resource              `protobuf:"bytes,2,opt,name=resource,proto3" json:"resource,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PermissionCheck) Reset() {
+	*x = PermissionCheck{}
+	mi := &file_auth_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PermissionCheck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PermissionCheck) ProtoMessage() {}
+
+func (x *PermissionCheck) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PermissionCheck.ProtoReflect.Descriptor instead.
+func (*PermissionCheck) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PermissionCheck) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *PermissionCheck) GetResource() *Resource {
+	if x != nil {
+		return x.Resource
+	}
+	return nil
+}
+
+// Request message for CheckPermission
+type CheckPermissionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The subject's token, validated exactly as by ValidateToken
+	Token         *ValidateTokenRequest `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Check         *PermissionCheck      `protobuf:"bytes,2,opt,name=check,proto3" json:"check,omitempty"`
+	ClientIp      string                `protobuf:"bytes,3,opt,name=client_ip,json=clientIp,proto3" json:"client_ip,omitempty"` // IP address of the end user's request, for IP conditions
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckPermissionRequest) Reset() {
+	*x = CheckPermissionRequest{}
+	mi := &file_auth_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckPermissionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckPermissionRequest) ProtoMessage() {}
+
+func (x *CheckPermissionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckPermissionRequest.ProtoReflect.Descriptor instead.
+func (*CheckPermissionRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CheckPermissionRequest) GetToken() *ValidateTokenRequest {
+	if x != nil {
+		return x.Token
+	}
+	return nil
+}
+
+func (x *CheckPermissionRequest) GetCheck() *PermissionCheck {
+	if x != nil {
+		return x.Check
+	}
+	return nil
+}
+
+func (x *CheckPermissionRequest) GetClientIp() string {
+	if x != nil {
+		return x.ClientIp
+	}
+	return ""
+}
+
+// Response message for CheckPermission
+type CheckPermissionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Allowed       bool                   `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	Reason        string                 `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"` // Human-readable explanation of the decision
+	Policy        string                 `protobuf:"bytes,3,opt,name=policy,proto3" json:"policy,omitempty"` // Name of the deciding policy, empty for role permissions and the default deny
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`   // Set when the token is not valid; allowed is then false
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckPermissionResponse) Reset() {
+	*x = CheckPermissionResponse{}
+	mi := &file_auth_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckPermissionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckPermissionResponse) ProtoMessage() {}
+
+func (x *CheckPermissionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckPermissionResponse.ProtoReflect.Descriptor instead.
+func (*CheckPermissionResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CheckPermissionResponse) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+func (x *CheckPermissionResponse) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *CheckPermissionResponse) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+func (x *CheckPermissionResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Request message for BatchCheckPermission
+type BatchCheckPermissionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         *ValidateTokenRequest  `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Checks        []*PermissionCheck     `protobuf:"bytes,2,rep,name=checks,proto3" json:"checks,omitempty"`
+	ClientIp      string                 `protobuf:"bytes,3,opt,name=client_ip,json=clientIp,proto3" json:"client_ip,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchCheckPermissionRequest) Reset() {
+	*x = BatchCheckPermissionRequest{}
+	mi := &file_auth_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchCheckPermissionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchCheckPermissionRequest) ProtoMessage() {}
+
+func (x *BatchCheckPermissionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchCheckPermissionRequest.ProtoReflect.Descriptor instead.
+func (*BatchCheckPermissionRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchCheckPermissionRequest) GetToken() *ValidateTokenRequest {
+	if x != nil {
+		return x.Token
+	}
+	return nil
+}
+
+func (x *BatchCheckPermissionRequest) GetChecks() []*PermissionCheck {
+	if x != nil {
+		return x.Checks
+	}
+	return nil
+}
+
+func (x *BatchCheckPermissionRequest) GetClientIp() string {
+	if x != nil {
+		return x.ClientIp
+	}
+	return ""
+}
+
+// Response message for BatchCheckPermission
+type BatchCheckPermissionResponse struct {
+	state         protoimpl.MessageState     `protogen:"open.v1"`
+	Results       []*CheckPermissionResponse `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"` // One per check, in request order
+	Error         string                     `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`     // Set when the token is not valid; results is then empty
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchCheckPermissionResponse) Reset() {
+	*x = BatchCheckPermissionResponse{}
+	mi := &file_auth_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchCheckPermissionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchCheckPermissionResponse) ProtoMessage() {}
+
+func (x *BatchCheckPermissionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchCheckPermissionResponse.ProtoReflect.Descriptor instead.
+func (*BatchCheckPermissionResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BatchCheckPermissionResponse) GetResults() []*CheckPermissionResponse {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *BatchCheckPermissionResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Request message for IssueCapability
+type IssueCapabilityRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The issuing user's token; it must be a first-party user token, not an API key
+	Token *ValidateTokenRequest `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	// Caveats every use must satisfy, e.g. "action = documents:read" or "resource = document:42"
+	Caveats       []string `protobuf:"bytes,2,rep,name=caveats,proto3" json:"caveats,omitempty"`
+	ExpiresIn     int64    `protobuf:"varint,3,opt,name=expires_in,json=expiresIn,proto3" json:"expires_in,omitempty"` // Seconds; 0 means the default lifetime
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IssueCapabilityRequest) Reset() {
+	*x = IssueCapabilityRequest{}
+	mi := &file_auth_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IssueCapabilityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IssueCapabilityRequest) ProtoMessage() {}
+
+func (x *IssueCapabilityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IssueCapabilityRequest.ProtoReflect.Descriptor instead.
+func (*IssueCapabilityRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *IssueCapabilityRequest) GetToken() *ValidateTokenRequest {
+	if x != nil {
+		return x.Token
+	}
+	return nil
+}
+
+func (x *IssueCapabilityRequest) GetCaveats() []string {
+	if x != nil {
+		return x.Caveats
+	}
+	return nil
+}
+
+func (x *IssueCapabilityRequest) GetExpiresIn() int64 {
+	if x != nil {
+		return x.ExpiresIn
+	}
+	return 0
+}
+
+// Response message for IssueCapability
+type IssueCapabilityResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Capability    string                 `protobuf:"bytes,1,opt,name=capability,proto3" json:"capability,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	ExpiresAt     int64                  `protobuf:"varint,3,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"` // Unix seconds
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`                           // Set when the token or a caveat is not valid
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IssueCapabilityResponse) Reset() {
+	*x = IssueCapabilityResponse{}
+	mi := &file_auth_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IssueCapabilityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IssueCapabilityResponse) ProtoMessage() {}
+
+func (x *IssueCapabilityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IssueCapabilityResponse.ProtoReflect.Descriptor instead.
+func (*IssueCapabilityResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *IssueCapabilityResponse) GetCapability() string {
+	if x != nil {
+		return x.Capability
+	}
+	return ""
+}
+
+func (x *IssueCapabilityResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *IssueCapabilityResponse) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *IssueCapabilityResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Request message for VerifyCapability
+type VerifyCapabilityRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Capability       string                 `protobuf:"bytes,1,opt,name=capability,proto3" json:"capability,omitempty"`
+	Check            *PermissionCheck       `protobuf:"bytes,2,opt,name=check,proto3" json:"check,omitempty"`                                               // The action being attempted with the capability
+	ExpectedAudience string                 `protobuf:"bytes,3,opt,name=expected_audience,json=expectedAudience,proto3" json:"expected_audience,omitempty"` // The calling service's identifier, for audience caveats
+	ClientIp         string                 `protobuf:"bytes,4,opt,name=client_ip,json=clientIp,proto3" json:"client_ip,omitempty"`                         // IP address of the holder's request, for client_ip caveats
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *VerifyCapabilityRequest) Reset() {
+	*x = VerifyCapabilityRequest{}
+	mi := &file_auth_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyCapabilityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyCapabilityRequest) ProtoMessage() {}
+
+func (x *VerifyCapabilityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyCapabilityRequest.ProtoReflect.Descriptor instead.
+func (*VerifyCapabilityRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *VerifyCapabilityRequest) GetCapability() string {
+	if x != nil {
+		return x.Capability
+	}
+	return ""
+}
+
+func (x *VerifyCapabilityRequest) GetCheck() *PermissionCheck {
+	if x != nil {
+		return x.Check
+	}
+	return nil
+}
+
+func (x *VerifyCapabilityRequest) GetExpectedAudience() string {
+	if x != nil {
+		return x.ExpectedAudience
+	}
+	return ""
+}
+
+func (x *VerifyCapabilityRequest) GetClientIp() string {
+	if x != nil {
+		return x.ClientIp
+	}
+	return ""
+}
+
+// Response message for VerifyCapability
+type VerifyCapabilityResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Valid         bool                   `protobuf:"varint,1,opt,name=valid,proto3" json:"valid,omitempty"` // The capability allows the check
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`  // Why it does not, when valid is false
+	CapabilityId  string                 `protobuf:"bytes,3,opt,name=capability_id,json=capabilityId,proto3" json:"capability_id,omitempty"`
+	UserId        int32                  `protobuf:"varint,4,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"` // The issuing user, whose permissions the capability is limited to
+	OrgId         int32                  `protobuf:"varint,5,opt,name=org_id,json=orgId,proto3" json:"org_id,omitempty"`    // Organization the capability acts for, 0 for none
+	Caveats       []string               `protobuf:"bytes,6,rep,name=caveats,proto3" json:"caveats,omitempty"`              // Every caveat, including those added by holders
+	Reason        string                 `protobuf:"bytes,7,opt,name=reason,proto3" json:"reason,omitempty"`                // The policy engine's explanation of the issuer's permission
+	Policy        string                 `protobuf:"bytes,8,opt,name=policy,proto3" json:"policy,omitempty"`                // Name of the deciding policy, as in CheckPermissionResponse
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyCapabilityResponse) Reset() {
+	*x = VerifyCapabilityResponse{}
+	mi := &file_auth_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyCapabilityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyCapabilityResponse) ProtoMessage() {}
+
+func (x *VerifyCapabilityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyCapabilityResponse.ProtoReflect.Descriptor instead.
+func (*VerifyCapabilityResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *VerifyCapabilityResponse) GetValid() bool {
+	if x != nil {
+		return x.Valid
+	}
+	return false
+}
+
+func (x *VerifyCapabilityResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *VerifyCapabilityResponse) GetCapabilityId() string {
+	if x != nil {
+		return x.CapabilityId
+	}
+	return ""
+}
+
+func (x *VerifyCapabilityResponse) GetUserId() int32 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *VerifyCapabilityResponse) GetOrgId() int32 {
+	if x != nil {
+		return x.OrgId
+	}
+	return 0
+}
+
+func (x *VerifyCapabilityResponse) GetCaveats() []string {
+	if x != nil {
+		return x.Caveats
+	}
+	return nil
+}
+
+func (x *VerifyCapabilityResponse) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *VerifyCapabilityResponse) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+// A subject is an object ("user:1") or, with relation set, a userset ("group:eng#member")
+type Subject struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	ObjectId      string                 `protobuf:"bytes,2,opt,name=object_id,json=objectId,proto3" json:"object_id,omitempty"`
+	Relation      string                 `protobuf:"bytes,3,opt,name=relation,proto3" json:"relation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Subject) Reset() {
+	*x = Subject{}
+	mi := &file_auth_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Subject) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Subject) ProtoMessage() {}
+
+func (x *Subject) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Subject.ProtoReflect.Descriptor instead.
+func (*Subject) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Subject) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *Subject) GetObjectId() string {
+	if x != nil {
+		return x.ObjectId
+	}
+	return ""
+}
+
+func (x *Subject) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+// Stored fact namespace:object_id#relation@subject
+type RelationTuple struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	ObjectId      string                 `protobuf:"bytes,2,opt,name=object_id,json=objectId,proto3" json:"object_id,omitempty"`
+	Relation      string                 `protobuf:"bytes,3,opt,name=relation,proto3" json:"relation,omitempty"`
+	Subject       *Subject               `protobuf:"bytes,4,opt,name=subject,proto3" json:"subject,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RelationTuple) Reset() {
+	*x = RelationTuple{}
+	mi := &file_auth_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RelationTuple) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RelationTuple) ProtoMessage() {}
+
+func (x *RelationTuple) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RelationTuple.ProtoReflect.Descriptor instead.
+func (*RelationTuple) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RelationTuple) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *RelationTuple) GetObjectId() string {
+	if x != nil {
+		return x.ObjectId
+	}
+	return ""
+}
+
+func (x *RelationTuple) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+func (x *RelationTuple) GetSubject() *Subject {
+	if x != nil {
+		return x.Subject
+	}
+	return nil
+}
+
+type RelationTupleUpdate struct {
+	state         protoimpl.MessageState        `protogen:"open.v1"`
+	Operation     RelationTupleUpdate_Operation `protobuf:"varint,1,opt,name=operation,proto3,enum=auth.RelationTupleUpdate_Operation" json:"operation,omitempty"`
+	Tuple         *RelationTuple                `protobuf:"bytes,2,opt,name=tuple,proto3" json:"tuple,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RelationTupleUpdate) Reset() {
+	*x = RelationTupleUpdate{}
+	mi := &file_auth_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RelationTupleUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RelationTupleUpdate) ProtoMessage() {}
+
+func (x *RelationTupleUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RelationTupleUpdate.ProtoReflect.Descriptor instead.
+func (*RelationTupleUpdate) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RelationTupleUpdate) GetOperation() RelationTupleUpdate_Operation {
+	if x != nil {
+		return x.Operation
+	}
+	return RelationTupleUpdate_OPERATION_UNSPECIFIED
+}
+
+func (x *RelationTupleUpdate) GetTuple() *RelationTuple {
+	if x != nil {
+		return x.Tuple
+	}
+	return nil
+}
+
+// How fresh the data a read is evaluated against must be
+type Consistency struct {
+	state         protoimpl.MessageState  `protogen:"open.v1"`
+	Requirement   Consistency_Requirement `protobuf:"varint,1,opt,name=requirement,proto3,enum=auth.Consistency_Requirement" json:"requirement,omitempty"`
+	Zookie        string                  `protobuf:"bytes,2,opt,name=zookie,proto3" json:"zookie,omitempty"` // From a write or an earlier read; required for AT_LEAST_AS_FRESH
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Consistency) Reset() {
+	*x = Consistency{}
+	mi := &file_auth_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Consistency) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Consistency) ProtoMessage() {}
+
+func (x *Consistency) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Consistency.ProtoReflect.Descriptor instead.
+func (*Consistency) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Consistency) GetRequirement() Consistency_Requirement {
+	if x != nil {
+		return x.Requirement
+	}
+	return Consistency_REQUIREMENT_MINIMIZE_LATENCY
+}
+
+func (x *Consistency) GetZookie() string {
+	if x != nil {
+		return x.Zookie
+	}
+	return ""
+}
+
+type WriteRelationTuplesRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Updates []*RelationTupleUpdate `protobuf:"bytes,1,rep,name=updates,proto3" json:"updates,omitempty"`
+	// The writer's token, validated exactly as by ValidateToken. Users need the
+	// relationships:write permission; service clients need it as a granted scope.
+	Token         *ValidateTokenRequest `protobuf:"bytes,2,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteRelationTuplesRequest) Reset() {
+	*x = WriteRelationTuplesRequest{}
+	mi := &file_auth_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteRelationTuplesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteRelationTuplesRequest) ProtoMessage() {}
+
+func (x *WriteRelationTuplesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteRelationTuplesRequest.ProtoReflect.Descriptor instead.
+func (*WriteRelationTuplesRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *WriteRelationTuplesRequest) GetUpdates() []*RelationTupleUpdate {
+	if x != nil {
+		return x.Updates
+	}
+	return nil
+}
+
+func (x *WriteRelationTuplesRequest) GetToken() *ValidateTokenRequest {
+	if x != nil {
+		return x.Token
+	}
+	return nil
+}
+
+type WriteRelationTuplesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Zookie        string                 `protobuf:"bytes,1,opt,name=zookie,proto3" json:"zookie,omitempty"` // Pass to reads that must see this write
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteRelationTuplesResponse) Reset() {
+	*x = WriteRelationTuplesResponse{}
+	mi := &file_auth_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteRelationTuplesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteRelationTuplesResponse) ProtoMessage() {}
+
+func (x *WriteRelationTuplesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteRelationTuplesResponse.ProtoReflect.Descriptor instead.
+func (*WriteRelationTuplesResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *WriteRelationTuplesResponse) GetZookie() string {
+	if x != nil {
+		return x.Zookie
+	}
+	return ""
+}
+
+func (x *WriteRelationTuplesResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type CheckRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	ObjectId      string                 `protobuf:"bytes,2,opt,name=object_id,json=objectId,proto3" json:"object_id,omitempty"`
+	Relation      string                 `protobuf:"bytes,3,opt,name=relation,proto3" json:"relation,omitempty"`
+	Subject       *Subject               `protobuf:"bytes,4,opt,name=subject,proto3" json:"subject,omitempty"`
+	Consistency   *Consistency           `protobuf:"bytes,5,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckRequest) Reset() {
+	*x = CheckRequest{}
+	mi := &file_auth_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckRequest) ProtoMessage() {}
+
+func (x *CheckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckRequest.ProtoReflect.Descriptor instead.
+func (*CheckRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *CheckRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetObjectId() string {
+	if x != nil {
+		return x.ObjectId
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetSubject() *Subject {
+	if x != nil {
+		return x.Subject
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetConsistency() *Consistency {
+	if x != nil {
+		return x.Consistency
+	}
+	return nil
+}
+
+type CheckResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Allowed       bool                   `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	CheckedAt     string                 `protobuf:"bytes,2,opt,name=checked_at,json=checkedAt,proto3" json:"checked_at,omitempty"` // Zookie of the data the answer reflects
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckResponse) Reset() {
+	*x = CheckResponse{}
+	mi := &file_auth_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckResponse) ProtoMessage() {}
+
+func (x *CheckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckResponse.ProtoReflect.Descriptor instead.
+func (*CheckResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *CheckResponse) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+func (x *CheckResponse) GetCheckedAt() string {
+	if x != nil {
+		return x.CheckedAt
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ExpandRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	ObjectId      string                 `protobuf:"bytes,2,opt,name=object_id,json=objectId,proto3" json:"object_id,omitempty"`
+	Relation      string                 `protobuf:"bytes,3,opt,name=relation,proto3" json:"relation,omitempty"`
+	Consistency   *Consistency           `protobuf:"bytes,4,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpandRequest) Reset() {
+	*x = ExpandRequest{}
+	mi := &file_auth_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpandRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpandRequest) ProtoMessage() {}
+
+func (x *ExpandRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpandRequest.ProtoReflect.Descriptor instead.
+func (*ExpandRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ExpandRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *ExpandRequest) GetObjectId() string {
+	if x != nil {
+		return x.ObjectId
+	}
+	return ""
+}
+
+func (x *ExpandRequest) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+func (x *ExpandRequest) GetConsistency() *Consistency {
+	if x != nil {
+		return x.Consistency
+	}
+	return nil
+}
+
+// Node of an expanded userset rewrite
+type UsersetTree struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operation     string                 `protobuf:"bytes,1,opt,name=operation,proto3" json:"operation,omitempty"` // "leaf", "union", "intersection" or "exclusion"
+	Userset       string                 `protobuf:"bytes,2,opt,name=userset,proto3" json:"userset,omitempty"`     // namespace:object_id#relation the node expands
+	Subjects      []*Subject             `protobuf:"bytes,3,rep,name=subjects,proto3" json:"subjects,omitempty"`   // Direct subjects, for leaves
+	Children      []*UsersetTree         `protobuf:"bytes,4,rep,name=children,proto3" json:"children,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UsersetTree) Reset() {
+	*x = UsersetTree{}
+	mi := &file_auth_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UsersetTree) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UsersetTree) ProtoMessage() {}
+
+func (x *UsersetTree) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UsersetTree.ProtoReflect.Descriptor instead.
+func (*UsersetTree) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *UsersetTree) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *UsersetTree) GetUserset() string {
+	if x != nil {
+		return x.Userset
+	}
+	return ""
+}
+
+func (x *UsersetTree) GetSubjects() []*Subject {
+	if x != nil {
+		return x.Subjects
+	}
+	return nil
+}
+
+func (x *UsersetTree) GetChildren() []*UsersetTree {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
+type ExpandResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tree          *UsersetTree           `protobuf:"bytes,1,opt,name=tree,proto3" json:"tree,omitempty"`
+	ExpandedAt    string                 `protobuf:"bytes,2,opt,name=expanded_at,json=expandedAt,proto3" json:"expanded_at,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpandResponse) Reset() {
+	*x = ExpandResponse{}
+	mi := &file_auth_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpandResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpandResponse) ProtoMessage() {}
+
+func (x *ExpandResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpandResponse.ProtoReflect.Descriptor instead.
+func (*ExpandResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ExpandResponse) GetTree() *UsersetTree {
+	if x != nil {
+		return x.Tree
+	}
+	return nil
+}
+
+func (x *ExpandResponse) GetExpandedAt() string {
+	if x != nil {
+		return x.ExpandedAt
+	}
+	return ""
+}
+
+func (x *ExpandResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ListObjectsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Relation      string                 `protobuf:"bytes,2,opt,name=relation,proto3" json:"relation,omitempty"`
+	Subject       *Subject               `protobuf:"bytes,3,opt,name=subject,proto3" json:"subject,omitempty"`
+	Consistency   *Consistency           `protobuf:"bytes,4,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	Cursor        string                 `protobuf:"bytes,5,opt,name=cursor,proto3" json:"cursor,omitempty"` // next_cursor of the previous page; empty for the first page
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListObjectsRequest) Reset() {
+	*x = ListObjectsRequest{}
+	mi := &file_auth_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListObjectsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListObjectsRequest) ProtoMessage() {}
+
+func (x *ListObjectsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListObjectsRequest.ProtoReflect.Descriptor instead.
+func (*ListObjectsRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ListObjectsRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *ListObjectsRequest) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+func (x *ListObjectsRequest) GetSubject() *Subject {
+	if x != nil {
+		return x.Subject
+	}
+	return nil
+}
+
+func (x *ListObjectsRequest) GetConsistency() *Consistency {
+	if x != nil {
+		return x.Consistency
+	}
+	return nil
+}
+
+func (x *ListObjectsRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+// One page of objects. Each page examines a bounded number of candidate objects, so it
+// may be empty while more pages remain; keep requesting until next_cursor is empty.
+type ListObjectsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ObjectIds     []string               `protobuf:"bytes,1,rep,name=object_ids,json=objectIds,proto3" json:"object_ids,omitempty"`
+	ListedAt      string                 `protobuf:"bytes,2,opt,name=listed_at,json=listedAt,proto3" json:"listed_at,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,4,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"` // Set when more candidates remain
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListObjectsResponse) Reset() {
+	*x = ListObjectsResponse{}
+	mi := &file_auth_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListObjectsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListObjectsResponse) ProtoMessage() {}
+
+func (x *ListObjectsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListObjectsResponse.ProtoReflect.Descriptor instead.
+func (*ListObjectsResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ListObjectsResponse) GetObjectIds() []string {
+	if x != nil {
+		return x.ObjectIds
+	}
+	return nil
+}
+
+func (x *ListObjectsResponse) GetListedAt() string {
+	if x != nil {
+		return x.ListedAt
+	}
+	return ""
+}
+
+func (x *ListObjectsResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ListObjectsResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+var File_auth_proto protoreflect.FileDescriptor
+
+const file_auth_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"auth.proto\x12\x04auth\"\xe3\x01\n" +
+	"\x14ValidateTokenRequest\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x1d\n" +
+	"\n" +
+	"dpop_proof\x18\x02 \x01(\tR\tdpopProof\x12\x1f\n" +
+	"\vhttp_method\x18\x03 \x01(\tR\n" +
+	"httpMethod\x12\x19\n" +
+	"\bhttp_url\x18\x04 \x01(\tR\ahttpUrl\x12-\n" +
+	"\x12client_certificate\x18\x05 \x01(\fR\x11clientCertificate\x12+\n" +
+	"\x11expected_audience\x18\x06 \x01(\tR\x10expectedAudience\"\xc7\x03\n" +
+	"\x15ValidateTokenResponse\x12\x19\n" +
+	"\bis_valid\x18\x01 \x01(\bR\aisValid\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x05R\x06userId\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12:\n" +
+	"\x0eprincipal_type\x18\x04 \x01(\x0e2\x13.auth.PrincipalTypeR\rprincipalType\x12\x1b\n" +
+	"\tclient_id\x18\x05 \x01(\tR\bclientId\x12\x14\n" +
+	"\x05scope\x18\x06 \x01(\tR\x05scope\x12\x1a\n" +
+	"\baudience\x18\a \x03(\tR\baudience\x12\x14\n" +
+	"\x05actor\x18\b \x01(\tR\x05actor\x12\x18\n" +
+	"\asubject\x18\t \x01(\tR\asubject\x12\x16\n" +
+	"\x06issuer\x18\n" +
+	" \x01(\tR\x06issuer\x12\x14\n" +
+	"\x05roles\x18\v \x03(\tR\x05roles\x12 \n" +
+	"\vpermissions\x18\f \x03(\tR\vpermissions\x12\x15\n" +
+	"\x06org_id\x18\r \x01(\x05R\x05orgId\x12$\n" +
+	"\rimpersonation\x18\x0e \x01(\bR\rimpersonation\x12\x1c\n" +
+	"\n" +
+	"api_key_id\x18\x0f \x01(\tR\bapiKeyId\"f\n" +
+	"\bResource\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x19\n" +
+	"\bowner_id\x18\x03 \x01(\tR\aownerId\x12\x1b\n" +
+	"\ttenant_id\x18\x04 \x01(\tR\btenantId\"U\n" +
+	"\x0fPermissionCheck\x12\x16\n" +
+	"\x06action\x18\x01 \x01(\tR\x06action\x12*\n" +
+	"\bresource\x18\x02 \x01(\v2\x0e.auth.ResourceR\bresource\"\x94\x01\n" +
+	"\x16CheckPermissionRequest\x120\n" +
+	"\x05token\x18\x01 \x01(\v2\x1a.auth.ValidateTokenRequestR\x05token\x12+\n" +
+	"\x05check\x18\x02 \x01(\v2\x15.auth.PermissionCheckR\x05check\x12\x1b\n" +
+	"\tclient_ip\x18\x03 \x01(\tR\bclientIp\"y\n" +
+	"\x17CheckPermissionResponse\x12\x18\n" +
+	"\aallowed\x18\x01 \x01(\bR\aallowed\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\x12\x16\n" +
+	"\x06policy\x18\x03 \x01(\tR\x06policy\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"\x9b\x01\n" +
+	"\x1bBatchCheckPermissionRequest\x120\n" +
+	"\x05token\x18\x01 \x01(\v2\x1a.auth.ValidateTokenRequestR\x05token\x12-\n" +
+	"\x06checks\x18\x02 \x03(\v2\x15.auth.PermissionCheckR\x06checks\x12\x1b\n" +
+	"\tclient_ip\x18\x03 \x01(\tR\bclientIp\"m\n" +
+	"\x1cBatchCheckPermissionResponse\x127\n" +
+	"\aresults\x18\x01 \x03(\v2\x1d.auth.CheckPermissionResponseR\aresults\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x83\x01\n" +
+	"\x16IssueCapabilityRequest\x120\n" +
+	"\x05token\x18\x01 \x01(\v2\x1a.auth.ValidateTokenRequestR\x05token\x12\x18\n" +
+	"\acaveats\x18\x02 \x03(\tR\acaveats\x12\x1d\n" +
+	"\n" +
+	"expires_in\x18\x03 \x01(\x03R\texpiresIn\"~\n" +
+	"\x17IssueCapabilityResponse\x12\x1e\n" +
+	"\n" +
+	"capability\x18\x01 \x01(\tR\n" +
+	"capability\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x03 \x01(\x03R\texpiresAt\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"\xb0\x01\n" +
+	"\x17VerifyCapabilityRequest\x12\x1e\n" +
+	"\n" +
+	"capability\x18\x01 \x01(\tR\n" +
+	"capability\x12+\n" +
+	"\x05check\x18\x02 \x01(\v2\x15.auth.PermissionCheckR\x05check\x12+\n" +
+	"\x11expected_audience\x18\x03 \x01(\tR\x10expectedAudience\x12\x1b\n" +
+	"\tclient_ip\x18\x04 \x01(\tR\bclientIp\"\xe5\x01\n" +
+	"\x18VerifyCapabilityResponse\x12\x14\n" +
+	"\x05valid\x18\x01 \x01(\bR\x05valid\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x12#\n" +
+	"\rcapability_id\x18\x03 \x01(\tR\fcapabilityId\x12\x17\n" +
+	"\auser_id\x18\x04 \x01(\x05R\x06userId\x12\x15\n" +
+	"\x06org_id\x18\x05 \x01(\x05R\x05orgId\x12\x18\n" +
+	"\acaveats\x18\x06 \x03(\tR\acaveats\x12\x16\n" +
+	"\x06reason\x18\a \x01(\tR\x06reason\x12\x16\n" +
+	"\x06policy\x18\b \x01(\tR\x06policy\"`\n" +
+	"\aSubject\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x1b\n" +
+	"\tobject_id\x18\x02 \x01(\tR\bobjectId\x12\x1a\n" +
+	"\brelation\x18\x03 \x01(\tR\brelation\"\x8f\x01\n" +
+	"\rRelationTuple\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x1b\n" +
+	"\tobject_id\x18\x02 \x01(\tR\bobjectId\x12\x1a\n" +
+	"\brelation\x18\x03 \x01(\tR\brelation\x12'\n" +
+	"\asubject\x18\x04 \x01(\v2\r.auth.SubjectR\asubject\"\xd6\x01\n" +
+	"\x13RelationTupleUpdate\x12A\n" +
+	"\toperation\x18\x01 \x01(\x0e2#.auth.RelationTupleUpdate.OperationR\toperation\x12)\n" +
+	"\x05tuple\x18\x02 \x01(\v2\x13.auth.RelationTupleR\x05tuple\"Q\n" +
+	"\tOperation\x12\x19\n" +
+	"\x15OPERATION_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fOPERATION_TOUCH\x10\x01\x12\x14\n" +
+	"\x10OPERATION_DELETE\x10\x02\"\xdc\x01\n" +
+	"\vConsistency\x12?\n" +
+	"\vrequirement\x18\x01 \x01(\x0e2\x1d.auth.Consistency.RequirementR\vrequirement\x12\x16\n" +
+	"\x06zookie\x18\x02 \x01(\tR\x06zookie\"t\n" +
+	"\vRequirement\x12 \n" +
+	"\x1cREQUIREMENT_MINIMIZE_LATENCY\x10\x00\x12!\n" +
+	"\x1dREQUIREMENT_AT_LEAST_AS_FRESH\x10\x01\x12 \n" +
+	"\x1cREQUIREMENT_FULLY_CONSISTENT\x10\x02\"\x83\x01\n" +
+	"\x1aWriteRelationTuplesRequest\x123\n" +
+	"\aupdates\x18\x01 \x03(\v2\x19.auth.RelationTupleUpdateR\aupdates\x120\n" +
+	"\x05token\x18\x02 \x01(\v2\x1a.auth.ValidateTokenRequestR\x05token\"K\n" +
+	"\x1bWriteRelationTuplesResponse\x12\x16\n" +
+	"\x06zookie\x18\x01 \x01(\tR\x06zookie\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\xc3\x01\n" +
+	"\fCheckRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x1b\n" +
+	"\tobject_id\x18\x02 \x01(\tR\bobjectId\x12\x1a\n" +
+	"\brelation\x18\x03 \x01(\tR\brelation\x12'\n" +
+	"\asubject\x18\x04 \x01(\v2\r.auth.SubjectR\asubject\x123\n" +
+	"\vconsistency\x18\x05 \x01(\v2\x11.auth.ConsistencyR\vconsistency\"^\n" +
+	"\rCheckResponse\x12\x18\n" +
+	"\aallowed\x18\x01 \x01(\bR\aallowed\x12\x1d\n" +
+	"\n" +
+	"checked_at\x18\x02 \x01(\tR\tcheckedAt\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x9b\x01\n" +
+	"\rExpandRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x1b\n" +
+	"\tobject_id\x18\x02 \x01(\tR\bobjectId\x12\x1a\n" +
+	"\brelation\x18\x03 \x01(\tR\brelation\x123\n" +
+	"\vconsistency\x18\x04 \x01(\v2\x11.auth.ConsistencyR\vconsistency\"\x9f\x01\n" +
+	"\vUsersetTree\x12\x1c\n" +
+	"\toperation\x18\x01 \x01(\tR\toperation\x12\x18\n" +
+	"\auserset\x18\x02 \x01(\tR\auserset\x12)\n" +
+	"\bsubjects\x18\x03 \x03(\v2\r.auth.SubjectR\bsubjects\x12-\n" +
+	"\bchildren\x18\x04 \x03(\v2\x11.auth.UsersetTreeR\bchildren\"n\n" +
+	"\x0eExpandResponse\x12%\n" +
+	"\x04tree\x18\x01 \x01(\v2\x11.auth.UsersetTreeR\x04tree\x12\x1f\n" +
+	"\vexpanded_at\x18\x02 \x01(\tR\n" +
+	"expandedAt\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\xc4\x01\n" +
+	"\x12ListObjectsRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x1a\n" +
+	"\brelation\x18\x02 \x01(\tR\brelation\x12'\n" +
+	"\asubject\x18\x03 \x01(\v2\r.auth.SubjectR\asubject\x123\n" +
+	"\vconsistency\x18\x04 \x01(\v2\x11.auth.ConsistencyR\vconsistency\x12\x16\n" +
+	"\x06cursor\x18\x05 \x01(\tR\x06cursor\"\x88\x01\n" +
+	"\x13ListObjectsResponse\x12\x1d\n" +
+	"\n" +
+	"object_ids\x18\x01 \x03(\tR\tobjectIds\x12\x1b\n" +
+	"\tlisted_at\x18\x02 \x01(\tR\blistedAt\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x1f\n" +
+	"\vnext_cursor\x18\x04 \x01(\tR\n" +
+	"nextCursor*d\n" +
+	"\rPrincipalType\x12\x1e\n" +
+	"\x1aPRINCIPAL_TYPE_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13PRINCIPAL_TYPE_USER\x10\x01\x12\x1a\n" +
+	"\x16PRINCIPAL_TYPE_SERVICE\x10\x022\xb6\x03\n" +
 	"\x0eAuthValidation\x12J\n" +
-	"\rValidateToken\x12\x1a.auth.ValidateTokenRequest\x1a\x1b.auth.ValidateTokenResponse\"\x00B\n" +
+	"\rValidateToken\x12\x1a.auth.ValidateTokenRequest\x1a\x1b.auth.ValidateTokenResponse\"\x00\x12P\n" +
+	"\x0fCheckPermission\x12\x1c.auth.CheckPermissionRequest\x1a\x1d.auth.CheckPermissionResponse\"\x00\x12_\n" +
+	"\x14BatchCheckPermission\x12!.auth.BatchCheckPermissionRequest\x1a\".auth.BatchCheckPermissionResponse\"\x00\x12P\n" +
+	"\x0fIssueCapability\x12\x1c.auth.IssueCapabilityRequest\x1a\x1d.auth.IssueCapabilityResponse\"\x00\x12S\n" +
+	"\x10VerifyCapability\x12\x1d.auth.VerifyCapabilityRequest\x1a\x1e.auth.VerifyCapabilityResponse\"\x002\x9e\x02\n" +
+	"\rRelationships\x12\\\n" +
+	"\x13WriteRelationTuples\x12 .auth.WriteRelationTuplesRequest\x1a!.auth.WriteRelationTuplesResponse\"\x00\x122\n" +
+	"\x05Check\x12\x12.auth.CheckRequest\x1a\x13.auth.CheckResponse\"\x00\x125\n" +
+	"\x06Expand\x12\x13.auth.ExpandRequest\x1a\x14.auth.ExpandResponse\"\x00\x12D\n" +
+	"\vListObjects\x12\x18.auth.ListObjectsRequest\x1a\x19.auth.ListObjectsResponse\"\x00B\n" +
 	"Z\b./authpbb\x06proto3"
 
 var (
@@ -155,19 +2090,85 @@ func file_auth_proto_rawDescGZIP() []byte {
 	return file_auth_proto_rawDescData
 }
 
-var file_auth_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_auth_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_auth_proto_msgTypes = make([]protoimpl.MessageInfo, 25)
 var file_auth_proto_goTypes = []any{
-	(*ValidateTokenRequest)(nil),  // 0: auth.ValidateTokenRequest
-	(*ValidateTokenResponse)(nil), // 1: auth.ValidateTokenResponse
+	(PrincipalType)(0),                   // 0: auth.PrincipalType
+	(RelationTupleUpdate_Operation)(0),   // 1: auth.RelationTupleUpdate.Operation
+	(Consistency_Requirement)(0),         // 2: auth.Consistency.Requirement
+	(*ValidateTokenRequest)(nil),         // 3: auth.ValidateTokenRequest
+	(*ValidateTokenResponse)(nil),        // 4: auth.ValidateTokenResponse
+	(*Resource)(nil),                     // 5: auth.Resource
+	(*PermissionCheck)(nil),              // 6: auth.PermissionCheck
+	(*CheckPermissionRequest)(nil),       // 7: auth.CheckPermissionRequest
+	(*CheckPermissionResponse)(nil),      // 8: auth.CheckPermissionResponse
+	(*BatchCheckPermissionRequest)(nil),  // 9: auth.BatchCheckPermissionRequest
+	(*BatchCheckPermissionResponse)(nil), // 10: auth.BatchCheckPermissionResponse
+	(*IssueCapabilityRequest)(nil),       // 11: auth.IssueCapabilityRequest
+	(*IssueCapabilityResponse)(nil),      // 12: auth.IssueCapabilityResponse
+	(*VerifyCapabilityRequest)(nil),      // 13: auth.VerifyCapabilityRequest
+	(*VerifyCapabilityResponse)(nil),     // 14: auth.VerifyCapabilityResponse
+	(*Subject)(nil),                      // 15: auth.Subject
+	(*RelationTuple)(nil),                // 16: auth.RelationTuple
+	(*RelationTupleUpdate)(nil),          // 17: auth.RelationTupleUpdate
+	(*Consistency)(nil),                  // 18: auth.Consistency
+	(*WriteRelationTuplesRequest)(nil),   // 19: auth.WriteRelationTuplesRequest
+	(*WriteRelationTuplesResponse)(nil),  // 20: auth.WriteRelationTuplesResponse
+	(*CheckRequest)(nil),                 // 21: auth.CheckRequest
+	(*CheckResponse)(nil),                // 22: auth.CheckResponse
+	(*ExpandRequest)(nil),                // 23: auth.ExpandRequest
+	(*UsersetTree)(nil),                  // 24: auth.UsersetTree
+	(*ExpandResponse)(nil),               // 25: auth.ExpandResponse
+	(*ListObjectsRequest)(nil),           // 26: auth.ListObjectsRequest
+	(*ListObjectsResponse)(nil),          // 27: auth.ListObjectsResponse
 }
 var file_auth_proto_depIdxs = []int32{
-	0, // 0: auth.AuthValidation.ValidateToken:input_type -> auth.ValidateTokenRequest
-	1, // 1: auth.AuthValidation.ValidateToken:output_type -> auth.ValidateTokenResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: auth.ValidateTokenResponse.principal_type:type_name -> auth.PrincipalType
+	5,  // 1: auth.PermissionCheck.resource:type_name -> auth.Resource
+	3,  // 2: auth.CheckPermissionRequest.token:type_name -> auth.ValidateTokenRequest
+	6,  // 3: auth.CheckPermissionRequest.check:type_name -> auth.PermissionCheck
+	3,  // 4: auth.BatchCheckPermissionRequest.token:type_name -> auth.ValidateTokenRequest
+	6,  // 5: auth.BatchCheckPermissionRequest.checks:type_name -> auth.PermissionCheck
+	8,  // 6: auth.BatchCheckPermissionResponse.results:type_name -> auth.CheckPermissionResponse
+	3,  // 7: auth.IssueCapabilityRequest.token:type_name -> auth.ValidateTokenRequest
+	6,  // 8: auth.VerifyCapabilityRequest.check:type_name -> auth.PermissionCheck
+	15, // 9: auth.RelationTuple.subject:type_name -> auth.Subject
+	1,  // 10: auth.RelationTupleUpdate.operation:type_name -> auth.RelationTupleUpdate.Operation
+	16, // 11: auth.RelationTupleUpdate.tuple:type_name -> auth.RelationTuple
+	2,  // 12: auth.Consistency.requirement:type_name -> auth.Consistency.Requirement
+	17, // 13: auth.WriteRelationTuplesRequest.updates:type_name -> auth.RelationTupleUpdate
+	3,  // 14: auth.WriteRelationTuplesRequest.token:type_name -> auth.ValidateTokenRequest
+	15, // 15: auth.CheckRequest.subject:type_name -> auth.Subject
+	18, // 16: auth.CheckRequest.consistency:type_name -> auth.Consistency
+	18, // 17: auth.ExpandRequest.consistency:type_name -> auth.Consistency
+	15, // 18: auth.UsersetTree.subjects:type_name -> auth.Subject
+	24, // 19: auth.UsersetTree.children:type_name -> auth.UsersetTree
+	24, // 20: auth.ExpandResponse.tree:type_name -> auth.UsersetTree
+	15, // 21: auth.ListObjectsRequest.subject:type_name -> auth.Subject
+	18, // 22: auth.ListObjectsRequest.consistency:type_name -> auth.Consistency
+	3,  // 23: auth.AuthValidation.ValidateToken:input_type -> auth.ValidateTokenRequest
+	7,  // 24: auth.AuthValidation.CheckPermission:input_type -> auth.CheckPermissionRequest
+	9,  // 25: auth.AuthValidation.BatchCheckPermission:input_type -> auth.BatchCheckPermissionRequest
+	11, // 26: auth.AuthValidation.IssueCapability:input_type -> auth.IssueCapabilityRequest
+	13, // 27: auth.AuthValidation.VerifyCapability:input_type -> auth.VerifyCapabilityRequest
+	19, // 28: auth.Relationships.WriteRelationTuples:input_type -> auth.WriteRelationTuplesRequest
+	21, // 29: auth.Relationships.Check:input_type -> auth.CheckRequest
+	23, // 30: auth.Relationships.Expand:input_type -> auth.ExpandRequest
+	26, // 31: auth.Relationships.ListObjects:input_type -> auth.ListObjectsRequest
+	4,  // 32: auth.AuthValidation.ValidateToken:output_type -> auth.ValidateTokenResponse
+	8,  // 33: auth.AuthValidation.CheckPermission:output_type -> auth.CheckPermissionResponse
+	10, // 34: auth.AuthValidation.BatchCheckPermission:output_type -> auth.BatchCheckPermissionResponse
+	12, // 35: auth.AuthValidation.IssueCapability:output_type -> auth.IssueCapabilityResponse
+	14, // 36: auth.AuthValidation.VerifyCapability:output_type -> auth.VerifyCapabilityResponse
+	20, // 37: auth.Relationships.WriteRelationTuples:output_type -> auth.WriteRelationTuplesResponse
+	22, // 38: auth.Relationships.Check:output_type -> auth.CheckResponse
+	25, // 39: auth.Relationships.Expand:output_type -> auth.ExpandResponse
+	27, // 40: auth.Relationships.ListObjects:output_type -> auth.ListObjectsResponse
+	32, // [32:41] is the sub-list for method output_type
+	23, // [23:32] is the sub-list for method input_type
+	23, // [23:23] is the sub-list for extension type_name
+	23, // [23:23] is the sub-list for extension extendee
+	0,  // [0:23] is the sub-list for field type_name
 }
 
 func init() { file_auth_proto_init() }
@@ -180,13 +2181,14 @@ func file_auth_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_auth_proto_rawDesc), len(file_auth_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      3,
+			NumMessages:   25,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   2,
 		},
 		GoTypes:           file_auth_proto_goTypes,
 		DependencyIndexes: file_auth_proto_depIdxs,
+		EnumInfos:         file_auth_proto_enumTypes,
 		MessageInfos:      file_auth_proto_msgTypes,
 	}.Build()
 	File_auth_proto = out.File
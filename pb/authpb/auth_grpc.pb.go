@@ -19,7 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	AuthValidation_ValidateToken_FullMethodName = "/auth.AuthValidation/ValidateToken"
+	AuthValidation_ValidateToken_FullMethodName        = "/auth.AuthValidation/ValidateToken"
+	AuthValidation_CheckPermission_FullMethodName      = "/auth.AuthValidation/CheckPermission"
+	AuthValidation_BatchCheckPermission_FullMethodName = "/auth.AuthValidation/BatchCheckPermission"
+	AuthValidation_IssueCapability_FullMethodName      = "/auth.AuthValidation/IssueCapability"
+	AuthValidation_VerifyCapability_FullMethodName     = "/auth.AuthValidation/VerifyCapability"
 )
 
 // AuthValidationClient is the client API for AuthValidation service.
@@ -30,6 +34,16 @@ const (
 type AuthValidationClient interface {
 	// RPC for stateless token validation
 	ValidateToken(ctx context.Context, in *ValidateTokenRequest, opts ...grpc.CallOption) (*ValidateTokenResponse, error)
+	// RPC deciding whether the token's subject may perform an action on a resource
+	CheckPermission(ctx context.Context, in *CheckPermissionRequest, opts ...grpc.CallOption) (*CheckPermissionResponse, error)
+	// Batch variant of CheckPermission, e.g. for filtering a list of resources
+	BatchCheckPermission(ctx context.Context, in *BatchCheckPermissionRequest, opts ...grpc.CallOption) (*BatchCheckPermissionResponse, error)
+	// Issues a capability token acting as the token's user, restricted by caveats.
+	// Holders can add further caveats offline before passing it on.
+	IssueCapability(ctx context.Context, in *IssueCapabilityRequest, opts ...grpc.CallOption) (*IssueCapabilityResponse, error)
+	// Verifies a capability token and every caveat in it against an action, and that
+	// its issuer may still perform the action
+	VerifyCapability(ctx context.Context, in *VerifyCapabilityRequest, opts ...grpc.CallOption) (*VerifyCapabilityResponse, error)
 }
 
 type authValidationClient struct {
@@ -50,6 +64,46 @@ func (c *authValidationClient) ValidateToken(ctx context.Context, in *ValidateTo
 	return out, nil
 }
 
+func (c *authValidationClient) CheckPermission(ctx context.Context, in *CheckPermissionRequest, opts ...grpc.CallOption) (*CheckPermissionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckPermissionResponse)
+	err := c.cc.Invoke(ctx, AuthValidation_CheckPermission_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authValidationClient) BatchCheckPermission(ctx context.Context, in *BatchCheckPermissionRequest, opts ...grpc.CallOption) (*BatchCheckPermissionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchCheckPermissionResponse)
+	err := c.cc.Invoke(ctx, AuthValidation_BatchCheckPermission_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authValidationClient) IssueCapability(ctx context.Context, in *IssueCapabilityRequest, opts ...grpc.CallOption) (*IssueCapabilityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IssueCapabilityResponse)
+	err := c.cc.Invoke(ctx, AuthValidation_IssueCapability_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authValidationClient) VerifyCapability(ctx context.Context, in *VerifyCapabilityRequest, opts ...grpc.CallOption) (*VerifyCapabilityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VerifyCapabilityResponse)
+	err := c.cc.Invoke(ctx, AuthValidation_VerifyCapability_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AuthValidationServer is the server API for AuthValidation service.
 // All implementations must embed UnimplementedAuthValidationServer
 // for forward compatibility.
@@ -58,6 +112,16 @@ func (c *authValidationClient) ValidateToken(ctx context.Context, in *ValidateTo
 type AuthValidationServer interface {
 	// RPC for stateless token validation
 	ValidateToken(context.Context, *ValidateTokenRequest) (*ValidateTokenResponse, error)
+	// RPC deciding whether the token's subject may perform an action on a resource
+	CheckPermission(context.Context, *CheckPermissionRequest) (*CheckPermissionResponse, error)
+	// Batch variant of CheckPermission, e.g. for filtering a list of resources
+	BatchCheckPermission(context.Context, *BatchCheckPermissionRequest) (*BatchCheckPermissionResponse, error)
+	// Issues a capability token acting as the token's user, restricted by caveats.
+	// Holders can add further caveats offline before passing it on.
+	IssueCapability(context.Context, *IssueCapabilityRequest) (*IssueCapabilityResponse, error)
+	// Verifies a capability token and every caveat in it against an action, and that
+	// its issuer may still perform the action
+	VerifyCapability(context.Context, *VerifyCapabilityRequest) (*VerifyCapabilityResponse, error)
 	mustEmbedUnimplementedAuthValidationServer()
 }
 
@@ -71,6 +135,18 @@ type UnimplementedAuthValidationServer struct{}
 func (UnimplementedAuthValidationServer) ValidateToken(context.Context, *ValidateTokenRequest) (*ValidateTokenResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ValidateToken not implemented")
 }
+func (UnimplementedAuthValidationServer) CheckPermission(context.Context, *CheckPermissionRequest) (*CheckPermissionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckPermission not implemented")
+}
+func (UnimplementedAuthValidationServer) BatchCheckPermission(context.Context, *BatchCheckPermissionRequest) (*BatchCheckPermissionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCheckPermission not implemented")
+}
+func (UnimplementedAuthValidationServer) IssueCapability(context.Context, *IssueCapabilityRequest) (*IssueCapabilityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IssueCapability not implemented")
+}
+func (UnimplementedAuthValidationServer) VerifyCapability(context.Context, *VerifyCapabilityRequest) (*VerifyCapabilityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyCapability not implemented")
+}
 func (UnimplementedAuthValidationServer) mustEmbedUnimplementedAuthValidationServer() {}
 func (UnimplementedAuthValidationServer) testEmbeddedByValue()                        {}
 
@@ -110,6 +186,78 @@ func _AuthValidation_ValidateToken_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AuthValidation_CheckPermission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckPermissionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthValidationServer).CheckPermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthValidation_CheckPermission_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthValidationServer).CheckPermission(ctx, req.(*CheckPermissionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthValidation_BatchCheckPermission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchCheckPermissionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthValidationServer).BatchCheckPermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthValidation_BatchCheckPermission_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthValidationServer).BatchCheckPermission(ctx, req.(*BatchCheckPermissionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthValidation_IssueCapability_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IssueCapabilityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthValidationServer).IssueCapability(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthValidation_IssueCapability_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthValidationServer).IssueCapability(ctx, req.(*IssueCapabilityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthValidation_VerifyCapability_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyCapabilityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthValidationServer).VerifyCapability(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthValidation_VerifyCapability_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthValidationServer).VerifyCapability(ctx, req.(*VerifyCapabilityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AuthValidation_ServiceDesc is the grpc.ServiceDesc for AuthValidation service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -121,6 +269,252 @@ var AuthValidation_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ValidateToken",
 			Handler:    _AuthValidation_ValidateToken_Handler,
 		},
+		{
+			MethodName: "CheckPermission",
+			Handler:    _AuthValidation_CheckPermission_Handler,
+		},
+		{
+			MethodName: "BatchCheckPermission",
+			Handler:    _AuthValidation_BatchCheckPermission_Handler,
+		},
+		{
+			MethodName: "IssueCapability",
+			Handler:    _AuthValidation_IssueCapability_Handler,
+		},
+		{
+			MethodName: "VerifyCapability",
+			Handler:    _AuthValidation_VerifyCapability_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "auth.proto",
+}
+
+const (
+	Relationships_WriteRelationTuples_FullMethodName = "/auth.Relationships/WriteRelationTuples"
+	Relationships_Check_FullMethodName               = "/auth.Relationships/Check"
+	Relationships_Expand_FullMethodName              = "/auth.Relationships/Expand"
+	Relationships_ListObjects_FullMethodName         = "/auth.Relationships/ListObjects"
+)
+
+// RelationshipsClient is the client API for Relationships service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Relationship-based authorization over stored relation tuples
+// (object#relation@subject), evaluated with the namespace schema's rewrites.
+type RelationshipsClient interface {
+	// Inserts or deletes tuples atomically; returns a zookie for consistent reads
+	WriteRelationTuples(ctx context.Context, in *WriteRelationTuplesRequest, opts ...grpc.CallOption) (*WriteRelationTuplesResponse, error)
+	// Whether the subject has the relation to the object
+	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	// The tree of subjects and usersets that have the relation to the object
+	Expand(ctx context.Context, in *ExpandRequest, opts ...grpc.CallOption) (*ExpandResponse, error)
+	// Objects of a namespace the subject has the relation to, one page at a time
+	ListObjects(ctx context.Context, in *ListObjectsRequest, opts ...grpc.CallOption) (*ListObjectsResponse, error)
+}
+
+type relationshipsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRelationshipsClient(cc grpc.ClientConnInterface) RelationshipsClient {
+	return &relationshipsClient{cc}
+}
+
+func (c *relationshipsClient) WriteRelationTuples(ctx context.Context, in *WriteRelationTuplesRequest, opts ...grpc.CallOption) (*WriteRelationTuplesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteRelationTuplesResponse)
+	err := c.cc.Invoke(ctx, Relationships_WriteRelationTuples_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *relationshipsClient) Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckResponse)
+	err := c.cc.Invoke(ctx, Relationships_Check_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *relationshipsClient) Expand(ctx context.Context, in *ExpandRequest, opts ...grpc.CallOption) (*ExpandResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExpandResponse)
+	err := c.cc.Invoke(ctx, Relationships_Expand_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *relationshipsClient) ListObjects(ctx context.Context, in *ListObjectsRequest, opts ...grpc.CallOption) (*ListObjectsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListObjectsResponse)
+	err := c.cc.Invoke(ctx, Relationships_ListObjects_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RelationshipsServer is the server API for Relationships service.
+// All implementations must embed UnimplementedRelationshipsServer
+// for forward compatibility.
+//
+// Relationship-based authorization over stored relation tuples
+// (object#relation@subject), evaluated with the namespace schema's rewrites.
+type RelationshipsServer interface {
+	// Inserts or deletes tuples atomically; returns a zookie for consistent reads
+	WriteRelationTuples(context.Context, *WriteRelationTuplesRequest) (*WriteRelationTuplesResponse, error)
+	// Whether the subject has the relation to the object
+	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+	// The tree of subjects and usersets that have the relation to the object
+	Expand(context.Context, *ExpandRequest) (*ExpandResponse, error)
+	// Objects of a namespace the subject has the relation to, one page at a time
+	ListObjects(context.Context, *ListObjectsRequest) (*ListObjectsResponse, error)
+	mustEmbedUnimplementedRelationshipsServer()
+}
+
+// UnimplementedRelationshipsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRelationshipsServer struct{}
+
+func (UnimplementedRelationshipsServer) WriteRelationTuples(context.Context, *WriteRelationTuplesRequest) (*WriteRelationTuplesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteRelationTuples not implemented")
+}
+func (UnimplementedRelationshipsServer) Check(context.Context, *CheckRequest) (*CheckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Check not implemented")
+}
+func (UnimplementedRelationshipsServer) Expand(context.Context, *ExpandRequest) (*ExpandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Expand not implemented")
+}
+func (UnimplementedRelationshipsServer) ListObjects(context.Context, *ListObjectsRequest) (*ListObjectsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListObjects not implemented")
+}
+func (UnimplementedRelationshipsServer) mustEmbedUnimplementedRelationshipsServer() {}
+func (UnimplementedRelationshipsServer) testEmbeddedByValue()                       {}
+
+// UnsafeRelationshipsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RelationshipsServer will
+// result in compilation errors.
+type UnsafeRelationshipsServer interface {
+	mustEmbedUnimplementedRelationshipsServer()
+}
+
+func RegisterRelationshipsServer(s grpc.ServiceRegistrar, srv RelationshipsServer) {
+	// If the following call pancis, it indicates UnimplementedRelationshipsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Relationships_ServiceDesc, srv)
+}
+
+func _Relationships_WriteRelationTuples_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRelationTuplesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationshipsServer).WriteRelationTuples(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relationships_WriteRelationTuples_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationshipsServer).WriteRelationTuples(ctx, req.(*WriteRelationTuplesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Relationships_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationshipsServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relationships_Check_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationshipsServer).Check(ctx, req.(*CheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Relationships_Expand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationshipsServer).Expand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relationships_Expand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationshipsServer).Expand(ctx, req.(*ExpandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Relationships_ListObjects_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListObjectsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationshipsServer).ListObjects(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relationships_ListObjects_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationshipsServer).ListObjects(ctx, req.(*ListObjectsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Relationships_ServiceDesc is the grpc.ServiceDesc for Relationships service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Relationships_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "auth.Relationships",
+	HandlerType: (*RelationshipsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "WriteRelationTuples",
+			Handler:    _Relationships_WriteRelationTuples_Handler,
+		},
+		{
+			MethodName: "Check",
+			Handler:    _Relationships_Check_Handler,
+		},
+		{
+			MethodName: "Expand",
+			Handler:    _Relationships_Expand_Handler,
+		},
+		{
+			MethodName: "ListObjects",
+			Handler:    _Relationships_ListObjects_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "auth.proto",